@@ -0,0 +1,266 @@
+// Package changeset applies the file modifications of an AI response
+// (collector.AIResponse) to a project: it resolves the paths the model was
+// given back to files below the project root, then creates, updates or
+// deletes them and reports the outcome of every modification. DryRun reports
+// the same without touching any file, with a unified diff of every change.
+package changeset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"projectson/collector"
+	"strings"
+)
+
+// Status is the outcome of one modification.
+type Status string
+
+const (
+	StatusApplied    Status = "applied"
+	StatusReady      Status = "ready" // Would be applied; reported by DryRun
+	StatusFailed     Status = "failed"
+	StatusNotApplied Status = "not applied" // Valid, but the transaction was aborted by another modification
+)
+
+var errFileExists = errors.New("file already exists; use \"update\" to overwrite it")
+
+// Result describes what happened to one modification of a response.
+type Result struct {
+	Path   string // Path as given in the response
+	Action string // Action as given in the response, lower-cased
+	Target string // Absolute path of the file; empty when the path could not be resolved
+	Status Status
+	Err    error  // Why the modification failed; nil when it was applied
+	Note   string // Remark on an applied modification, e.g. a file to delete that did not exist
+	Diff   string // Unified diff of the change; set by DryRun only
+}
+
+// Report lists the results of applying a response, in response order.
+type Report struct {
+	Results []Result
+	// Aborted is set when a modification failed, or Err is set, and Apply
+	// restored every file it had touched, so that nothing changed.
+	Aborted bool
+	// Err is the error that aborted the transaction outside of any single
+	// modification, such as a journal that could not be written.
+	Err error
+	// RollbackErr lists the files that could not be restored after an abort;
+	// nil when the rollback was complete.
+	RollbackErr error
+	// JournalID identifies the journal of the applied change set in the
+	// history; empty when nothing was changed.
+	JournalID string
+}
+
+// Applied returns the number of modifications that were applied.
+func (r *Report) Applied() int {
+	return r.count(StatusApplied)
+}
+
+// Ready returns the number of modifications a dry run found applicable.
+func (r *Report) Ready() int {
+	return r.count(StatusReady)
+}
+
+// Failed returns the number of modifications that failed.
+func (r *Report) Failed() int {
+	return r.count(StatusFailed)
+}
+
+func (r *Report) count(status Status) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Parse decodes a response of the form {"modified_files": [...]}.
+func Parse(data []byte) (*collector.AIResponse, error) {
+	if strings.TrimSpace(string(data)) == "" {
+		return nil, errors.New("AI response is empty")
+	}
+	var resp collector.AIResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("invalid AI JSON response: %w. Check for syntax errors, unescaped newlines, or incorrect structure; the expected root is {\"modified_files\": [...]}", err)
+	}
+	return &resp, nil
+}
+
+// RelativePath turns a path from a response into a path relative to root.
+// Responses use the paths of the output, which start with the basename of
+// root ("myproject/src/main.go"); that prefix is stripped. A path without it
+// is taken as relative to root, and stripped is false. The result is not
+// validated; Apply and DryRun reject paths that leave root, directly or
+// through a symbolic link, and paths into .git.
+func RelativePath(root, path string) (rel string, stripped bool) {
+	path = filepath.FromSlash(path)
+	if rest, ok := strings.CutPrefix(path, filepath.Base(root)+string(os.PathSeparator)); ok {
+		return rest, true
+	}
+	return path, false
+}
+
+// Apply applies the modifications of resp to the project in root as one
+// transaction: the new contents are written to temporary files first and
+// then renamed into place, keeping the originals as backups until all
+// modifications are done. If any modification fails, every file touched is
+// restored and Report.Aborted is set. A change set that was applied is
+// recorded in the history, see Undo. Files outside scope are rejected; a
+// nil scope admits every file below root.
+func Apply(root string, resp *collector.AIResponse, scope *Scope) *Report {
+	report := &Report{Results: make([]Result, len(resp.ModifiedFiles))}
+	tx := &transaction{root: root, report: report}
+	seen := map[string]bool{}
+	for i, mod := range resp.ModifiedFiles {
+		c := check(root, mod, scope, seen)
+		if c.result.Err == nil {
+			c.result.Err = tx.stage(i, c)
+		}
+		report.Results[i] = finish(c.result, c.notes, StatusApplied)
+	}
+	tx.execute(true)
+	return report
+}
+
+// DryRun reports what Apply would do with the modifications of resp without
+// changing any file. Applicable modifications get StatusReady and a diff:
+// an update shows the changes to the current file, a create a new-file diff
+// and a delete the removal of every line. Modifications Apply would reject,
+// such as a create of an existing file or a path outside scope, get
+// StatusFailed.
+func DryRun(root string, resp *collector.AIResponse, scope *Scope) *Report {
+	report := &Report{}
+	seen := map[string]bool{}
+	for _, mod := range resp.ModifiedFiles {
+		report.Results = append(report.Results, dryRunOne(root, mod, scope, seen))
+	}
+	return report
+}
+
+// finish sets the status of result, status unless it has an error.
+func finish(result Result, notes []string, status Status) Result {
+	result.Status = status
+	if result.Err != nil {
+		result.Status = StatusFailed
+	}
+	result.Note = strings.Join(notes, "; ")
+	return result
+}
+
+// checked is a modification resolved against the files on disk.
+type checked struct {
+	mod    collector.AIFileModification
+	result Result
+	notes  []string
+	info   os.FileInfo // Current file; nil when it does not exist
+	mode   os.FileMode // Permissions of a new file; 0 for the default
+	link   string      // Target of a symbolic link to create instead of a file
+}
+
+// check resolves mod and rejects what cannot be applied. seen holds the
+// targets of the earlier modifications of the response; a file may only be
+// modified once, so that the outcome does not depend on their order.
+func check(root string, mod collector.AIFileModification, scope *Scope, seen map[string]bool) *checked {
+	c := &checked{mod: mod, result: Result{Path: mod.Path, Action: strings.ToLower(mod.Action)}}
+	rel, stripped, err := resolve(root, mod.Path)
+	if err == nil {
+		err = scope.admits(rel)
+	}
+	if err != nil {
+		c.result.Err = err
+		return c
+	}
+	c.result.Target = filepath.Join(root, rel)
+	if !stripped {
+		c.notes = append(c.notes, fmt.Sprintf("path does not start with %q, taken as relative to the root", filepath.Base(root)+"/"))
+	}
+
+	// An update writes through a symbolic link to the file it points to, so
+	// that the link stays; a delete removes the link itself.
+	if c.result.Action != "delete" {
+		dest, err := linkTarget(root, rel)
+		if err != nil {
+			c.result.Err = err
+			return c
+		}
+		if dest != rel {
+			c.result.Target = filepath.Join(root, dest)
+			c.notes = append(c.notes, fmt.Sprintf("symbolic link to %s, which is written instead", filepath.ToSlash(dest)))
+		}
+	}
+
+	if seen[c.result.Target] {
+		c.result.Err = errors.New("file is modified more than once in the response")
+		return c
+	}
+	seen[c.result.Target] = true
+
+	info, err := os.Lstat(c.result.Target)
+	switch {
+	case err == nil && info.IsDir():
+		c.result.Err = errors.New("path is a directory")
+		return c
+	case err == nil:
+		c.info = info
+		if info.Mode()&os.ModeSymlink != 0 {
+			c.notes = append(c.notes, "symbolic link; the link is deleted, not the file it points to")
+		}
+	case !os.IsNotExist(err):
+		c.result.Err = err
+		return c
+	}
+
+	switch c.result.Action {
+	case "update":
+		if c.info == nil {
+			c.notes = append(c.notes, "new file")
+		}
+	case "create":
+		// Refuse to overwrite, so a wrong action cannot destroy a file.
+		if c.info != nil {
+			c.result.Err = errFileExists
+		}
+	case "delete":
+		if c.info == nil {
+			c.notes = append(c.notes, "file does not exist, nothing to delete")
+		}
+	default:
+		c.result.Err = fmt.Errorf("unknown action %q", mod.Action)
+	}
+	return c
+}
+
+func dryRunOne(root string, mod collector.AIFileModification, scope *Scope, seen map[string]bool) Result {
+	c := check(root, mod, scope, seen)
+	if c.result.Err != nil {
+		return finish(c.result, c.notes, StatusReady)
+	}
+	var current []byte
+	if c.info != nil && c.info.Mode()&os.ModeSymlink == 0 {
+		var err error
+		if current, err = os.ReadFile(c.result.Target); err != nil {
+			c.result.Err = err
+			return finish(c.result, c.notes, StatusReady)
+		}
+	}
+
+	path := filepath.ToSlash(mod.Path)
+	switch c.result.Action {
+	case "update", "create":
+		c.result.Diff = unifiedDiff(path, string(current), c.info != nil, mod.Content, true)
+		if c.info != nil && c.result.Diff == "" {
+			c.notes = append(c.notes, "content is unchanged")
+		}
+	case "delete":
+		if c.info != nil {
+			c.result.Diff = unifiedDiff(path, string(current), true, "", false)
+		}
+	}
+	return finish(c.result, c.notes, StatusReady)
+}
@@ -0,0 +1,51 @@
+package changeset
+
+import (
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// unifiedDiff returns the unified diff that turns old into new for the file
+// at path (a path of the response, with forward slashes). A file that does not
+// exist on one side is shown as /dev/null, so creations and removals read as
+// new-file and deleted-file diffs. The diff is empty when nothing changes.
+func unifiedDiff(path string, old string, oldExists bool, new string, newExists bool) string {
+	from, to := "a/"+path, "b/"+path
+	if !oldExists {
+		from = "/dev/null"
+	}
+	if !newExists {
+		to = "/dev/null"
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(old),
+		B:        splitLines(new),
+		FromFile: from,
+		ToFile:   to,
+		Context:  diffContext,
+	})
+	if err != nil {
+		// Only returned by a failing writer, which a string builder is not.
+		return ""
+	}
+	return diff
+}
+
+// splitLines splits s into lines that each end with a newline, adding one to
+// a last line without it. Unlike difflib.SplitLines, an empty s has no lines.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += "\n"
+	}
+	return lines
+}
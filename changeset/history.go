@@ -0,0 +1,298 @@
+package changeset
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"projectson/collector"
+	"sort"
+	"time"
+)
+
+// HistoryDir is the directory, relative to the project root, holding a
+// journal for every applied change set, each in a directory named by its ID.
+var HistoryDir = filepath.Join(collector.StateDirName, "history")
+
+const (
+	journalFileName = "journal.json"
+	originalsDir    = "originals" // Original bytes of updated and deleted files, by path
+)
+
+// Changes recorded in a journal.
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// Journal records a change set applied by Apply, so that Undo can revert it.
+type Journal struct {
+	ID     string         `json:"id"`
+	Time   time.Time      `json:"time"`
+	Files  []JournalEntry `json:"files"`
+	Undone *time.Time     `json:"undone,omitempty"` // When the change set was reverted
+}
+
+// JournalEntry records the change of one file.
+type JournalEntry struct {
+	Path   string      `json:"path"`             // Relative to the root, with forward slashes
+	Change string      `json:"change"`           // ChangeCreated, ChangeUpdated or ChangeDeleted
+	Mode   os.FileMode `json:"mode,omitempty"`   // Permissions of the original
+	SHA256 string      `json:"sha256,omitempty"` // Of the content written; empty for a deleted file
+	Dirs   []string    `json:"dirs,omitempty"`   // Directories created for a new file, parents first, like Path
+	Link   string      `json:"link,omitempty"`   // Target of a deleted symbolic link, which has no original copy
+}
+
+// Count returns the number of files with the given change.
+func (j *Journal) Count(change string) int {
+	n := 0
+	for _, e := range j.Files {
+		if e.Change == change {
+			n++
+		}
+	}
+	return n
+}
+
+// History returns the journals of the project in root, newest first.
+func History(root string) ([]*Journal, error) {
+	dir := filepath.Join(root, HistoryDir)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading history: %w", err)
+	}
+	var journals []*Journal
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		j, err := loadJournal(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		journals = append(journals, j)
+	}
+	sort.SliceStable(journals, func(a, b int) bool {
+		return journals[a].Time.After(journals[b].Time)
+	})
+	return journals, nil
+}
+
+func loadJournal(dir string) (*Journal, error) {
+	data, err := os.ReadFile(filepath.Join(dir, journalFileName))
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	var j Journal
+	if err := json.Unmarshal(data, &j); err != nil {
+		return nil, fmt.Errorf("invalid journal %s: %w", dir, err)
+	}
+	j.ID = filepath.Base(dir)
+	return &j, nil
+}
+
+func saveJournal(dir string, j *Journal) error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, journalFileName), data, 0644); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return nil
+}
+
+// Undo reverts the change set with the given ID, or the latest one not yet
+// undone when id is empty. It refuses, changing nothing, when a file was
+// edited, removed or recreated since the change set was applied. The revert
+// is a transaction like Apply, with one result per file; it is not
+// journaled itself. Directories created for new files are removed once the
+// files are deleted, unless something else was put into them since.
+func Undo(root, id string) (*Journal, *Report, error) {
+	j, err := findJournal(root, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if j.Undone != nil {
+		return j, nil, fmt.Errorf("change set %s was already undone on %s", j.ID, j.Undone.Format(time.DateTime))
+	}
+	if err := checkUnchanged(root, j); err != nil {
+		return j, nil, fmt.Errorf("cannot undo change set %s, files were changed since it was applied:\n%w", j.ID, err)
+	}
+
+	dir := filepath.Join(root, HistoryDir, j.ID)
+	report := &Report{Results: make([]Result, len(j.Files))}
+	tx := &transaction{root: root, report: report}
+	for i, e := range j.Files {
+		rel := filepath.Clean(filepath.FromSlash(e.Path))
+		c := &checked{result: Result{Path: e.Path, Target: filepath.Join(root, rel)}, mode: e.Mode}
+		c.mod.Path = e.Path
+		c.result.Err = validateRel(root, rel) // The journal is a plain file anyone could edit
+		switch e.Change {
+		case ChangeCreated:
+			c.result.Action = "delete"
+		case ChangeUpdated:
+			c.result.Action = "update"
+		case ChangeDeleted:
+			c.result.Action = "create"
+		default:
+			if c.result.Err == nil {
+				c.result.Err = fmt.Errorf("unknown change %q in journal", e.Change)
+			}
+		}
+		if c.result.Err == nil && c.result.Action != "create" {
+			c.info, c.result.Err = os.Lstat(c.result.Target)
+		}
+		if c.result.Err == nil && e.Link != "" {
+			c.link = e.Link
+			if e.Change != ChangeDeleted {
+				c.result.Err = fmt.Errorf("symbolic link recorded for a %s file in journal", e.Change)
+			} else {
+				c.result.Err = checkLinkDest(root, rel, e.Link)
+			}
+		}
+		if c.result.Err == nil && c.result.Action != "delete" && c.link == "" {
+			var original []byte
+			original, c.result.Err = os.ReadFile(filepath.Join(dir, originalsDir, filepath.FromSlash(e.Path)))
+			c.mod.Content = string(original)
+		}
+		if c.result.Err == nil {
+			c.result.Err = tx.stage(i, c)
+		}
+		report.Results[i] = finish(c.result, nil, StatusApplied)
+	}
+	tx.execute(false)
+	if report.Aborted {
+		return j, report, nil
+	}
+	removeCreatedDirs(root, j, report)
+
+	now := time.Now()
+	j.Undone = &now
+	if err := saveJournal(dir, j); err != nil {
+		return j, report, fmt.Errorf("change set %s was reverted, but could not be marked as undone: %w", j.ID, err)
+	}
+	return j, report, nil
+}
+
+// removeCreatedDirs removes the directories Apply created for the new files
+// of j, deepest first, and stops at the first one that is no longer empty or
+// no longer a directory. Other failures are noted on the result of the file.
+func removeCreatedDirs(root string, j *Journal, report *Report) {
+	for i := len(j.Files) - 1; i >= 0; i-- {
+		e := j.Files[i]
+		if e.Change != ChangeCreated {
+			continue
+		}
+		for k := len(e.Dirs) - 1; k >= 0; k-- {
+			rel := filepath.Clean(filepath.FromSlash(e.Dirs[k]))
+			if err := validateRel(root, rel); err != nil {
+				report.Results[i].Note = fmt.Sprintf("directory %s was not removed: %v", e.Dirs[k], err)
+				break
+			}
+			info, err := os.Lstat(filepath.Join(root, rel))
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err == nil && !info.IsDir() {
+				break // Replaced since
+			}
+			if err == nil {
+				err = os.Remove(filepath.Join(root, rel))
+			}
+			if os.IsExist(err) {
+				break // Not empty
+			}
+			if err != nil {
+				report.Results[i].Note = fmt.Sprintf("directory %s was not removed: %v", e.Dirs[k], err)
+				break
+			}
+		}
+	}
+}
+
+func findJournal(root, id string) (*Journal, error) {
+	if id != "" {
+		if filepath.Base(id) != id {
+			return nil, fmt.Errorf("invalid change set ID %q", id)
+		}
+		j, err := loadJournal(filepath.Join(root, HistoryDir, id))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no change set %q in the history", id)
+		}
+		return j, err
+	}
+	journals, err := History(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range journals {
+		if j.Undone == nil {
+			return j, nil
+		}
+	}
+	return nil, errors.New("no change set to undo")
+}
+
+// checkUnchanged returns the files of j that differ from what the change set
+// left behind.
+func checkUnchanged(root string, j *Journal) error {
+	var errs []error
+	for _, e := range j.Files {
+		target := filepath.Join(root, filepath.FromSlash(e.Path))
+		info, err := os.Lstat(target)
+		if e.Change == ChangeDeleted {
+			if err == nil {
+				errs = append(errs, fmt.Errorf("%s was created again", e.Path))
+			}
+			continue
+		}
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			errs = append(errs, fmt.Errorf("%s was replaced by a symbolic link", e.Path))
+			continue
+		}
+		data, err := os.ReadFile(target)
+		switch {
+		case os.IsNotExist(err):
+			errs = append(errs, fmt.Errorf("%s was removed", e.Path))
+		case err != nil:
+			errs = append(errs, err)
+		case contentSum(string(data)) != e.SHA256:
+			errs = append(errs, fmt.Errorf("%s was edited", e.Path))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func contentSum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// newJournalDir creates the directory of a new journal in root, named by the
+// current time.
+func newJournalDir(root string) (string, error) {
+	history := filepath.Join(root, HistoryDir)
+	if err := os.MkdirAll(history, 0755); err != nil {
+		return "", fmt.Errorf("creating history directory: %w", err)
+	}
+	base := time.Now().Format("20060102-150405")
+	id := base
+	for n := 2; ; n++ {
+		err := os.Mkdir(filepath.Join(history, id), 0755)
+		if err == nil {
+			return filepath.Join(history, id), nil
+		}
+		if !os.IsExist(err) {
+			return "", fmt.Errorf("creating journal directory: %w", err)
+		}
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+}
@@ -0,0 +1,196 @@
+package changeset
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"projectson/collector"
+	"projectson/config"
+	"regexp"
+	"strings"
+)
+
+// protectedDirs are directories below the root a response may never write
+// into: the repository and projectson's own state.
+var protectedDirs = []string{".git", collector.StateDirName, collector.CacheDirName}
+
+// resolve turns a path of a response into a clean path relative to root,
+// see RelativePath, and rejects it unless it stays inside root.
+func resolve(root, path string) (rel string, stripped bool, err error) {
+	if strings.TrimSpace(path) == "" {
+		return "", false, errors.New("path is empty")
+	}
+	if filepath.IsAbs(path) || filepath.VolumeName(path) != "" || strings.HasPrefix(filepath.ToSlash(path), "/") {
+		return "", false, errors.New("absolute paths are not allowed; use a path relative to the root")
+	}
+	rel, stripped = RelativePath(root, path)
+	rel = filepath.Clean(rel)
+	if err := validateRel(root, rel); err != nil {
+		return "", stripped, err
+	}
+	return rel, stripped, nil
+}
+
+// validateRel rejects a clean relative path that leaves root, directly or
+// through a symbolic link, or that points into a protected directory.
+func validateRel(root, rel string) error {
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) || filepath.IsAbs(rel) {
+		return errors.New("path leaves the project root")
+	}
+	if err := checkProtected(rel); err != nil {
+		return err
+	}
+	return checkSymlinks(root, rel)
+}
+
+func checkProtected(rel string) error {
+	for _, segment := range strings.Split(filepath.ToSlash(rel), "/") {
+		for _, dir := range protectedDirs {
+			// Case-insensitive file systems would take ".GIT" for ".git".
+			if strings.EqualFold(segment, dir) {
+				return fmt.Errorf("writing into %s is not allowed", dir)
+			}
+		}
+	}
+	return nil
+}
+
+// checkSymlinks follows the existing part of rel below root and rejects it
+// when a symbolic link on the way, or the file itself, leads outside root or
+// into a protected directory. The part that does not exist yet is created
+// as plain directories and files, so it cannot.
+func checkSymlinks(root, rel string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return fmt.Errorf("resolving the project root: %w", err)
+	}
+	current := absRoot
+	for _, segment := range strings.Split(rel, string(os.PathSeparator)) {
+		current = filepath.Join(current, segment)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		linkRel, _ := filepath.Rel(absRoot, current)
+		resolved, err := filepath.EvalSymlinks(current)
+		if err != nil {
+			return fmt.Errorf("cannot resolve symbolic link %s: %w", filepath.ToSlash(linkRel), err)
+		}
+		inside, err := filepath.Rel(realRoot, resolved)
+		if err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(os.PathSeparator)) {
+			return fmt.Errorf("path leaves the project root through the symbolic link %s", filepath.ToSlash(linkRel))
+		}
+		if err := checkProtected(inside); err != nil {
+			return fmt.Errorf("symbolic link %s: %w", filepath.ToSlash(linkRel), err)
+		}
+	}
+	return nil
+}
+
+// linkTarget returns the path relative to root of the file rel leads to when
+// it is a symbolic link, which validateRel checked to stay inside root; rel
+// otherwise.
+func linkTarget(root, rel string) (string, error) {
+	path := filepath.Join(root, rel)
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return rel, nil
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return "", fmt.Errorf("resolving the project root: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve symbolic link %s: %w", filepath.ToSlash(rel), err)
+	}
+	return filepath.Rel(realRoot, resolved)
+}
+
+// checkLinkDest rejects the target dest of a symbolic link to be created at
+// rel when it leads outside root or into a protected directory.
+func checkLinkDest(root, rel, dest string) error {
+	var destRel string
+	if filepath.IsAbs(dest) {
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return err
+		}
+		if destRel, err = filepath.Rel(absRoot, dest); err != nil {
+			return errors.New("symbolic link leads outside the project root")
+		}
+	} else {
+		destRel = filepath.Join(filepath.Dir(rel), dest)
+	}
+	if err := validateRel(root, filepath.Clean(destRel)); err != nil {
+		return fmt.Errorf("symbolic link to %s: %w", dest, err)
+	}
+	return nil
+}
+
+// Scope limits the files of the project a response may touch, on top of the
+// checks every path gets. A nil Scope admits every file below the root.
+type Scope struct {
+	collected *collector.CollectedSet // nil when no run recorded one
+	allow     []*regexp.Regexp
+}
+
+// NewScope returns the allowlist cfg configures: when Config.ApplyRestricted
+// is set, a response may only touch the files of the last run
+// (collector.LastCollected) and those matching Config.ApplyAllow. It returns
+// nil when it is not set.
+func NewScope(cfg *config.Config) (*Scope, error) {
+	if !cfg.ApplyRestricted() {
+		return nil, nil
+	}
+	s := &Scope{}
+	for _, pattern := range cfg.ApplyAllow {
+		re, err := collector.CompileGlob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("config error: 'apply_allow': %w", err)
+		}
+		s.allow = append(s.allow, re)
+	}
+	collected, err := collector.LastCollected(cfg.Root)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	s.collected = collected
+	return s, nil
+}
+
+// admits returns why rel, a clean path relative to the root, is outside the
+// scope; nil when it is inside.
+func (s *Scope) admits(rel string) error {
+	if s == nil {
+		return nil
+	}
+	slashed := filepath.ToSlash(rel)
+	if s.collected != nil && s.collected.Contains(slashed) {
+		return nil
+	}
+	for _, re := range s.allow {
+		if re.MatchString(slashed) {
+			return nil
+		}
+	}
+	if s.collected == nil {
+		return errors.New("not allowed: no run has recorded the collected files yet, and no apply_allow pattern matches")
+	}
+	return errors.New("not allowed: not collected by the last run, and no apply_allow pattern matches")
+}
@@ -0,0 +1,101 @@
+package changeset
+
+import (
+	"os"
+	"path/filepath"
+	"projectson/collector"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "proj")
+	writeFile(t, root, "src/main.go", "package main")
+	writeFile(t, base, "outside/secret.txt", "secret")
+	symlink(t, filepath.Join(base, "outside"), filepath.Join(root, "out"))
+	symlink(t, filepath.Join(base, "outside", "secret.txt"), filepath.Join(root, "secret.txt"))
+	symlink(t, filepath.Join(root, "src"), filepath.Join(root, "alias"))
+	symlink(t, filepath.Join(root, ".git"), filepath.Join(root, "repo"))
+	symlink(t, filepath.Join(root, "missing"), filepath.Join(root, "dangling"))
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path     string
+		rel      string // Slash-separated; empty when the path is rejected
+		stripped bool
+		err      string // Part of the error
+	}{
+		{path: "src/main.go", rel: "src/main.go"},
+		{path: "./src/../new.go", rel: "new.go"},
+		{path: "proj/src/main.go", rel: "src/main.go", stripped: true}, // Root basename prefix
+		{path: "alias/main.go", rel: "alias/main.go"},                  // Symbolic link inside the root
+		{path: "out/new/file.txt", err: "symbolic link out"},
+		{path: "secret.txt", err: "symbolic link secret.txt"},
+		{path: "repo/config", err: "writing into .git"},
+		{path: "dangling", err: "cannot resolve symbolic link dangling"},
+		{path: "../x", err: "leaves the project root"},
+		{path: "src/../../x", err: "leaves the project root"},
+		{path: "proj/../../x", err: "leaves the project root"},
+		{path: "..", err: "leaves the project root"},
+		{path: ".", err: "leaves the project root"},
+		{path: "/etc/passwd", err: "absolute paths"},
+		{path: "  ", err: "empty"},
+		{path: ".git/config", err: "writing into .git"},
+		{path: ".GIT/config", err: "writing into .git"},
+		{path: "src/.Git/hooks/pre-commit", err: "writing into .git"},
+		{path: collector.StateDirName + "/history/x", err: "writing into " + collector.StateDirName},
+		{path: collector.CacheDirName + "/x", err: "writing into " + collector.CacheDirName},
+	}
+	for _, tt := range tests {
+		rel, stripped, err := resolve(root, tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("resolve(%q) error = %v, want one containing %q", tt.path, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || filepath.ToSlash(rel) != tt.rel || stripped != tt.stripped {
+			t.Errorf("resolve(%q) = %q, %v, %v; want %q, %v", tt.path, rel, stripped, err, tt.rel, tt.stripped)
+		}
+	}
+}
+
+func TestScopeAdmits(t *testing.T) {
+	collected := &collector.CollectedSet{Files: []string{"README.md", "src/a.go", "src/b.go"}}
+	docs := regexp.MustCompile(`^docs/`)
+
+	tests := []struct {
+		name  string
+		scope *Scope
+		rel   string
+		err   string // Part of the error; empty when admitted
+	}{
+		{"nil scope", nil, "anything.go", ""},
+		{"collected", &Scope{collected: collected}, "src/a.go", ""},
+		{"not collected", &Scope{collected: collected}, "src/c.go", "not collected by the last run"},
+		{"allowed", &Scope{collected: collected, allow: []*regexp.Regexp{docs}}, "docs/new.md", ""},
+		{"neither", &Scope{collected: collected, allow: []*regexp.Regexp{docs}}, "src/c.go", "not collected by the last run"},
+		{"nothing recorded", &Scope{}, "src/a.go", "no run has recorded"},
+		{"nothing recorded, allowed", &Scope{allow: []*regexp.Regexp{docs}}, "docs/new.md", ""},
+		{"native separators", &Scope{collected: collected}, filepath.FromSlash("src/b.go"), ""},
+	}
+	for _, tt := range tests {
+		err := tt.scope.admits(tt.rel)
+		if tt.err == "" && err != nil {
+			t.Errorf("%s: admits(%q) = %v, want nil", tt.name, tt.rel, err)
+		} else if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+			t.Errorf("%s: admits(%q) = %v, want an error containing %q", tt.name, tt.rel, err, tt.err)
+		}
+	}
+}
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symbolic links not supported: %v", err)
+	}
+}
@@ -0,0 +1,306 @@
+package changeset
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"projectson/utils"
+	"time"
+)
+
+// transaction carries out the modifications of Apply so that they can be
+// undone. stage writes new contents to temporary files next to their targets;
+// writeJournal records the change set for Undo; commit moves each original
+// to a backup file and renames the new content into place; cleanup removes
+// the backups, rollback restores them.
+type transaction struct {
+	root       string
+	report     *Report
+	steps      []*step
+	dirs       []string // Directories created for new files, parents first
+	journalDir string   // Written by writeJournal; removed by rollback
+}
+
+// step is one modification of a transaction.
+type step struct {
+	index     int // Of the result in the report
+	target    string
+	staged    *utils.AtomicFile // New content; nil for a delete
+	perm      os.FileMode
+	sum       string   // SHA-256 of the new content
+	original  bool     // The target exists and is replaced or deleted
+	dirs      []string // Directories created for the target, parents first
+	link      string   // Symbolic link target: of the deleted original, or to create instead of a file
+	backup    string   // Where the original was moved to by commit
+	committed bool
+}
+
+// stage prepares modification i, which check accepted.
+func (tx *transaction) stage(i int, c *checked) error {
+	s := &step{index: i, target: c.result.Target, perm: 0644, original: c.info != nil}
+	if c.info != nil {
+		s.perm = c.info.Mode().Perm()
+	} else if c.mode != 0 {
+		s.perm = c.mode
+	}
+	if c.result.Action == "delete" {
+		if !s.original {
+			return nil
+		}
+		if c.info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(s.target)
+			if err != nil {
+				return fmt.Errorf("reading symbolic link: %w", err)
+			}
+			s.link = link
+		}
+		tx.steps = append(tx.steps, s)
+		return nil
+	}
+
+	dirs, err := tx.mkdirAll(filepath.Dir(s.target))
+	if err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+	s.dirs = dirs
+	if c.link != "" {
+		s.link = c.link
+		tx.steps = append(tx.steps, s)
+		return nil
+	}
+	staged, err := utils.CreateAtomicFile(s.target)
+	if err != nil {
+		return err
+	}
+	s.staged = staged
+	s.sum = contentSum(c.mod.Content)
+	tx.steps = append(tx.steps, s)
+	if _, err := staged.WriteString(c.mod.Content); err != nil {
+		return fmt.Errorf("writing temporary file: %w", err)
+	}
+	return nil
+}
+
+// mkdirAll creates dir and its missing parents, remembering them for
+// rollback, and returns the directories it created, parents first.
+func (tx *transaction) mkdirAll(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Lstat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	var created []string
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], 0755); err != nil {
+			return created, err
+		}
+		tx.dirs = append(tx.dirs, missing[i])
+		created = append(created, missing[i])
+	}
+	return created, nil
+}
+
+// execute finishes a transaction whose modifications were all staged or
+// failed: unless one failed, it writes the journal when journal is set and
+// commits the steps. Otherwise, or when that fails, it rolls back and marks
+// the report aborted.
+func (tx *transaction) execute(journal bool) {
+	r := tx.report
+	if r.Failed() == 0 {
+		if journal {
+			r.Err = tx.writeJournal()
+		}
+		if r.Err == nil && tx.commit() {
+			tx.cleanup()
+			return
+		}
+	}
+
+	r.Aborted = true
+	r.JournalID = ""
+	r.RollbackErr = tx.rollback()
+	for i := range r.Results {
+		if r.Results[i].Status != StatusFailed {
+			r.Results[i].Status = StatusNotApplied
+		}
+	}
+}
+
+// writeJournal records the steps in a new journal of the history, with a
+// copy of every original. Nothing is recorded when there are no steps.
+func (tx *transaction) writeJournal() error {
+	if len(tx.steps) == 0 {
+		return nil
+	}
+	dir, err := newJournalDir(tx.root)
+	if err != nil {
+		return err
+	}
+	tx.journalDir = dir
+	j := &Journal{ID: filepath.Base(dir), Time: time.Now()}
+	for _, s := range tx.steps {
+		rel, err := filepath.Rel(tx.root, s.target)
+		if err != nil {
+			return fmt.Errorf("recording %s: %w", s.target, err)
+		}
+		e := JournalEntry{Path: filepath.ToSlash(rel), Change: ChangeCreated, SHA256: s.sum}
+		for _, d := range s.dirs {
+			relDir, err := filepath.Rel(tx.root, d)
+			if err != nil {
+				return fmt.Errorf("recording %s: %w", d, err)
+			}
+			e.Dirs = append(e.Dirs, filepath.ToSlash(relDir))
+		}
+		if s.original {
+			e.Change, e.Mode = ChangeUpdated, s.perm
+			if s.staged == nil {
+				e.Change, e.SHA256 = ChangeDeleted, ""
+			}
+			if s.link != "" {
+				e.Mode, e.Link = 0, s.link
+				j.Files = append(j.Files, e)
+				continue
+			}
+			if err := copyOriginal(s.target, filepath.Join(dir, originalsDir, rel)); err != nil {
+				return err
+			}
+		}
+		j.Files = append(j.Files, e)
+	}
+	if err := saveJournal(dir, j); err != nil {
+		return err
+	}
+	tx.report.JournalID = j.ID
+	return nil
+}
+
+func copyOriginal(target, dest string) error {
+	data, err := os.ReadFile(target)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(dest), 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(dest, data, 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("recording original of %s: %w", target, err)
+	}
+	return nil
+}
+
+// commit carries out the staged steps in order. It stops at the first error,
+// which it records in the result of that step, and reports whether all
+// steps were committed.
+func (tx *transaction) commit() bool {
+	for _, s := range tx.steps {
+		if err := s.commit(); err != nil {
+			result := &tx.report.Results[s.index]
+			result.Err = err
+			result.Status = StatusFailed
+			return false
+		}
+	}
+	return true
+}
+
+func (s *step) commit() error {
+	if s.original {
+		backup, err := reserveBackup(s.target)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(s.target, backup); err != nil {
+			os.Remove(backup)
+			return fmt.Errorf("backing up original: %w", err)
+		}
+		s.backup = backup
+	}
+	switch {
+	case s.staged != nil:
+		if !s.original {
+			// Renaming would silently replace a file created since stage.
+			if _, err := os.Lstat(s.target); err == nil {
+				return errFileExists
+			}
+		}
+		if err := s.staged.Commit(s.perm); err != nil {
+			return err
+		}
+	case s.link != "" && !s.original:
+		if err := os.Symlink(s.link, s.target); err != nil {
+			if os.IsExist(err) {
+				return errFileExists
+			}
+			return fmt.Errorf("creating symbolic link: %w", err)
+		}
+	}
+	s.committed = true
+	return nil
+}
+
+// reserveBackup creates an empty file next to target for its original to be
+// renamed over.
+func reserveBackup(target string) (string, error) {
+	dir, base := filepath.Split(target)
+	f, err := os.CreateTemp(dir, "."+base+".orig-*")
+	if err != nil {
+		return "", fmt.Errorf("backing up original: %w", err)
+	}
+	f.Close()
+	return f.Name(), nil
+}
+
+// cleanup removes the backups of a committed transaction. A backup that
+// cannot be removed is noted on its result; the modification still stands.
+func (tx *transaction) cleanup() {
+	for _, s := range tx.steps {
+		if s.backup == "" {
+			continue
+		}
+		if err := os.Remove(s.backup); err != nil {
+			result := &tx.report.Results[s.index]
+			note := fmt.Sprintf("backup of the original left at %s: %v", s.backup, err)
+			if result.Note != "" {
+				note = result.Note + "; " + note
+			}
+			result.Note = note
+		}
+	}
+}
+
+// rollback undoes the steps in reverse order, discards the staged files and
+// removes the directories created for them. It returns the files it could
+// not restore.
+func (tx *transaction) rollback() error {
+	var errs []error
+	for i := len(tx.steps) - 1; i >= 0; i-- {
+		s := tx.steps[i]
+		switch {
+		case s.backup != "":
+			if err := os.Rename(s.backup, s.target); err != nil {
+				errs = append(errs, fmt.Errorf("restoring %s (original kept at %s): %w", s.target, s.backup, err))
+			}
+		case s.committed:
+			if err := os.Remove(s.target); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("removing created %s: %w", s.target, err))
+			}
+		}
+		if s.staged != nil {
+			s.staged.Abort()
+		}
+	}
+	if tx.journalDir != "" {
+		if err := os.RemoveAll(tx.journalDir); err != nil {
+			errs = append(errs, fmt.Errorf("removing journal: %w", err))
+		}
+	}
+	for i := len(tx.dirs) - 1; i >= 0; i-- {
+		if err := os.Remove(tx.dirs[i]); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("removing created directory %s: %w", tx.dirs[i], err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,156 @@
+package changeset
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"projectson/collector"
+	"strings"
+	"testing"
+)
+
+// TestRollbackAfterFailedCommit stages a change set, then creates the target
+// of its last "create" before commit, so that commit fails after the earlier
+// steps were carried out. Rollback must leave the project as it was.
+func TestRollbackAfterFailedCommit(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "a.txt", "old a")
+	writeFile(t, root, "gone.txt", "old gone")
+
+	mods := []collector.AIFileModification{
+		{Path: "a.txt", Action: "update", Content: "new a"},
+		{Path: "gone.txt", Action: "delete"},
+		{Path: "new/dir/b.txt", Action: "create", Content: "b"},
+		{Path: "c.txt", Action: "create", Content: "c"},
+	}
+	report := &Report{Results: make([]Result, len(mods))}
+	tx := &transaction{root: root, report: report}
+	seen := map[string]bool{}
+	for i, mod := range mods {
+		c := check(root, mod, nil, seen)
+		if c.result.Err == nil {
+			c.result.Err = tx.stage(i, c)
+		}
+		report.Results[i] = finish(c.result, c.notes, StatusApplied)
+		if c.result.Err != nil {
+			t.Fatalf("staging %s: %v", mod.Path, c.result.Err)
+		}
+	}
+	writeFile(t, root, "c.txt", "intruder")
+	tx.execute(true)
+
+	if !report.Aborted || report.RollbackErr != nil || report.JournalID != "" {
+		t.Fatalf("Aborted = %v, RollbackErr = %v, JournalID = %q; want an aborted, complete rollback", report.Aborted, report.RollbackErr, report.JournalID)
+	}
+	wantStatus := []Status{StatusNotApplied, StatusNotApplied, StatusNotApplied, StatusFailed}
+	for i, r := range report.Results {
+		if r.Status != wantStatus[i] {
+			t.Errorf("%s: status %q, want %q", r.Path, r.Status, wantStatus[i])
+		}
+	}
+	if err := report.Results[3].Err; !errors.Is(err, errFileExists) {
+		t.Errorf("c.txt: error %v, want %v", err, errFileExists)
+	}
+
+	for path, want := range map[string]string{"a.txt": "old a", "gone.txt": "old gone", "c.txt": "intruder"} {
+		if data, err := os.ReadFile(filepath.Join(root, path)); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", path, data, err, want)
+		}
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		switch e.Name() {
+		case "a.txt", "gone.txt", "c.txt":
+		case collector.StateDirName:
+			if journals, _ := History(root); len(journals) != 0 {
+				t.Errorf("history has %d journals, want none", len(journals))
+			}
+		default:
+			t.Errorf("%s left behind", e.Name())
+		}
+	}
+}
+
+// TestApplySymlink updates a file through a symbolic link inside the root,
+// then deletes the link, undoing each: the link must stay a link and the
+// file it points to keep its permissions.
+func TestApplySymlink(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "real.go", "old")
+	if err := os.Chmod(filepath.Join(root, "real.go"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, root, "src/a.go", "a")
+	symlink(t, "real.go", filepath.Join(root, "link.go"))
+	symlink(t, "src", filepath.Join(root, "dir"))
+
+	report := Apply(root, &collector.AIResponse{ModifiedFiles: []collector.AIFileModification{
+		{Path: "dir", Action: "update", Content: "x"},
+	}}, nil)
+	if r := report.Results[0]; r.Err == nil || !strings.Contains(r.Err.Error(), "directory") {
+		t.Errorf("update of a link to a directory: error %v, want one about a directory", r.Err)
+	}
+
+	report = Apply(root, &collector.AIResponse{ModifiedFiles: []collector.AIFileModification{
+		{Path: "link.go", Action: "update", Content: "new"},
+	}}, nil)
+	if r := report.Results[0]; r.Status != StatusApplied {
+		t.Fatalf("update through link: %s, %v", r.Status, r.Err)
+	}
+	checkLink(t, root, "link.go", "real.go")
+	checkFile(t, root, "real.go", "new", 0640)
+	if _, _, err := Undo(root, report.JournalID); err != nil {
+		t.Fatalf("undoing update: %v", err)
+	}
+	checkLink(t, root, "link.go", "real.go")
+	checkFile(t, root, "real.go", "old", 0640)
+
+	report = Apply(root, &collector.AIResponse{ModifiedFiles: []collector.AIFileModification{
+		{Path: "link.go", Action: "delete"},
+	}}, nil)
+	if r := report.Results[0]; r.Status != StatusApplied {
+		t.Fatalf("delete of link: %s, %v", r.Status, r.Err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "link.go")); !os.IsNotExist(err) {
+		t.Errorf("link.go still exists after delete: %v", err)
+	}
+	checkFile(t, root, "real.go", "old", 0640)
+	if _, _, err := Undo(root, report.JournalID); err != nil {
+		t.Fatalf("undoing delete: %v", err)
+	}
+	checkLink(t, root, "link.go", "real.go")
+}
+
+func checkLink(t *testing.T, root, rel, want string) {
+	t.Helper()
+	if got, err := os.Readlink(filepath.Join(root, rel)); err != nil || got != want {
+		t.Errorf("%s links to %q, %v; want %q", rel, got, err, want)
+	}
+}
+
+func checkFile(t *testing.T, root, rel, content string, perm os.FileMode) {
+	t.Helper()
+	path := filepath.Join(root, rel)
+	info, err := os.Lstat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != content || info.Mode() != perm {
+		t.Errorf("%s = %q (%v), %v; want %q (%v)", rel, data, info.Mode(), err, content, perm)
+	}
+}
+
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"projectson/changeset"
 	"projectson/collector"
 	"projectson/config"
 	"projectson/utils"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -19,11 +30,30 @@ var (
 	includes        []string
 	excludePatterns []string
 	forceApply      bool
+	gitignore       bool
+	maxTokens       int
+	maxOutputBytes  int64
+	budgetAction    string
+	outputOrder     string
+	outputFormat    string
+	withMeta        bool
+	chunkMaxTokens  int
+	chunkMaxBytes   int64
+	useCache        bool
+	watchDebounce   time.Duration
+	timeout         time.Duration
+	logFormat       string
+	strict          bool
+	onError         string
+	applyInput      string
+	applyDryRun     bool
+	applyAllowlist  bool
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "projectson-cli",
-	Short: "ProjectSon CLI aggregates project files into a structured JSON output.",
+	Use:     "projectson-cli",
+	Version: collector.Version,
+	Short:   "ProjectSon CLI aggregates project files into a structured JSON output.",
 	Long: `ProjectSon CLI is a command-line tool to scan project directories,
 collect specified file types.`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
@@ -95,6 +125,9 @@ var previewCmd = &cobra.Command{
 	Use:   "preview",
 	Short: "Preview files that will be collected",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkLogFormat(); err != nil {
+			return err
+		}
 		cfg, err := loadConfigWithOverrides(cmd)
 		if err != nil {
 			return err
@@ -108,15 +141,22 @@ var previewCmd = &cobra.Command{
 			return fmt.Errorf("failed to initialize collector: %w", err)
 		}
 
+		ctx, stop := commandContext()
+		defer stop()
+
 		fmt.Println("Scanning for files to preview...")
-		entries, err := fc.PreviewFiles()
+		entries, diags, err := fc.PreviewFiles(ctx)
+		printDiagnostics(diags)
 		if err != nil {
+			if ctx.Err() != nil {
+				return interruptedError(ctx, "preview")
+			}
 			return fmt.Errorf("error during file preview: %w", err)
 		}
 
 		if len(entries) == 0 {
 			fmt.Println("No files found matching the criteria.")
-			return nil
+			return strictError(diags)
 		}
 
 		fmt.Printf("Found %d files:\n", len(entries))
@@ -127,7 +167,8 @@ var previewCmd = &cobra.Command{
 			fmt.Printf("  Format: %s, Mode: %s, Size: %s\n", entry.Format, entry.Mode, utils.FormatSize(entry.Size))
 		}
 		fmt.Println("--------------------------------------------------")
-		return nil
+		cmd.SilenceUsage = true
+		return strictError(diags)
 	},
 }
 
@@ -135,18 +176,10 @@ var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "run collection process",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := loadConfigWithOverrides(cmd)
+		cfg, fc, err := newRunCollector(cmd)
 		if err != nil {
 			return err
 		}
-		if err := cfg.Validate(); err != nil {
-			return fmt.Errorf("configuration error: %w. Run 'validate' command for details", err)
-		}
-
-		fc, err := collector.NewFileCollector(cfg)
-		if err != nil {
-			return fmt.Errorf("failed to initialize collector: %w", err)
-		}
 
 		fmt.Println("Starting file collection process")
 
@@ -156,25 +189,458 @@ var runCmd = &cobra.Command{
 				fmt.Println()
 			}
 		}
-		if cfg.Output == "" {
-			cfg.Output = "output.json"
-		}
 
-		count, sizeStr, err := fc.Run(progressCallback)
+		ctx, stop := commandContext()
+		defer stop()
+
+		result, err := fc.Run(ctx, progressCallback)
+		printDiagnostics(result.Diagnostics)
 		if err != nil {
+			if ctx.Err() != nil {
+				fmt.Println()
+				return fmt.Errorf("%w, output left unchanged", interruptedError(ctx, "collection"))
+			}
 			return fmt.Errorf("error during file collection: %w", err)
 		}
 
 		fmt.Printf("\ncollection completed\n")
 		fmt.Printf("--------------------------------------------------\n")
-		fmt.Printf("files processed: %d\n", count)
-		fmt.Printf("output size: %s\n", sizeStr)
-		fmt.Printf("output written to: %s\n", cfg.Output)
+		fmt.Printf("files processed: %d\n", result.FileCount)
+		fmt.Printf("output size: %s\n", result.OutputSize)
+		fmt.Printf("tokens (%s): %d\n", result.Tokenizer, result.TotalTokens)
+		if cfg.Cache {
+			fmt.Printf("cache: %d hits, %d misses (%s)\n", result.CacheHits, result.CacheMisses, collector.CacheDir(cfg))
+		}
+		if cfg.MaxTokens > 0 {
+			fmt.Printf("token budget: %d (%s)\n", cfg.MaxTokens, budgetUsage(float64(result.TotalTokens), float64(cfg.MaxTokens)))
+		}
+		printTopFilesByTokens(result.FileTokens, 10)
+		if cfg.MaxOutputBytes > 0 {
+			fmt.Printf("byte budget: %d (%s)\n", cfg.MaxOutputBytes, budgetUsage(float64(result.OutputBytes), float64(cfg.MaxOutputBytes)))
+		}
+		printDegradedFiles(result.Degraded)
+		if result.Skipped > 0 {
+			fmt.Printf("skipped, could not be processed: %d files\n", result.Skipped)
+		}
+		if result.Placeholders > 0 {
+			fmt.Printf("written as placeholders, could not be processed: %d files\n", result.Placeholders)
+		}
+		if len(result.Parts) > 0 {
+			fmt.Printf("output split into %d parts, listed in: %s\n", len(result.Parts), result.IndexFile)
+		} else if cfg.OutputTemplate != "" {
+			fmt.Printf("output written to: %s (template %s)\n", cfg.Output, cfg.OutputTemplate)
+		} else {
+			fmt.Printf("output written to: %s (%s)\n", cfg.Output, cfg.EffectiveOutputFormat())
+		}
 		fmt.Println("--------------------------------------------------")
+
+		cmd.SilenceUsage = true // The output was written; what follows is not about usage
+		if failed := result.Skipped + result.Placeholders; failed > 0 {
+			return &exitCodeError{
+				code: exitFilesFailed,
+				err:  fmt.Errorf("%d file(s) could not be processed", failed),
+			}
+		}
+		return strictError(result.Diagnostics)
+	},
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "run collection, then again whenever collected files change",
+	Long: `runs the collection once, then watches every directory the run reads
+(respecting excludes and gitignore rules) and runs it again whenever a file
+changes, rewriting the output. Changes are debounced. Stop with Ctrl-C.
+Accepts the same flags as run.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, fc, err := newRunCollector(cmd)
+		if err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		fmt.Println("Watching for changes, press Ctrl-C to stop")
+		err = fc.Watch(ctx, watchDebounce, func() {
+			startTime := time.Now()
+			runCtx, cancel := withTimeout(ctx)
+			defer cancel()
+			result, err := fc.Run(runCtx, nil)
+			stamp := time.Now().Format("15:04:05")
+			if ctx.Err() != nil {
+				return // Stopped during the run
+			}
+			printDiagnostics(result.Diagnostics)
+			if runCtx.Err() != nil {
+				fmt.Printf("[%s] %v, output left unchanged\n", stamp, interruptedError(runCtx, "collection"))
+				return
+			}
+			if err != nil {
+				fmt.Printf("[%s] collection failed: %v\n", stamp, err)
+				return
+			}
+			line := fmt.Sprintf("[%s] %d files, %s, %d tokens in %.2fs", stamp, result.FileCount, result.OutputSize, result.TotalTokens, time.Since(startTime).Seconds())
+			if cfg.Cache {
+				line += fmt.Sprintf(", cache %d hits, %d misses", result.CacheHits, result.CacheMisses)
+			}
+			if len(result.Degraded) > 0 {
+				line += fmt.Sprintf(", %d degraded to fit budget", len(result.Degraded))
+			}
+			if result.Skipped > 0 {
+				line += fmt.Sprintf(", %d skipped", result.Skipped)
+			}
+			if result.Placeholders > 0 {
+				line += fmt.Sprintf(", %d placeholders", result.Placeholders)
+			}
+			if len(result.Parts) > 0 {
+				line += fmt.Sprintf(", %d parts listed in %s", len(result.Parts), result.IndexFile)
+			} else {
+				line += " -> " + cfg.Output
+			}
+			fmt.Println(line)
+		}, func(d collector.Diagnostic) {
+			printDiagnostics([]collector.Diagnostic{d})
+		})
+		if err != nil {
+			return fmt.Errorf("error while watching: %w", err)
+		}
+		fmt.Println("Stopped watching")
+		return nil
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "apply file modifications from an AI response",
+	Long: `reads an AI response of the form {"modified_files": [{"path": ..., "action": ..., "content": ...}]}
+from --input or stdin and creates, updates or deletes the files below the
+project root. Paths start with the basename of the root, as in the output.
+The modifications are applied as one transaction: if any fails, every file
+already touched is restored and nothing changes. Prints the result of every
+modification and exits with an error if any failed.
+With --dry-run no file is changed: it prints a unified diff of every
+modification and the ones that would fail instead.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, root, err := loadApplyConfig(cmd)
+		if err != nil {
+			return err
+		}
+		scope, err := changeset.NewScope(cfg)
+		if err != nil {
+			return err
+		}
+
+		data, err := readApplyInput()
+		if err != nil {
+			return err
+		}
+		resp, err := changeset.Parse(data)
+		if err != nil {
+			return err
+		}
+		if len(resp.ModifiedFiles) == 0 {
+			fmt.Println("AI response contained no files to modify.")
+			return nil
+		}
+
+		if applyDryRun {
+			report := changeset.DryRun(root, resp, scope)
+			for _, r := range report.Results {
+				fmt.Print(r.Diff)
+			}
+			printApplyReport(report, true)
+			cmd.SilenceUsage = true
+			if failed := report.Failed(); failed > 0 {
+				return fmt.Errorf("%d of %d modifications would fail", failed, len(report.Results))
+			}
+			return nil
+		}
+
+		report := changeset.Apply(root, resp, scope)
+		printApplyReport(report, false)
+		cmd.SilenceUsage = true // Files were touched; a failure is not about usage
+		if err := abortedError(report); err != nil {
+			return err
+		}
+		if report.JournalID != "" {
+			fmt.Printf("recorded as change set %s; revert it with: projectson-cli undo %s\n", report.JournalID, report.JournalID)
+		}
 		return nil
 	},
 }
 
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "list the change sets applied to the project",
+	Long: `lists the change sets applied by apply or the GUI, newest first, from the
+journals in ` + changeset.HistoryDir + ` below the project root.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, root, err := loadApplyConfig(cmd)
+		if err != nil {
+			return err
+		}
+		journals, err := changeset.History(root)
+		if err != nil {
+			return err
+		}
+		if len(journals) == 0 {
+			fmt.Println("No change sets applied yet.")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tAPPLIED\tCREATED\tUPDATED\tDELETED\tSTATUS")
+		for _, j := range journals {
+			status := "applied"
+			if j.Undone != nil {
+				status = "undone " + j.Undone.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\n", j.ID, j.Time.Format(time.DateTime),
+				j.Count(changeset.ChangeCreated), j.Count(changeset.ChangeUpdated), j.Count(changeset.ChangeDeleted), status)
+		}
+		return w.Flush()
+	},
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo [id]",
+	Short: "revert a change set applied to the project",
+	Long: `reverts the change set with the given ID (see history), or the latest one
+not yet undone: created files are deleted, and updated and deleted files get
+their original content back. Refuses, changing nothing, when any of the files
+was edited since the change set was applied.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, root, err := loadApplyConfig(cmd)
+		if err != nil {
+			return err
+		}
+		id := ""
+		if len(args) == 1 {
+			id = args[0]
+		}
+		cmd.SilenceUsage = true
+		journal, report, err := changeset.Undo(root, id)
+		if report != nil {
+			printApplyReport(report, false)
+		}
+		if err != nil {
+			return err
+		}
+		if err := abortedError(report); err != nil {
+			return err
+		}
+		fmt.Printf("undid change set %s\n", journal.ID)
+		return nil
+	},
+}
+
+// loadApplyConfig loads the config of apply, history and undo and returns it
+// with its root made absolute. Only the settings these commands use are
+// validated, so they work without formats or an output path.
+func loadApplyConfig(cmd *cobra.Command) (*config.Config, string, error) {
+	cfg, err := loadConfigWithOverrides(cmd)
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := filepath.Abs(cfg.Root)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid root path: %w", err)
+	}
+	cfg.Root = root
+	if err := cfg.ValidateApply(); err != nil {
+		return nil, "", fmt.Errorf("configuration error: %w. Run 'validate' command for details", err)
+	}
+	return cfg, root, nil
+}
+
+// abortedError describes a transaction that was rolled back; nil when the
+// report was not aborted.
+func abortedError(report *changeset.Report) error {
+	switch {
+	case !report.Aborted:
+		return nil
+	case report.RollbackErr != nil && report.Err != nil:
+		return fmt.Errorf("%w, and the rollback is incomplete, check these files:\n%w", report.Err, report.RollbackErr)
+	case report.RollbackErr != nil:
+		return fmt.Errorf("%d of %d modifications failed and the rollback is incomplete, check these files:\n%w", report.Failed(), len(report.Results), report.RollbackErr)
+	case report.Err != nil:
+		return fmt.Errorf("%w; nothing changed", report.Err)
+	default:
+		return fmt.Errorf("%d of %d modifications failed; nothing changed", report.Failed(), len(report.Results))
+	}
+}
+
+// readApplyInput reads the response for apply from --input, or from stdin
+// when it is empty or "-".
+func readApplyInput() ([]byte, error) {
+	if applyInput == "" || applyInput == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("reading AI response from stdin: %w", err)
+		}
+		return data, nil
+	}
+	data, err := os.ReadFile(applyInput)
+	if err != nil {
+		return nil, fmt.Errorf("reading AI response: %w", err)
+	}
+	return data, nil
+}
+
+// printApplyReport prints one row per modification and a summary line.
+func printApplyReport(report *changeset.Report, dryRun bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tACTION\tPATH\tDETAIL")
+	for _, r := range report.Results {
+		detail := r.Note
+		if r.Err != nil {
+			detail = r.Err.Error()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Status, r.Action, r.Path, detail)
+	}
+	w.Flush()
+	if dryRun {
+		fmt.Printf("dry run: %d of %d modifications would be applied, no file was changed\n", report.Ready(), len(report.Results))
+		return
+	}
+	switch {
+	case report.Aborted && report.RollbackErr != nil:
+		fmt.Println("transaction aborted: the rollback is incomplete, some files were not restored")
+		return
+	case report.Aborted:
+		fmt.Println("transaction aborted: all modifications were rolled back, nothing changed")
+		return
+	}
+	fmt.Printf("applied %d of %d modifications\n", report.Applied(), len(report.Results))
+}
+
+// commandContext returns the context of a command: it is cancelled by
+// Ctrl-C or SIGTERM and, with --timeout, when the timeout expires. After the
+// first signal the default handling is restored, so a second Ctrl-C ends the
+// process right away.
+func commandContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	timed, cancel := withTimeout(ctx)
+	return timed, func() {
+		cancel()
+		stop()
+	}
+}
+
+// withTimeout applies --timeout to ctx.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// interruptedError describes why ctx stopped an operation.
+func interruptedError(ctx context.Context, operation string) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out after %s", operation, timeout)
+	}
+	return fmt.Errorf("%s interrupted", operation)
+}
+
+// checkLogFormat validates --log-format.
+func checkLogFormat() error {
+	if logFormat != "text" && logFormat != "json" {
+		return fmt.Errorf("invalid --log-format %q: must be text or json", logFormat)
+	}
+	return nil
+}
+
+// printDiagnostics writes diagnostics to stderr, one per line: as text, or
+// as JSON objects with --log-format json.
+func printDiagnostics(diags []collector.Diagnostic) {
+	for _, d := range diags {
+		if logFormat == "json" {
+			data, err := json.Marshal(d)
+			if err == nil {
+				fmt.Fprintln(os.Stderr, string(data))
+				continue
+			}
+		}
+		fmt.Fprintln(os.Stderr, d.String())
+	}
+}
+
+// strictError fails the command with --strict when there are diagnostics.
+func strictError(diags []collector.Diagnostic) error {
+	if !strict || len(diags) == 0 {
+		return nil
+	}
+	warnings, errs := 0, 0
+	for _, d := range diags {
+		if d.Severity == collector.SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	return fmt.Errorf("--strict: %d warning(s) and %d error(s) reported", warnings, errs)
+}
+
+// newRunCollector loads and validates the config of the run and watch
+// commands and creates the collector.
+func newRunCollector(cmd *cobra.Command) (*config.Config, *collector.FileCollector, error) {
+	if err := checkLogFormat(); err != nil {
+		return nil, nil, err
+	}
+	cfg, err := loadConfigWithOverrides(cmd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("configuration error: %w. Run 'validate' command for details", err)
+	}
+
+	fc, err := collector.NewFileCollector(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize collector: %w", err)
+	}
+	if cfg.Output == "" {
+		cfg.Output = "output.json"
+	}
+	return cfg, fc, nil
+}
+
+func budgetUsage(used, budget float64) string {
+	return fmt.Sprintf("%.1f%% used", used*100/budget)
+}
+
+// printDegradedFiles lists files changed or dropped to fit the output budget.
+func printDegradedFiles(degraded []collector.Degradation) {
+	if len(degraded) == 0 {
+		return
+	}
+	fmt.Printf("degraded to fit budget: %d files\n", len(degraded))
+	for _, d := range degraded {
+		fmt.Printf("  %-9s %s (%s)\n", d.Action, d.Path, d.Reason)
+	}
+}
+
+// printTopFilesByTokens lists the n entries with the most tokens.
+func printTopFilesByTokens(files []collector.FileTokens, n int) {
+	if len(files) == 0 {
+		return
+	}
+	sorted := append([]collector.FileTokens(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Tokens > sorted[j].Tokens })
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	fmt.Println("largest files by tokens:")
+	for _, f := range sorted {
+		fmt.Printf("  %8d  %s\n", f.Tokens, f.Path)
+	}
+}
+
 func loadConfigWithOverrides(cmd *cobra.Command) (*config.Config, error) {
 	var cfg *config.Config
 	var err error
@@ -225,6 +691,47 @@ func loadConfigWithOverrides(cmd *cobra.Command) (*config.Config, error) {
 	if cmd.Flags().Changed("exclude") && len(excludePatterns) > 0 {
 		cfg.ExcludePatterns = excludePatterns
 	}
+	if cmd.Flags().Changed("respect-gitignore") {
+		cfg.RespectGitignore = gitignore
+	}
+	if cmd.Flags().Changed("max-tokens") {
+		cfg.MaxTokens = maxTokens
+	}
+	if cmd.Flags().Changed("max-output-bytes") {
+		cfg.MaxOutputBytes = maxOutputBytes
+	}
+	if cmd.Flags().Changed("budget-action") {
+		cfg.BudgetAction = budgetAction
+	}
+	if cmd.Flags().Changed("order") {
+		cfg.Order = outputOrder
+	}
+	if cmd.Flags().Changed("format") {
+		cfg.OutputFormat = outputFormat
+	}
+	if cmd.Flags().Changed("meta") {
+		cfg.Meta = withMeta
+	}
+	if cmd.Flags().Changed("chunk-max-tokens") {
+		cfg.Chunking.MaxTokens = chunkMaxTokens
+		cfg.Chunking.Enabled = chunkMaxTokens > 0 || cfg.Chunking.MaxBytes > 0
+	}
+	if cmd.Flags().Changed("chunk-max-bytes") {
+		cfg.Chunking.MaxBytes = chunkMaxBytes
+		cfg.Chunking.Enabled = chunkMaxBytes > 0 || cfg.Chunking.MaxTokens > 0
+	}
+	if cmd.Flags().Changed("cache") {
+		cfg.Cache = useCache
+	}
+	if cmd.Flags().Changed("on-error") {
+		cfg.OnError = onError
+	}
+	if cmd.Flags().Changed("allowlist") {
+		cfg.ApplyAllowlist = applyAllowlist
+		if !applyAllowlist {
+			cfg.ApplyAllow = nil // apply_allow alone would keep the allowlist on
+		}
+	}
 
 	if cfg.Output != "" {
 		outputDir := filepath.Dir(cfg.Output)
@@ -241,9 +748,27 @@ func loadConfigWithOverrides(cmd *cobra.Command) (*config.Config, error) {
 	return cfg, nil
 }
 
+// exitFilesFailed is the exit status of a run that wrote its output but
+// could not process some files.
+const exitFilesFailed = 2
+
+// exitCodeError ends the CLI with an exit status other than 1.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+
+func (e *exitCodeError) Unwrap() error { return e.err }
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -251,10 +776,10 @@ func Execute() {
 func init() {
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "Config file (default is projectson_config.yaml in current dir)")
 
-	overrideFlags := []*cobra.Command{runCmd, previewCmd, validateConfigCmd, initConfigCmd}
+	overrideFlags := []*cobra.Command{runCmd, watchCmd, previewCmd, validateConfigCmd, initConfigCmd}
 	for _, cmd := range overrideFlags {
 		cmd.Flags().StringVarP(&projectRoot, "root", "r", "", "Project root directory (overrides config)")
-		cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output JSON file path (overrides config)")
+		cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Output file path (overrides config)")
 		cmd.Flags().StringSliceVarP(&formats, "formats", "f", []string{}, "File formats/extensions, comma-separated (e.g., go,vue,ts) (overrides config)")
 
 		if cmd == initConfigCmd {
@@ -262,15 +787,47 @@ func init() {
 		}
 		if cmd != initConfigCmd {
 			cmd.Flags().StringSliceVarP(&excludePatterns, "exclude", "e", []string{}, "Exclude patterns, comma-separated (e.g., node_modules,*.log) (overrides config)")
+			cmd.Flags().BoolVar(&gitignore, "respect-gitignore", false, "Skip files ignored by .gitignore, .git/info/exclude and the global ignore file (overrides config)")
+			cmd.Flags().StringVar(&outputOrder, "order", "", "Output order of files: path or include (overrides config)")
 		}
 	}
 
 	initConfigCmd.Flags().BoolVar(&forceApply, "force", false, "force overwrite if config file already exists")
+	for _, cmd := range []*cobra.Command{runCmd, watchCmd} {
+		cmd.Flags().IntVar(&maxTokens, "max-tokens", 0, "Token budget for the output, 0 disables it (overrides config)")
+		cmd.Flags().Int64Var(&maxOutputBytes, "max-output-bytes", 0, "Byte budget for the output file, 0 disables it (overrides config)")
+		cmd.Flags().StringVar(&budgetAction, "budget-action", "", "What to do when a budget is exceeded: trim (default), prune or fail (overrides config)")
+		cmd.Flags().StringVar(&outputFormat, "format", "", "Output format: "+strings.Join(config.OutputFormats, ", ")+"; inferred from the output extension when unset (overrides config)")
+		cmd.Flags().BoolVar(&withMeta, "meta", false, "Add a meta object with the version, config hash, totals and git state (overrides config)")
+		cmd.Flags().IntVar(&chunkMaxTokens, "chunk-max-tokens", 0, "Split the output into part files of at most this many tokens, 0 disables it (overrides config)")
+		cmd.Flags().Int64Var(&chunkMaxBytes, "chunk-max-bytes", 0, "Split the output into part files of at most this many bytes, 0 disables it (overrides config)")
+		cmd.Flags().BoolVar(&useCache, "cache", false, "Reuse processed files from the cache directory across runs; --cache=false disables it (overrides config)")
+		cmd.Flags().StringVar(&onError, "on-error", "", "What to do with files that cannot be processed: skip, fail or placeholder (overrides config)")
+	}
+	for _, cmd := range []*cobra.Command{runCmd, watchCmd, previewCmd} {
+		cmd.Flags().DurationVar(&timeout, "timeout", 0, "Stop after this long, e.g. 30s or 2m; in watch mode it limits each run (0 = no limit)")
+		cmd.Flags().StringVar(&logFormat, "log-format", "text", "Format of the warnings and errors written to stderr: text or json (one object per line)")
+	}
+	for _, cmd := range []*cobra.Command{runCmd, previewCmd} {
+		cmd.Flags().BoolVar(&strict, "strict", false, "Exit with an error when any warning or error is reported")
+	}
+	for _, cmd := range []*cobra.Command{applyCmd, historyCmd, undoCmd} {
+		cmd.Flags().StringVarP(&projectRoot, "root", "r", "", "Project root directory (overrides config)")
+	}
+	applyCmd.Flags().StringVarP(&applyInput, "input", "i", "", "File with the AI response; stdin when empty or \"-\"")
+	applyCmd.Flags().BoolVar(&applyAllowlist, "allowlist", false, "Only let the response touch files collected by the last run or matching apply_allow; --allowlist=false turns it off, apply_allow included (overrides config)")
+	runCmd.Flags().BoolVar(&applyAllowlist, "allowlist", false, "Record the collected files for apply --allowlist; --allowlist=false stops recording, apply_allow included (overrides config)")
+	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Print a unified diff of every modification and the ones that would fail, without changing any file")
+	watchCmd.Flags().DurationVar(&watchDebounce, "debounce", collector.DefaultDebounce, "Time without changes to wait for before running again")
 
 	rootCmd.AddCommand(initConfigCmd)
 	rootCmd.AddCommand(validateConfigCmd)
 	rootCmd.AddCommand(previewCmd)
 	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(undoCmd)
 }
 
 func main() {
@@ -28,6 +28,7 @@ type AppState struct {
 	configDocsPageMaker func() fyne.CanvasObject // New field for config docs page
 	previewPageMaker    func() fyne.CanvasObject
 	runPageMaker        func() fyne.CanvasObject
+	applyPageMaker      func() fyne.CanvasObject
 	statsPageMaker      func() fyne.CanvasObject
 }
 
@@ -68,6 +69,9 @@ func main() {
 			appState.refreshStatsPagePostRun()
 		})
 	}
+	appState.applyPageMaker = func() fyne.CanvasObject {
+		return ui.MakeApplyChangesPage(appState.collectorService, myWindow, appState.statusBar)
+	}
 	appState.statsPageMaker = func() fyne.CanvasObject {
 		return ui.MakeStatsPage(appState.collectorService)
 	}
@@ -95,6 +99,7 @@ func main() {
 		container.NewTabItemWithIcon("Config Docs", theme.HelpIcon(), appState.configDocsPageMaker()), // New tab item
 		container.NewTabItemWithIcon("Preview", theme.SearchIcon(), appState.previewPageMaker()),
 		container.NewTabItemWithIcon("Run", theme.MediaPlayIcon(), appState.runPageMaker()),
+		container.NewTabItemWithIcon("Apply", theme.DocumentCreateIcon(), appState.applyPageMaker()),
 		container.NewTabItemWithIcon("Stats", theme.ListIcon(), appState.statsPageMaker()),
 	)
 	appState.tabs.SetTabLocation(container.TabLocationLeading)
@@ -120,14 +125,15 @@ func (s *AppState) fullUIUpdateOnConfigChange() {
 	// but primarily, pages are rebuilt using the latest config from the service.
 	// s.collectorService.UpdateConfig(s.collectorService.GetConfig()) // Redundant if called by pages
 
-	tabItemsCount := 6 // Updated count (Config, Exclusions, Config Docs, Preview, Run, Stats)
+	tabItemsCount := 7 // Config, Exclusions, Config Docs, Preview, Run, Apply, Stats
 	if s.tabs != nil && len(s.tabs.Items) == tabItemsCount {
 		s.tabs.Items[0].Content = s.configPageMaker()
 		s.tabs.Items[1].Content = s.exclusionsPageMaker()
 		s.tabs.Items[2].Content = s.configDocsPageMaker() // Update for new tab
 		s.tabs.Items[3].Content = s.previewPageMaker()    // Index shifted
 		s.tabs.Items[4].Content = s.runPageMaker()        // Index shifted
-		s.tabs.Items[5].Content = s.statsPageMaker()      // Index shifted
+		// The Apply page (index 5) reads the config when used; rebuilding it would drop the pasted response.
+		s.tabs.Items[6].Content = s.statsPageMaker()
 		s.tabs.Refresh()
 		selected := s.tabs.Selected()
 		if selected != nil {
@@ -141,13 +147,18 @@ func (s *AppState) fullUIUpdateOnConfigChange() {
 
 func (s *AppState) refreshStatsPagePostRun() {
 	stats := s.collectorService.GetLastRunStats()
-	if stats.ErrorMessage != "" {
+	if stats.Cancelled {
+		s.statusBar.SetText(stats.ErrorMessage)
+	} else if stats.ErrorMessage != "" {
 		s.statusBar.SetText(fmt.Sprintf("Run failed: %s", stats.ErrorMessage))
 	} else {
 		s.statusBar.SetText(fmt.Sprintf("Run completed. Output: %s. Files: %d", stats.OutputSize, stats.FileCount))
 	}
+	if len(stats.Diagnostics) > 0 {
+		s.statusBar.SetText(fmt.Sprintf("%s (%d problems, see Stats)", s.statusBar.Text, len(stats.Diagnostics)))
+	}
 
-	tabItemsCount := 6 // Updated count
+	tabItemsCount := 7 // Updated count
 	// Ensure stats tab exists (it's the last one)
 	if s.tabs != nil && len(s.tabs.Items) == tabItemsCount {
 		s.tabs.Items[tabItemsCount-1].Content = s.statsPageMaker() // Refresh stats page (still the last one)
@@ -235,6 +246,7 @@ func (s *AppState) saveConfigDialog() {
 			s.statusBar.SetText("Error saving config: " + saveErr.Error())
 			return
 		}
+		currentCfgToSave.ConfigPath = filePathToSave
 		s.fyneApp.Preferences().SetString(preferenceCurrentConfig, filePathToSave)
 		s.statusBar.SetText("Saved config to: " + filepath.Base(filePathToSave))
 	}, s.mainWindow)
@@ -0,0 +1,299 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// DefaultExcerptTokens is the head and tail size of excerpts made by the "prune" action.
+const DefaultExcerptTokens = 200
+
+// Degradation records how and why a file was changed or dropped to fit a budget.
+type Degradation struct {
+	Path   string `json:"path"`
+	Action string `json:"action"` // "excerpt", "path_only", "removed", "trimmed" or "omitted"
+	Reason string `json:"reason"`
+}
+
+// outputBudget holds the limits from Config and the running totals of the output.
+type outputBudget struct {
+	maxTokens int
+	maxBytes  int64
+	tokens    int
+	bytes     int64
+}
+
+func (b *outputBudget) add(e *processedEntry, sign int) {
+	b.tokens += sign * e.tokens
+	b.bytes += int64(sign) * e.bytes
+}
+
+func (b *outputBudget) exceeded() bool {
+	return (b.maxTokens > 0 && b.tokens > b.maxTokens) || (b.maxBytes > 0 && b.bytes > b.maxBytes)
+}
+
+// reason describes which limits are currently exceeded.
+func (b *outputBudget) reason() string {
+	switch {
+	case b.maxTokens > 0 && b.tokens > b.maxTokens && b.maxBytes > 0 && b.bytes > b.maxBytes:
+		return fmt.Sprintf("max_tokens %d and max_output_bytes %d exceeded", b.maxTokens, b.maxBytes)
+	case b.maxTokens > 0 && b.tokens > b.maxTokens:
+		return fmt.Sprintf("max_tokens %d exceeded (%d tokens)", b.maxTokens, b.tokens)
+	default:
+		return fmt.Sprintf("max_output_bytes %d exceeded (%d bytes)", b.maxBytes, b.bytes)
+	}
+}
+
+// measure refreshes the token and byte cost of an entry. The bytes are only
+// measured when a byte limit needs them.
+func (fc *FileCollector) measure(e *processedEntry) {
+	e.tokens = fc.countTokens(e.file)
+	if fc.hasFileField("tokens") {
+		tokens := e.tokens
+		e.file.Tokens = &tokens
+	}
+	if fc.Config.MaxOutputBytes > 0 || (fc.Config.Chunking.Enabled && fc.Config.Chunking.MaxBytes > 0) {
+		e.bytes = fc.sizes.entryBytes(e.entry, e.file)
+	}
+}
+
+// budgetFilter enforces Config.MaxTokens and Config.MaxOutputBytes over the
+// entries as they arrive in output order, according to Config.BudgetAction:
+//   - "trim" (default) passes entries through, truncates the one crossing the budget and omits the rest,
+//   - "fail" returns an error from flush once the budget is exceeded,
+//   - "prune" degrades the lowest-priority entries first (see pruneToBudget). It
+//     needs every entry to decide, so it holds them until flush.
+//
+// Every changed or dropped entry is recorded in result.Degraded.
+type budgetFilter struct {
+	fc      *FileCollector
+	budget  *outputBudget
+	result  *RunResult
+	pending []*processedEntry // Entries held back by "prune"
+	full    bool              // Budget reached; "fail" writes nothing more and "trim" omits the rest
+	reason  string            // budget.reason() when the budget was reached
+}
+
+func (fc *FileCollector) newBudgetFilter(result *RunResult) *budgetFilter {
+	return &budgetFilter{
+		fc:     fc,
+		budget: &outputBudget{maxTokens: fc.Config.MaxTokens, maxBytes: fc.Config.MaxOutputBytes, bytes: fc.sizes.overhead},
+		result: result,
+	}
+}
+
+func (f *budgetFilter) enabled() bool {
+	return f.budget.maxTokens > 0 || f.budget.maxBytes > 0
+}
+
+// push accepts the next entry in output order and returns the entries that
+// can be written now.
+func (f *budgetFilter) push(e *processedEntry) []*processedEntry {
+	if !f.enabled() {
+		return []*processedEntry{e}
+	}
+	switch f.fc.Config.BudgetAction {
+	case "prune":
+		f.budget.add(e, 1)
+		f.pending = append(f.pending, e)
+		return nil
+	case "fail":
+		// Keep counting past the budget so the error reports the full size.
+		f.budget.add(e, 1)
+		if f.full || f.budget.exceeded() {
+			f.full = true
+			return nil
+		}
+		return []*processedEntry{e}
+	default:
+		return f.trim(e)
+	}
+}
+
+// flush returns the entries held back until all entries were seen, or the
+// error of the "fail" action.
+func (f *budgetFilter) flush() ([]*processedEntry, error) {
+	if !f.enabled() {
+		return nil, nil
+	}
+	switch f.fc.Config.BudgetAction {
+	case "prune":
+		if !f.budget.exceeded() {
+			return f.pending, nil
+		}
+		return f.fc.pruneToBudget(f.pending, f.budget, f.result)
+	case "fail":
+		if f.full {
+			return nil, fmt.Errorf("output budget exceeded: %s", f.budget.reason())
+		}
+		return nil, nil
+	default:
+		return nil, nil
+	}
+}
+
+// trim keeps entries until the budget is reached. The entry that crosses it
+// has its content cut to fit and all following entries are omitted.
+func (f *budgetFilter) trim(e *processedEntry) []*processedEntry {
+	if f.full {
+		f.result.Degraded = append(f.result.Degraded, Degradation{Path: e.entry.Path, Action: "omitted", Reason: f.reason})
+		return nil
+	}
+	f.budget.add(e, 1)
+	if !f.budget.exceeded() {
+		return []*processedEntry{e}
+	}
+	f.full = true
+	f.reason = f.budget.reason()
+	f.budget.add(e, -1)
+
+	if e.file.HasContent {
+		f.fc.fitContent(e, f.budget, e.file.Content)
+		f.budget.add(e, 1)
+		if e.file.Content != "" && !f.budget.exceeded() {
+			f.result.Degraded = append(f.result.Degraded, Degradation{Path: e.entry.Path, Action: "trimmed", Reason: f.reason})
+			return []*processedEntry{e}
+		}
+		f.budget.add(e, -1)
+	}
+	f.result.Degraded = append(f.result.Degraded, Degradation{Path: e.entry.Path, Action: "omitted", Reason: f.reason})
+	return nil
+}
+
+// pruneToBudget degrades entries one priority level at a time, starting with
+// the lowest. Within a level, large files are first cut to head/tail excerpts,
+// then reduced to their path, then removed, until the output fits. Ties are
+// broken by include order (later include entries first) and size (largest first).
+func (fc *FileCollector) pruneToBudget(entries []*processedEntry, budget *outputBudget, result *RunResult) ([]*processedEntry, error) {
+	excerptTokens := fc.Config.ExcerptTokens
+	if excerptTokens <= 0 {
+		excerptTokens = DefaultExcerptTokens
+	}
+
+	candidates := append([]*processedEntry(nil), entries...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.entry.Priority != b.entry.Priority {
+			return a.entry.Priority < b.entry.Priority
+		}
+		if a.entry.IncludeIndex != b.entry.IncludeIndex {
+			return a.entry.IncludeIndex > b.entry.IncludeIndex
+		}
+		return a.tokens > b.tokens
+	})
+
+	removed := make(map[*processedEntry]bool)
+	record := func(e *processedEntry, action, reason string) {
+		result.Degraded = append(result.Degraded, Degradation{
+			Path:   e.entry.Path,
+			Action: action,
+			Reason: fmt.Sprintf("%s; priority %d", reason, e.entry.Priority),
+		})
+	}
+
+	for start := 0; start < len(candidates) && budget.exceeded(); {
+		end := start
+		for end < len(candidates) && candidates[end].entry.Priority == candidates[start].entry.Priority {
+			end++
+		}
+		level := candidates[start:end]
+
+		for _, e := range level {
+			if !budget.exceeded() {
+				break
+			}
+			if !e.file.HasContent || fc.tokenizer.Count(e.file.Content) <= 3*excerptTokens {
+				continue
+			}
+			reason := budget.reason()
+			budget.add(e, -1)
+			e.file.Content = fc.excerpt(e.file.Content, excerptTokens)
+			fc.measure(e)
+			budget.add(e, 1)
+			record(e, "excerpt", reason)
+		}
+		for _, e := range level {
+			if !budget.exceeded() {
+				break
+			}
+			if !e.file.HasContent || e.entry.Mode == "content" {
+				continue
+			}
+			reason := budget.reason()
+			budget.add(e, -1)
+			e.file = e.file.withoutContent()
+			fc.measure(e)
+			budget.add(e, 1)
+			record(e, "path_only", reason)
+		}
+		for _, e := range level {
+			if !budget.exceeded() {
+				break
+			}
+			reason := budget.reason()
+			budget.add(e, -1)
+			removed[e] = true
+			record(e, "removed", reason)
+		}
+		start = end
+	}
+
+	if budget.exceeded() {
+		return nil, fmt.Errorf("output budget cannot be met even after pruning: %s", budget.reason())
+	}
+	kept := entries[:0:0]
+	for _, e := range entries {
+		if !removed[e] {
+			kept = append(kept, e)
+		}
+	}
+	return kept, nil
+}
+
+// excerpt keeps the first and last maxTokens tokens of content.
+func (fc *FileCollector) excerpt(content string, maxTokens int) string {
+	head := fc.tokenizer.Truncate(content, maxTokens)
+	// Binary search for the longest suffix that holds at most maxTokens tokens.
+	lo, hi := len(head), len(content)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if fc.tokenizer.Count(content[mid:]) > maxTokens {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	for lo < len(content) && !utf8.RuneStart(content[lo]) {
+		lo++
+	}
+	tail := content[lo:]
+	omitted := fc.tokenizer.Count(content[len(head):lo])
+	return fmt.Sprintf("%s\n... [%d tokens omitted] ...\n%s", head, omitted, tail)
+}
+
+// fitContent cuts an entry's content to the longest prefix that still fits
+// into the budget next to the entries already accounted for in it.
+func (fc *FileCollector) fitContent(e *processedEntry, budget *outputBudget, content string) {
+	fits := func(n int) bool {
+		e.file.Content = content[:n]
+		fc.measure(e)
+		budget.add(e, 1)
+		defer budget.add(e, -1)
+		return !budget.exceeded()
+	}
+	lo, hi := 0, len(content)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if fits(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	for lo > 0 && lo < len(content) && !utf8.RuneStart(content[lo]) {
+		lo--
+	}
+	e.file.Content = content[:lo]
+	fc.measure(e)
+}
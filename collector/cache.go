@@ -0,0 +1,213 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"projectson/config"
+	"projectson/utils"
+	"sync"
+	"time"
+)
+
+// CacheDirName is the default cache directory, created in the project root.
+// Walks skip directories of this name, as they skip ".git".
+const CacheDirName = ".projectson-cache"
+
+// StateDirName is the directory in the project root where projectson keeps
+// other state, such as the history of applied AI responses. Walks skip it
+// like CacheDirName.
+const StateDirName = ".projectson"
+
+// isStateDir reports whether a directory of this name holds projectson's own
+// files rather than the project's.
+func isStateDir(name string) bool {
+	return name == CacheDirName || name == StateDirName
+}
+
+// cacheFileName is the file in the cache directory holding the records.
+const cacheFileName = "files.gob"
+
+// cacheVersion is part of every fingerprint. Bump it when processing changes
+// in a way that gives different results for the same file and settings, such
+// as a change to outlines, comment stripping or whitespace normalization, or
+// when the records change shape.
+const cacheVersion = 2
+
+// racyWindow is how close to the time it was read a file may have been
+// modified for its size and modification time to be trusted. A file written
+// again within the timestamp granularity of the file system would otherwise
+// look unchanged.
+const racyWindow = 2 * time.Second
+
+// CacheDir returns the directory used for cfg's cache: Config.CacheDir, or
+// CacheDirName in the project root.
+func CacheDir(cfg *config.Config) string {
+	if cfg.CacheDir != "" {
+		return cfg.CacheDir
+	}
+	return filepath.Join(cfg.Root, CacheDirName)
+}
+
+// cacheRecord is the cached result of processing one source file.
+type cacheRecord struct {
+	Size        int64
+	ModTime     int64 // Unix nanoseconds
+	ReadAt      int64 // Unix nanoseconds; when the source was read
+	Fingerprint string
+	Result      sourceResult
+}
+
+// fileCache reuses the results of processFile across runs. Records are keyed
+// by source path and hold a fingerprint of the settings that shape the
+// result, so a change to a rule or the whitespace policy only invalidates
+// the files it applies to.
+type fileCache struct {
+	path    string
+	mu      sync.Mutex
+	records map[string]cacheRecord
+	changed bool
+	hits    int
+	misses  int
+}
+
+// loadFileCache reads the cache of cfg. A missing or unreadable cache is
+// started empty, and reported to diags unless it is just missing.
+func loadFileCache(cfg *config.Config, diags *diagnostics) *fileCache {
+	c := &fileCache{
+		path:    filepath.Join(CacheDir(cfg), cacheFileName),
+		records: make(map[string]cacheRecord),
+	}
+	f, err := os.Open(c.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			diags.warn(CodeCacheUnreadable, c.path, "could not open cache: %v", err)
+		}
+		return c
+	}
+	defer f.Close()
+	var version int
+	dec := gob.NewDecoder(f)
+	if err := dec.Decode(&version); err != nil || version != cacheVersion {
+		return c // Written by another version; rebuilt on save.
+	}
+	if err := dec.Decode(&c.records); err != nil {
+		diags.warn(CodeCacheUnreadable, c.path, "ignoring unreadable cache: %v", err)
+		c.records = make(map[string]cacheRecord)
+	}
+	return c
+}
+
+// source returns the processed source of entry from the cache, or processes
+// it with fc and stores the result. A file whose size and modification time
+// match its record is not read; one whose modification time changed is read
+// and counts as a hit when its content did not.
+func (c *fileCache) source(fc *FileCollector, entry FileEntry, hasContent bool) (*sourceResult, error) {
+	info, err := os.Stat(entry.SourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %s: %w", entry.SourcePath, err)
+	}
+	fingerprint := fc.cacheFingerprint(entry)
+	modTime := info.ModTime().UnixNano()
+
+	c.mu.Lock()
+	record, ok := c.records[entry.SourcePath]
+	c.mu.Unlock()
+	ok = ok && record.Fingerprint == fingerprint && record.Size == info.Size()
+	if ok && record.ModTime == modTime && record.ReadAt-record.ModTime > int64(racyWindow) {
+		c.count(true)
+		return &record.Result, nil
+	}
+
+	readAt := time.Now().UnixNano()
+	source, err := os.ReadFile(entry.SourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %s: %w", entry.SourcePath, err)
+	}
+	sum := sha256.Sum256(source)
+	hash := hex.EncodeToString(sum[:])
+	hit := ok && record.Result.SHA256 == hash
+	if !hit {
+		result, err := fc.deriveSource(entry, source, hasContent)
+		if err != nil {
+			return nil, err
+		}
+		result.SHA256 = hash
+		record = cacheRecord{Size: int64(len(source)), Fingerprint: fingerprint, Result: *result}
+	}
+	record.ModTime = modTime
+	record.ReadAt = readAt
+
+	c.mu.Lock()
+	c.records[entry.SourcePath] = record
+	c.changed = true
+	c.mu.Unlock()
+	c.count(hit)
+	return &record.Result, nil
+}
+
+func (c *fileCache) count(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+}
+
+// save writes the cache when it changed. Only the records of files are kept
+// that the run collects, processed or not; those of files that were removed,
+// excluded or are of a format no longer collected are dropped.
+func (c *fileCache) save(files []FileEntry) error {
+	collected := make(map[string]bool, len(files))
+	for _, entry := range files {
+		collected[entry.SourcePath] = true
+	}
+	for path := range c.records {
+		if !collected[path] {
+			delete(c.records, path)
+			c.changed = true
+		}
+	}
+	if !c.changed {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("creating cache directory: %w", err)
+	}
+	f, err := utils.CreateAtomicFile(c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	enc := gob.NewEncoder(f)
+	if err := enc.Encode(cacheVersion); err != nil {
+		return fmt.Errorf("writing cache: %w", err)
+	}
+	if err := enc.Encode(c.records); err != nil {
+		return fmt.Errorf("writing cache: %w", err)
+	}
+	return f.Commit(0644)
+}
+
+// cacheFingerprint hashes everything besides the file content that shapes
+// the processed source of entry: its mode and format, the content exclusion
+// rules that apply to it and its whitespace settings.
+func (fc *FileCollector) cacheFingerprint(entry FileEntry) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%s\x00%s\x00%s\x00%d\x00", cacheVersion, entry.Mode, entry.Format,
+		fc.Config.WhitespaceFor(entry.Format), fc.Config.TabWidth)
+	for _, rule := range fc.Config.ContentExclusions {
+		if contentRuleApplies(rule, entry.Format) {
+			data, _ := json.Marshal(rule)
+			h.Write(data)
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,354 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"projectson/utils"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ChunkIndex is the content of the index file written next to chunked output.
+type ChunkIndex struct {
+	Parts []ChunkPart `json:"parts"`
+	Split []string    `json:"split,omitempty"` // Files whose content was spread over several parts
+	Meta  *Meta       `json:"meta,omitempty"`  // Totals of all parts when Config.Meta is set
+}
+
+// ChunkPart lists the files written to one part file.
+type ChunkPart struct {
+	File   string   `json:"file"` // Part file name, in the directory of the index
+	Bytes  int64    `json:"bytes"`
+	Tokens int      `json:"tokens"`
+	Paths  []string `json:"paths"`
+}
+
+// ChunkPartPath returns the path of part n (1-based) of output:
+// "out/output.json" becomes "out/output.part-001.json".
+func ChunkPartPath(output string, n int) string {
+	ext := filepath.Ext(output)
+	return fmt.Sprintf("%s.part-%03d%s", strings.TrimSuffix(output, ext), n, ext)
+}
+
+// ChunkIndexPath returns the path of the index file of chunked output:
+// "out/output.json" becomes "out/output.index.json".
+func ChunkIndexPath(output string) string {
+	return strings.TrimSuffix(output, filepath.Ext(output)) + ".index.json"
+}
+
+// chunkWriter distributes the entries of a run over part files that each
+// stay within Config.Chunking's limits. Entries are kept in output order.
+// Consecutive entries of the same directory are placed as a group, which
+// moves to a new part rather than being divided when it does not fit into
+// the current one. Only a file that exceeds the limits on its own is split.
+type chunkWriter struct {
+	fc        *FileCollector
+	info      *OutputInfo
+	result    *RunResult
+	diags     *diagnostics
+	maxBytes  int64
+	maxTokens int
+	first     *writerSizes // Sizes of the first part, which holds the tree
+	rest      *writerSizes
+
+	group    []*processedEntry // Entries of groupDir not yet placed
+	groupDir string
+	parts    []*chunkPart
+	split    []string
+}
+
+// chunkPart is a part file being written.
+type chunkPart struct {
+	out    *outputFile
+	info   *OutputInfo
+	path   string
+	bytes  int64 // Estimated size, including the document overhead
+	tokens int
+	paths  []string
+}
+
+func (fc *FileCollector) newChunkWriter(info *OutputInfo, files []FileEntry, result *RunResult, diags *diagnostics) (*chunkWriter, error) {
+	sized := sizingInfo(info, files)
+	if sized.Meta != nil {
+		sized.Meta.Part = math.MaxInt32
+	}
+	restInfo := *sized
+	restInfo.Tree = ""
+	c := &chunkWriter{
+		fc:        fc,
+		info:      info,
+		result:    result,
+		diags:     diags,
+		maxBytes:  fc.Config.Chunking.MaxBytes,
+		maxTokens: fc.Config.Chunking.MaxTokens,
+		first:     newWriterSizes(fc.newWriter, sized),
+		rest:      newWriterSizes(fc.newWriter, &restInfo),
+	}
+	if c.maxBytes > 0 && c.first.overhead >= c.maxBytes {
+		return nil, fmt.Errorf("chunking max_bytes %d is too small for the document around the files (%d bytes)", c.maxBytes, c.first.overhead)
+	}
+	return c, nil
+}
+
+func (c *chunkWriter) write(e *processedEntry) error {
+	if dir := filepath.Dir(e.entry.Path); dir != c.groupDir {
+		if err := c.placeGroup(); err != nil {
+			return err
+		}
+		c.groupDir = dir
+	}
+	c.group = append(c.group, e)
+	return nil
+}
+
+// placeGroup writes the held entries of one directory.
+func (c *chunkWriter) placeGroup() error {
+	group := c.group
+	c.group = nil
+	if len(group) == 0 {
+		return nil
+	}
+	var bytes int64
+	tokens := 0
+	for _, e := range group {
+		bytes += e.bytes
+		tokens += e.tokens
+	}
+	if cur := c.current(); cur != nil && !c.fits(cur, bytes, tokens) && c.fits(nil, bytes, tokens) {
+		if err := c.newPart(); err != nil {
+			return err
+		}
+	}
+	for _, e := range group {
+		if err := c.place(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// place writes one entry into the current part, a new part, or split over
+// several parts when it exceeds the limits on its own.
+func (c *chunkWriter) place(e *processedEntry) error {
+	if cur := c.current(); cur != nil && c.fits(cur, e.bytes, e.tokens) {
+		return cur.write(e)
+	}
+	if c.fits(nil, e.bytes, e.tokens) {
+		if err := c.newPart(); err != nil {
+			return err
+		}
+		return c.current().write(e)
+	}
+	content := e.file.Content
+	if !e.file.HasContent {
+		return fmt.Errorf("%s does not fit into a part of the configured chunking limits", e.entry.Path)
+	}
+	c.split = append(c.split, e.entry.Path)
+	for len(content) > 0 {
+		if c.current() == nil || len(c.current().paths) > 0 {
+			if err := c.newPart(); err != nil {
+				return err
+			}
+		}
+		piece := c.fitPiece(e, content)
+		if piece.file.Content == "" {
+			return fmt.Errorf("%s does not fit into a part of the configured chunking limits", e.entry.Path)
+		}
+		if err := c.current().write(piece); err != nil {
+			return err
+		}
+		content = content[len(piece.file.Content):]
+	}
+	return nil
+}
+
+// fitPiece returns a copy of e holding the longest prefix of content that
+// fits into the current, empty part.
+func (c *chunkWriter) fitPiece(e *processedEntry, content string) *processedEntry {
+	piece := &processedEntry{entry: e.entry, file: e.file}
+	measure := func(n int) bool {
+		piece.file.Content = content[:n]
+		c.fc.measure(piece)
+		return c.fits(c.current(), piece.bytes, piece.tokens)
+	}
+	lo, hi := 0, len(content)
+	for lo < hi {
+		mid := (lo + hi + 1) / 2
+		if measure(mid) {
+			lo = mid
+		} else {
+			hi = mid - 1
+		}
+	}
+	for lo > 0 && lo < len(content) && !utf8.RuneStart(content[lo]) {
+		lo--
+	}
+	measure(lo)
+	return piece
+}
+
+// fits reports whether an entry of the given size fits into part, or into a
+// new empty part when part is nil.
+func (c *chunkWriter) fits(part *chunkPart, bytes int64, tokens int) bool {
+	usedBytes, usedTokens := c.rest.overhead, 0
+	if part != nil {
+		usedBytes, usedTokens = part.bytes, part.tokens
+	} else if len(c.parts) == 0 {
+		usedBytes = c.first.overhead
+	}
+	return (c.maxBytes <= 0 || usedBytes+bytes <= c.maxBytes) && (c.maxTokens <= 0 || usedTokens+tokens <= c.maxTokens)
+}
+
+func (c *chunkWriter) current() *chunkPart {
+	if len(c.parts) == 0 {
+		return nil
+	}
+	return c.parts[len(c.parts)-1]
+}
+
+// newPart finishes the current part and starts the next one.
+func (c *chunkWriter) newPart() error {
+	if cur := c.current(); cur != nil {
+		if err := cur.out.stage(); err != nil {
+			return err
+		}
+	}
+	n := len(c.parts) + 1
+	info := &OutputInfo{}
+	sizes := c.rest
+	if n == 1 {
+		info.Tree = c.info.Tree
+		sizes = c.first
+	}
+	if c.info.Meta != nil {
+		meta := *c.info.Meta
+		meta.FileCount, meta.TotalBytes, meta.TotalTokens = 0, 0, 0
+		meta.Part = n
+		info.Meta = &meta
+	}
+	path := ChunkPartPath(c.fc.Config.Output, n)
+	out, err := createOutputFile(path, c.fc.newWriter, info)
+	if err != nil {
+		return err
+	}
+	c.parts = append(c.parts, &chunkPart{out: out, info: info, path: path, bytes: sizes.overhead})
+	return nil
+}
+
+func (p *chunkPart) write(e *processedEntry) error {
+	if err := p.out.write(e); err != nil {
+		return err
+	}
+	p.bytes += e.bytes
+	p.tokens += e.tokens
+	p.paths = append(p.paths, e.entry.Path)
+	if p.info.Meta != nil {
+		p.info.Meta.FileCount++
+		p.info.Meta.TotalBytes += e.entry.Size
+		p.info.Meta.TotalTokens += e.tokens
+	}
+	return nil
+}
+
+// commit places the last group, stages the last part and the index, then
+// moves the parts into place and the index last, and removes parts left over
+// from earlier runs with more parts. The earlier parts were staged as they
+// were finished, so only their temporary paths are held, not open files.
+// Nothing is replaced when a part cannot be written; should a rename fail,
+// the error names the parts already replaced.
+func (c *chunkWriter) commit() error {
+	if err := c.placeGroup(); err != nil {
+		return err
+	}
+	if len(c.parts) == 0 {
+		if err := c.newPart(); err != nil {
+			return err
+		}
+	}
+	if err := c.current().out.stage(); err != nil {
+		return err
+	}
+	index := ChunkIndex{Split: c.split, Meta: c.info.Meta}
+	for _, p := range c.parts {
+		index.Parts = append(index.Parts, ChunkPart{
+			File:   filepath.Base(p.path),
+			Bytes:  p.out.size(),
+			Tokens: p.tokens,
+			Paths:  append([]string{}, p.paths...),
+		})
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	indexFile, err := utils.CreateAtomicFile(ChunkIndexPath(c.fc.Config.Output))
+	if err != nil {
+		return err
+	}
+	defer indexFile.Abort()
+	if _, err := indexFile.Write(data); err != nil {
+		return fmt.Errorf("writing chunk index: %w", err)
+	}
+
+	if err := indexFile.Stage(0644); err != nil {
+		return err
+	}
+
+	for _, p := range c.parts {
+		if err := p.out.file.Commit(0644); err != nil {
+			if len(c.result.Parts) > 0 {
+				return fmt.Errorf("%w; the index was left unchanged, but these parts were already replaced: %s", err, strings.Join(c.result.Parts, ", "))
+			}
+			return err
+		}
+		c.result.Parts = append(c.result.Parts, p.path)
+	}
+	if err := indexFile.Commit(0644); err != nil {
+		return fmt.Errorf("%w; all parts were replaced, but the index still describes the previous run", err)
+	}
+	c.result.IndexFile = ChunkIndexPath(c.fc.Config.Output)
+	c.removeStaleParts()
+	return nil
+}
+
+// removeStaleParts deletes part files numbered above the last part written.
+func (c *chunkWriter) removeStaleParts() {
+	output := c.fc.Config.Output
+	ext := filepath.Ext(output)
+	prefix := filepath.Base(strings.TrimSuffix(output, ext)) + ".part-"
+	dir := filepath.Dir(output)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		number, ok := strings.CutPrefix(name, prefix)
+		if !ok || !strings.HasSuffix(number, ext) {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(number, ext)); err == nil && n > len(c.parts) {
+			if err := os.Remove(filepath.Join(dir, name)); err != nil {
+				c.diags.warn(CodeStalePartNotRemoved, filepath.Join(dir, name), "could not remove stale part file: %v", err)
+			}
+		}
+	}
+}
+
+func (c *chunkWriter) abort() {
+	for _, p := range c.parts {
+		p.out.abort()
+	}
+}
+
+func (c *chunkWriter) size() int64 {
+	var total int64
+	for _, p := range c.parts {
+		total += p.out.size()
+	}
+	return total
+}
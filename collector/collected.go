@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"projectson/utils"
+	"sort"
+	"time"
+)
+
+// collectedFileName is the file in StateDirName listing the files of the
+// last run, which the apply allowlist admits.
+const collectedFileName = "collected.json"
+
+// CollectedSet lists the files written to the output by a run.
+type CollectedSet struct {
+	Time  time.Time `json:"time"`
+	Files []string  `json:"files"` // Relative to the root, with forward slashes, sorted
+}
+
+// Contains reports whether the set holds rel, a slash-separated path relative
+// to the root.
+func (s *CollectedSet) Contains(rel string) bool {
+	i := sort.SearchStrings(s.Files, rel)
+	return i < len(s.Files) && s.Files[i] == rel
+}
+
+// LastCollected returns the files of the last run in root that recorded
+// them, which runs do when Config.ApplyRestricted is set. The error wraps
+// os.ErrNotExist when no run has.
+func LastCollected(root string) (*CollectedSet, error) {
+	data, err := os.ReadFile(filepath.Join(root, StateDirName, collectedFileName))
+	if err != nil {
+		return nil, fmt.Errorf("reading the files of the last run: %w", err)
+	}
+	var set CollectedSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid record of the files of the last run: %w", err)
+	}
+	sort.Strings(set.Files)
+	return &set, nil
+}
+
+// saveCollected records files, relative to root, as the last collected set.
+func saveCollected(root string, files []string) error {
+	set := CollectedSet{Time: time.Now(), Files: make([]string, 0, len(files))}
+	for _, f := range files {
+		set.Files = append(set.Files, filepath.ToSlash(f))
+	}
+	sort.Strings(set.Files)
+	data, err := json.MarshalIndent(set, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(root, StateDirName, collectedFileName)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := utils.CreateAtomicFile(path)
+	if err != nil {
+		return err
+	}
+	defer f.Abort()
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	return f.Commit(0644)
+}
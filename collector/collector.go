@@ -1,12 +1,18 @@
 package collector
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"projectson/comments"
 	"projectson/config"
+	"projectson/tokenizer"
 	"projectson/utils"
 	"regexp"
 	"runtime"
@@ -17,31 +23,60 @@ import (
 
 // FileCollector handles the logic of collecting and processing files.
 type FileCollector struct {
-	Config         *config.Config
-	excludeRegexps map[string]*regexp.Regexp
+	Config       *config.Config
+	excludeRules []globRule
+	tokenizer    tokenizer.Estimator
+	newWriter    writerFactory
+	sizes        *writerSizes // Measures entries in the output of the current run
+	cache        *fileCache   // Set during a run when Config.Cache is enabled
+	// setupDiagnostics are found by NewFileCollector and reported by every
+	// PreviewFiles and Run call.
+	setupDiagnostics []Diagnostic
 }
 
-// OutputJSON represents the structure of the final JSON output.
+// OutputJSON represents the structure of the "json" output format.
 type OutputJSON struct {
+	Tree         string          `json:"tree,omitempty"`
 	ProjectFiles []ProcessedFile `json:"project_files"`
+	Meta         *Meta           `json:"meta,omitempty"`
 }
 
 // NewFileCollector creates a new FileCollector instance.
 func NewFileCollector(cfg *config.Config) (*FileCollector, error) {
+	estimator, err := tokenizer.New(cfg.Tokenizer, tokenizer.Options{CharsPerToken: cfg.CharsPerToken})
+	if err != nil {
+		return nil, err
+	}
 	fc := &FileCollector{
-		Config:         cfg,
-		excludeRegexps: make(map[string]*regexp.Regexp),
+		Config:    cfg,
+		tokenizer: estimator,
+	}
+	newWriter, ok := writerFactories[cfg.EffectiveOutputFormat()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported output format %q", cfg.EffectiveOutputFormat())
+	}
+	if cfg.OutputTemplate != "" {
+		tmpl, err := fc.parseOutputTemplate()
+		if err != nil {
+			return nil, err
+		}
+		newWriter = func(w io.Writer, info *OutputInfo) Writer {
+			return &templateWriter{w: w, info: info, tmpl: tmpl, fc: fc}
+		}
 	}
+	fc.newWriter = newWriter
+	fc.sizes = newWriterSizes(newWriter, &OutputInfo{})
 	for _, pattern := range cfg.ExcludePatterns {
-		if strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
-			regexStr := pattern[1 : len(pattern)-1]
-			compiledRegexp, err := regexp.Compile(regexStr)
-			if err != nil {
-				fmt.Printf("Warning: Invalid regex exclude pattern '%s': %v\n", regexStr, err)
-			} else {
-				fc.excludeRegexps[pattern] = compiledRegexp
-			}
+		rule, err := compileGlobRule(pattern)
+		if err != nil {
+			fc.setupDiagnostics = append(fc.setupDiagnostics, Diagnostic{
+				Code:     CodeInvalidExcludePattern,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("invalid exclude pattern '%s': %v", pattern, err),
+			})
+			continue
 		}
+		fc.excludeRules = append(fc.excludeRules, rule)
 	}
 	return fc, nil
 }
@@ -52,56 +87,36 @@ func (fc *FileCollector) parseInclude() []config.ParsedIncludeEntry {
 		if strings.TrimSpace(entry) == "" {
 			continue
 		}
-		path := entry
-		mode := "both"
-		isDirOnlyFiles := false
-		if strings.HasSuffix(entry, "/*") {
-			path = strings.TrimSuffix(entry, "/*")
-			isDirOnlyFiles = true
-		}
-		if strings.Contains(path, ":") {
-			parts := strings.SplitN(path, ":", 2)
-			path = strings.TrimSpace(parts[0])
-			param := strings.TrimSpace(strings.ToLower(parts[1]))
-			if param == "path" || param == "content" {
-				mode = param
-			}
-		}
-		parsed = append(parsed, config.ParsedIncludeEntry{Path: path, Mode: mode, IsDirOnlyFiles: isDirOnlyFiles})
+		parsed = append(parsed, config.ParseIncludeEntry(entry))
 	}
 	return parsed
 }
 
+// isExcluded evaluates exclude_patterns in order; the last matching rule wins.
 func (fc *FileCollector) isExcluded(path string, isDir bool) (bool, error) {
 	baseName := filepath.Base(path)
 	relPath, err := filepath.Rel(fc.Config.Root, path)
 	if err != nil {
 		relPath = baseName
 	}
+	relPath = filepath.ToSlash(relPath)
 
-	for _, pattern := range fc.Config.ExcludePatterns {
-		if compiledRegexp, ok := fc.excludeRegexps[pattern]; ok && compiledRegexp != nil {
-			if compiledRegexp.MatchString(baseName) || compiledRegexp.MatchString(relPath) || compiledRegexp.MatchString(path) {
-				return true, nil
-			}
-		} else if !strings.HasPrefix(pattern, "/") {
-			matchBase, _ := filepath.Match(pattern, baseName)
-			if matchBase {
-				return true, nil
-			}
-			if strings.ContainsRune(pattern, os.PathSeparator) || strings.ContainsRune(pattern, '/') {
-				matchPath, _ := filepath.Match(pattern, relPath)
-				if matchPath {
-					return true, nil
-				}
-			}
+	excluded := false
+	for _, rule := range fc.excludeRules {
+		if rule.matches(baseName, relPath, path) {
+			excluded = !rule.negate
 		}
 	}
-	return false, nil
+	return excluded, nil
+}
+
+// fileFormat returns the lower-cased extension of a file name without the dot.
+func fileFormat(filename string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
 }
 
 func (fc *FileCollector) matchFormat(filename string) bool {
-	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
+	ext := fileFormat(filename)
 	for _, format := range fc.Config.Formats {
 		if ext == format {
 			return true
@@ -110,17 +125,72 @@ func (fc *FileCollector) matchFormat(filename string) bool {
 	return false
 }
 
-func (fc *FileCollector) PreviewFiles() ([]FileEntry, error) {
+// newIgnoreMatcher returns a gitignore matcher for the current config, or nil when disabled.
+func (fc *FileCollector) newIgnoreMatcher() *gitignoreMatcher {
+	if !fc.Config.RespectGitignore {
+		return nil
+	}
+	return newGitignoreMatcher(fc.Config.Root, fc.Config.GlobalGitignore)
+}
+
+// shouldSkip combines exclude_patterns and, if enabled, gitignore rules.
+func (fc *FileCollector) shouldSkip(path string, isDir bool, ignore *gitignoreMatcher) bool {
+	if excluded, _ := fc.isExcluded(path, isDir); excluded {
+		return true
+	}
+	return ignore != nil && ignore.IsIgnored(path, isDir)
+}
+
+// newFileEntry builds a FileEntry for a file found under root by the include entry at includeIndex.
+func (fc *FileCollector) newFileEntry(absPath string, size int64, include config.ParsedIncludeEntry, includeIndex int) FileEntry {
+	relPath, _ := filepath.Rel(fc.Config.Root, absPath)
+	return FileEntry{
+		Path:         filepath.Join(filepath.Base(fc.Config.Root), relPath),
+		OriginalPath: relPath,
+		SourcePath:   absPath,
+		Mode:         include.Mode,
+		Size:         size,
+		Format:       fileFormat(absPath),
+		Priority:     include.Priority,
+		IncludeIndex: includeIndex,
+	}
+}
+
+// PreviewFiles lists the files a run collects, in output order, and the
+// problems met while listing them. It stops with ctx's error when ctx is
+// done.
+func (fc *FileCollector) PreviewFiles(ctx context.Context) ([]FileEntry, []Diagnostic, error) {
+	diags := fc.newDiagnostics()
+	entries, err := fc.listFiles(ctx, diags)
+	return entries, diags.all(), err
+}
+
+// listFiles does the work of PreviewFiles, adding problems to diags.
+func (fc *FileCollector) listFiles(ctx context.Context, diags *diagnostics) ([]FileEntry, error) {
 	var entries []FileEntry
-	rootBase := filepath.Base(fc.Config.Root)
 	includes := fc.parseInclude()
 	foundFiles := make(map[string]FileEntry)
+	ignore := fc.newIgnoreMatcher()
+
+	for includeIndex, include := range includes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if include.Negate {
+			fc.removeMatchingEntries(foundFiles, include.Path, diags)
+			continue
+		}
+		if include.IsGlob {
+			if err := fc.collectGlobInclude(ctx, include, includeIndex, ignore, foundFiles, diags); err != nil {
+				return nil, err
+			}
+			continue
+		}
 
-	for _, include := range includes {
 		absIncludePath := filepath.Join(fc.Config.Root, include.Path)
 		info, err := os.Stat(absIncludePath)
 		if os.IsNotExist(err) {
-			fmt.Printf("Warning: include path not found: %s\n", absIncludePath)
+			diags.warn(CodeIncludeNotFound, absIncludePath, "include path not found")
 			continue
 		}
 		if err != nil {
@@ -135,73 +205,28 @@ func (fc *FileCollector) PreviewFiles() ([]FileEntry, error) {
 			for _, file := range files {
 				if !file.IsDir() {
 					filePath := filepath.Join(absIncludePath, file.Name())
-					excluded, _ := fc.isExcluded(filePath, false)
-					if !excluded && fc.matchFormat(file.Name()) {
+					if !fc.shouldSkip(filePath, false, ignore) && fc.matchFormat(file.Name()) && !fc.isOutputFile(filePath) {
 						fileInfo, statErr := file.Info()
 						if statErr != nil {
-							fmt.Printf("Warning: could not stat file %s: %v\n", filePath, statErr)
+							diags.warn(CodeUnreadablePath, filePath, "could not stat file: %v", statErr)
 							continue
 						}
-						relPath, _ := filepath.Rel(fc.Config.Root, filePath)
-						entry := FileEntry{
-							Path:         filepath.Join(rootBase, relPath),
-							OriginalPath: relPath,
-							SourcePath:   filePath,
-							Mode:         include.Mode,
-							Size:         fileInfo.Size(),
-							Format:       strings.ToLower(strings.TrimPrefix(filepath.Ext(file.Name()), ".")),
-						}
+						entry := fc.newFileEntry(filePath, fileInfo.Size(), include, includeIndex)
 						foundFiles[entry.Path] = entry
 					}
 				}
 			}
 		} else if info.IsDir() { // Recursive walk
-			err := filepath.WalkDir(absIncludePath, func(currentPath string, d fs.DirEntry, errWalk error) error {
-				if errWalk != nil {
-					fmt.Printf("Warning: error accessing path %q: %v\n", currentPath, errWalk)
-					return errWalk
-				}
-				excluded, _ := fc.isExcluded(currentPath, d.IsDir())
-				if excluded {
-					if d.IsDir() {
-						return filepath.SkipDir
-					}
-					return nil
-				}
-				if !d.IsDir() && fc.matchFormat(d.Name()) {
-					fileInfo, statErr := d.Info()
-					if statErr != nil {
-						fmt.Printf("Warning: could not stat file %s: %v\n", currentPath, statErr)
-						return nil
-					}
-					relPath, _ := filepath.Rel(fc.Config.Root, currentPath)
-					entry := FileEntry{
-						Path:         filepath.Join(rootBase, relPath),
-						OriginalPath: relPath,
-						SourcePath:   currentPath,
-						Mode:         include.Mode,
-						Size:         fileInfo.Size(),
-						Format:       strings.ToLower(strings.TrimPrefix(filepath.Ext(d.Name()), ".")),
-					}
-					foundFiles[entry.Path] = entry
-				}
-				return nil
+			err := fc.walkDir(ctx, absIncludePath, ignore, diags, func(currentPath string, size int64) {
+				entry := fc.newFileEntry(currentPath, size, include, includeIndex)
+				foundFiles[entry.Path] = entry
 			})
 			if err != nil {
 				return nil, fmt.Errorf("error walking directory %s: %w", absIncludePath, err)
 			}
 		} else { // Single file
-			excluded, _ := fc.isExcluded(absIncludePath, false)
-			if !excluded && fc.matchFormat(info.Name()) {
-				relPath, _ := filepath.Rel(fc.Config.Root, absIncludePath)
-				entry := FileEntry{
-					Path:         filepath.Join(rootBase, relPath),
-					OriginalPath: relPath,
-					SourcePath:   absIncludePath,
-					Mode:         include.Mode,
-					Size:         info.Size(),
-					Format:       strings.ToLower(strings.TrimPrefix(filepath.Ext(info.Name()), ".")),
-				}
+			if !fc.shouldSkip(absIncludePath, false, ignore) && fc.matchFormat(info.Name()) {
+				entry := fc.newFileEntry(absIncludePath, info.Size(), include, includeIndex)
 				foundFiles[entry.Path] = entry
 			}
 		}
@@ -210,30 +235,125 @@ func (fc *FileCollector) PreviewFiles() ([]FileEntry, error) {
 	for _, entry := range foundFiles {
 		entries = append(entries, entry)
 	}
-	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	fc.sortEntries(entries)
 	return entries, nil
 }
 
+// sortEntries puts entries into output order. Map iteration and worker
+// scheduling never affect it, so unchanged trees give byte-identical output.
+func (fc *FileCollector) sortEntries(entries []FileEntry) {
+	byInclude := fc.Config.Order == "include"
+	sort.Slice(entries, func(i, j int) bool {
+		if byInclude && entries[i].IncludeIndex != entries[j].IncludeIndex {
+			return entries[i].IncludeIndex < entries[j].IncludeIndex
+		}
+		return entries[i].Path < entries[j].Path
+	})
+}
+
+// walkDir recursively walks dir, skipping excluded paths, and calls onFile for
+// every file that matches the configured formats.
+func (fc *FileCollector) walkDir(ctx context.Context, dir string, ignore *gitignoreMatcher, diags *diagnostics, onFile func(path string, size int64)) error {
+	return filepath.WalkDir(dir, func(currentPath string, d fs.DirEntry, errWalk error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if errWalk != nil {
+			return errWalk
+		}
+		if d.IsDir() && isStateDir(d.Name()) {
+			return filepath.SkipDir
+		}
+		if fc.shouldSkip(currentPath, d.IsDir(), ignore) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && fc.matchFormat(d.Name()) && !fc.isOutputFile(currentPath) {
+			fileInfo, statErr := d.Info()
+			if statErr != nil {
+				diags.warn(CodeUnreadablePath, currentPath, "could not stat file: %v", statErr)
+				return nil
+			}
+			onFile(currentPath, fileInfo.Size())
+		}
+		return nil
+	})
+}
+
+// globBaseDir returns the longest leading part of a glob without special characters.
+func globBaseDir(pattern string) string {
+	segments := strings.Split(pattern, "/")
+	var base []string
+	for _, seg := range segments[:len(segments)-1] {
+		if utils.HasGlobMeta(seg) {
+			break
+		}
+		base = append(base, seg)
+	}
+	return strings.Join(base, "/")
+}
+
+// collectGlobInclude adds every file under root whose relative path matches a glob include entry.
+func (fc *FileCollector) collectGlobInclude(ctx context.Context, include config.ParsedIncludeEntry, includeIndex int, ignore *gitignoreMatcher, foundFiles map[string]FileEntry, diags *diagnostics) error {
+	pattern := strings.TrimPrefix(filepath.ToSlash(include.Path), "/")
+	re, err := compileGlob(pattern)
+	if err != nil {
+		diags.warn(CodeInvalidIncludeGlob, "", "invalid include glob '%s': %v", include.Path, err)
+		return nil
+	}
+	baseDir := filepath.Join(fc.Config.Root, filepath.FromSlash(globBaseDir(pattern)))
+	if _, err := os.Stat(baseDir); os.IsNotExist(err) {
+		diags.warn(CodeIncludeNotFound, baseDir, "include path not found")
+		return nil
+	}
+	err = fc.walkDir(ctx, baseDir, ignore, diags, func(currentPath string, size int64) {
+		relPath, _ := filepath.Rel(fc.Config.Root, currentPath)
+		if re.MatchString(filepath.ToSlash(relPath)) {
+			entry := fc.newFileEntry(currentPath, size, include, includeIndex)
+			foundFiles[entry.Path] = entry
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("error walking directory %s: %w", baseDir, err)
+	}
+	return nil
+}
+
+// removeMatchingEntries drops entries collected so far that match a "!" include.
+// A plain path removes that file or everything below that directory.
+func (fc *FileCollector) removeMatchingEntries(foundFiles map[string]FileEntry, pattern string, diags *diagnostics) {
+	pattern = strings.Trim(filepath.ToSlash(pattern), "/")
+	re, err := compileGlob(pattern)
+	if err != nil {
+		diags.warn(CodeInvalidIncludeGlob, "", "invalid include glob '!%s': %v", pattern, err)
+		return
+	}
+	for key, entry := range foundFiles {
+		relPath := filepath.ToSlash(entry.OriginalPath)
+		if re.MatchString(relPath) || strings.HasPrefix(relPath, pattern+"/") {
+			delete(foundFiles, key)
+		}
+	}
+}
+
+// ApplyContentExclusions applies the content exclusion rules for the given
+// format (extension without the dot) to content. Rules that cannot be used
+// are skipped.
 func (fc *FileCollector) ApplyContentExclusions(content string, fileExt string) (string, error) {
+	return fc.applyContentExclusions(content, fileExt, "", nil)
+}
+
+// applyContentExclusions does the work of ApplyContentExclusions, adding
+// rules that cannot be used for the file at path to diags.
+func (fc *FileCollector) applyContentExclusions(content, fileExt, path string, diags *diagnostics) (string, error) {
 	modifiedContent := content
 	if len(fc.Config.ContentExclusions) == 0 {
 		return content, nil
 	}
-	dotFileExt := "." + fileExt // e.g. ".vue"
-
 	for _, exclusion := range fc.Config.ContentExclusions {
-		applies := false
-		if exclusion.FilePattern == "*" {
-			applies = true
-		} else {
-			matchExt, _ := filepath.Match(exclusion.FilePattern, fileExt)
-			matchDotExt, _ := filepath.Match(exclusion.FilePattern, dotFileExt)
-			if matchExt || matchDotExt {
-				applies = true
-			}
-		}
-
-		if !applies {
+		if !contentRuleApplies(exclusion, fileExt) {
 			continue
 		}
 
@@ -243,7 +363,7 @@ func (fc *FileCollector) ApplyContentExclusions(content string, fileExt string)
 				regexPattern := fmt.Sprintf("(?s)%s.*?%s", regexp.QuoteMeta(exclusion.Start), regexp.QuoteMeta(exclusion.End))
 				re, err := regexp.Compile(regexPattern)
 				if err != nil {
-					fmt.Printf("Warning: Invalid delimiter regex pattern derived: %v\n", err)
+					diags.warn(CodeInvalidContentRule, "", "invalid delimiter regex pattern derived: %v", err)
 					continue
 				}
 				modifiedContent = re.ReplaceAllString(modifiedContent, "")
@@ -258,130 +378,432 @@ func (fc *FileCollector) ApplyContentExclusions(content string, fileExt string)
 				}
 				re, err := regexp.Compile(pattern)
 				if err != nil {
-					fmt.Printf("Warning: Invalid content exclusion regex pattern '%s': %v\n", exclusion.Pattern, err)
+					diags.warn(CodeInvalidContentRule, "", "invalid content exclusion regex pattern '%s': %v", exclusion.Pattern, err)
 					continue
 				}
 				modifiedContent = re.ReplaceAllString(modifiedContent, "")
 			}
+		case "comments":
+			language := exclusion.Language
+			if language == "" {
+				language = comments.LanguageForFormat(fileExt)
+				if language == "" {
+					continue // No lexer for this format
+				}
+			}
+			stripped, err := comments.Strip(modifiedContent, language, comments.Options{KeepDocComments: exclusion.KeepDocComments})
+			if err != nil {
+				diags.warn(CodeCommentStripFailed, path, "comments kept: %v", err)
+				continue
+			}
+			modifiedContent = stripped
 		default:
-			fmt.Printf("Warning: Unknown content exclusion type: %s\n", exclusion.Type)
+			diags.warn(CodeInvalidContentRule, "", "unknown content exclusion type: %s", exclusion.Type)
 		}
 	}
 	return modifiedContent, nil
 }
 
-func (fc *FileCollector) processFile(entry FileEntry) (ProcessedFile, error) {
-	result := make(ProcessedFile)
-	if entry.Mode == "path" || entry.Mode == "both" {
-		result["path"] = entry.Path
+// contentRuleApplies reports whether a content exclusion rule applies to
+// files of the given format (extension without the dot).
+func contentRuleApplies(rule config.ContentExclusionRule, fileExt string) bool {
+	if rule.FilePattern == "*" {
+		return true
 	}
+	matchExt, _ := filepath.Match(rule.FilePattern, fileExt)
+	matchDotExt, _ := filepath.Match(rule.FilePattern, "."+fileExt) // e.g. ".vue"
+	return matchExt || matchDotExt
+}
 
-	if entry.Mode == "content" || entry.Mode == "both" {
-		contentBytes, err := os.ReadFile(entry.SourcePath)
-		if err != nil {
-			return nil, fmt.Errorf("reading file %s: %w", entry.SourcePath, err)
+// sourceResult is what processFile derives from the bytes of a source file,
+// and what the cache stores for it.
+type sourceResult struct {
+	Content      string // Final content; empty unless the entry's mode includes content
+	BytesRemoved int64  // Bytes removed from the content by content exclusions
+	Lines        int
+	SHA256       string       // Hex digest of the source; empty when neither cached nor selected
+	Diagnostics  []Diagnostic // Problems met deriving the content; replayed on cache hits
+}
+
+func (fc *FileCollector) processFile(entry FileEntry, diags *diagnostics) (*ProcessedFile, error) {
+	hasPath := entry.Mode == "path" || entry.Mode == "both" || entry.Mode == "outline"
+	hasContent := entry.Mode == "content" || entry.Mode == "both" || entry.Mode == "outline"
+	if !hasPath && !hasContent {
+		return nil, nil
+	}
+	result := &ProcessedFile{}
+	if hasPath {
+		result.Path = entry.Path
+	}
+
+	var source *sourceResult
+	if hasContent || fc.hasFileField("lines") || fc.hasFileField("sha256") {
+		var err error
+		if source, err = fc.readSource(entry, hasContent, diags); err != nil {
+			return nil, err
 		}
-		content := string(contentBytes)
-		content, err = fc.ApplyContentExclusions(content, entry.Format)
+	}
+	if hasContent {
+		result.Content = source.Content
+		result.HasContent = true
+		if fc.hasFileField("bytes_removed") {
+			removed := source.BytesRemoved
+			result.BytesRemoved = &removed
+		}
+	}
+
+	if err := fc.addFileFields(result, entry, source); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// readSource returns the processed source of entry, from the cache when
+// Config.Cache is set, and adds the problems met deriving it to diags.
+func (fc *FileCollector) readSource(entry FileEntry, hasContent bool, diags *diagnostics) (*sourceResult, error) {
+	if fc.cache != nil {
+		result, err := fc.cache.source(fc, entry, hasContent)
 		if err != nil {
-			return nil, fmt.Errorf("applying content exclusions to %s: %w", entry.SourcePath, err)
+			return nil, err
 		}
-		spaceRe := regexp.MustCompile(`\s+`)
-		compressedContent := spaceRe.ReplaceAllString(content, " ")
-		result["content"] = strings.TrimSpace(compressedContent)
+		diags.add(result.Diagnostics...)
+		return result, nil
 	}
+	source, err := os.ReadFile(entry.SourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading file %s: %w", entry.SourcePath, err)
+	}
+	result, err := fc.deriveSource(entry, source, hasContent)
+	if err != nil {
+		return nil, err
+	}
+	if fc.hasFileField("sha256") {
+		sum := sha256.Sum256(source)
+		result.SHA256 = hex.EncodeToString(sum[:])
+	}
+	diags.add(result.Diagnostics...)
+	return result, nil
+}
 
-	if len(result) == 0 {
-		return nil, nil
+// deriveSource counts the lines of source and, when hasContent is set,
+// builds the final content: the outline for "outline" entries, then content
+// exclusions and whitespace normalization.
+func (fc *FileCollector) deriveSource(entry FileEntry, source []byte, hasContent bool) (*sourceResult, error) {
+	result := &sourceResult{Lines: countLines(source)}
+	if !hasContent {
+		return result, nil
+	}
+	diags := &diagnostics{}
+	content := string(source)
+	if entry.Mode == "outline" {
+		content = outlineContent(content, entry, diags)
 	}
+	excluded, err := fc.applyContentExclusions(content, entry.Format, entry.SourcePath, diags)
+	if err != nil {
+		return nil, fmt.Errorf("applying content exclusions to %s: %w", entry.SourcePath, err)
+	}
+	result.BytesRemoved = int64(len(content) - len(excluded))
+	result.Content = NormalizeWhitespace(excluded, fc.Config.WhitespaceFor(entry.Format), fc.Config.TabWidth)
+	result.Diagnostics = diags.all()
 	return result, nil
 }
 
-func (fc *FileCollector) Run(progressCallback func(current, total int)) (int, string, error) {
-	filesToProcess, err := fc.PreviewFiles()
+// RunResult summarizes a finished collection run.
+type RunResult struct {
+	FileCount    int           // Number of entries written to the output
+	OutputSize   string        // Human-readable size of the output file
+	OutputBytes  int64         // Size of the output file in bytes
+	Tokenizer    string        // Name of the estimator used for token counts
+	TotalTokens  int           // Sum of FileTokens
+	FileTokens   []FileTokens  // Per-file token counts in output order
+	Degraded     []Degradation // Files changed or dropped to fit max_tokens / max_output_bytes
+	Parts        []string      // Part files written when Config.Chunking is enabled
+	IndexFile    string        // Index of the part files when Config.Chunking is enabled
+	CacheHits    int           // Files whose processed source came from the cache
+	CacheMisses  int           // Files processed and stored in the cache
+	Skipped      int           // Files left out because they could not be processed (on_error "skip")
+	Placeholders int           // Files written as placeholders because they could not be processed (on_error "placeholder")
+	Diagnostics  []Diagnostic  // Problems met listing and processing the files
+}
+
+// FileTokens is the token count of one output entry (path and content).
+type FileTokens struct {
+	Path   string
+	Tokens int
+}
+
+// processedEntry keeps a processed file together with its source entry.
+type processedEntry struct {
+	entry  FileEntry
+	file   ProcessedFile
+	tokens int
+	bytes  int64 // Approximate size of the entry in the JSON output
+	err    error // Set instead of file when the file could not be processed
+}
+
+// Tokenizer returns the estimator used for token counts.
+func (fc *FileCollector) Tokenizer() tokenizer.Estimator {
+	return fc.tokenizer
+}
+
+// countTokens estimates the tokens of a processed entry.
+func (fc *FileCollector) countTokens(file ProcessedFile) int {
+	return fc.tokenizer.Count(file.Path) + fc.tokenizer.Count(file.Content)
+}
+
+// Run collects the files and writes the output. When ctx is done it stops
+// walking and processing, removes the output written so far and returns
+// ctx's error; an existing output is left as it was. Files that cannot be
+// processed are handled according to Config.OnError, "fail" stopping the run
+// in the same way. The result is never
+// nil: when err is set, it holds only the diagnostics found before the run
+// stopped.
+func (fc *FileCollector) Run(ctx context.Context, progressCallback func(current, total int)) (*RunResult, error) {
+	diags := fc.newDiagnostics()
+	result, err := fc.run(ctx, progressCallback, diags)
+	if err != nil {
+		result = &RunResult{}
+	}
+	result.Diagnostics = diags.all()
+	return result, err
+}
+
+// run does the work of Run, adding problems to diags.
+func (fc *FileCollector) run(ctx context.Context, progressCallback func(current, total int), diags *diagnostics) (*RunResult, error) {
+	filesToProcess, err := fc.listFiles(ctx, diags)
 	if err != nil {
-		return 0, "", fmt.Errorf("error during file scanning phase: %w", err)
+		return nil, fmt.Errorf("error during file scanning phase: %w", err)
+	}
+
+	if len(filesToProcess) == 0 && progressCallback != nil {
+		progressCallback(0, 0)
 	}
 
-	outputData := OutputJSON{
-		ProjectFiles: []ProcessedFile{},
+	if fc.Config.Cache {
+		fc.cache = loadFileCache(fc.Config, diags)
+		defer func() {
+			// Processed files stay valid whether or not the output was written.
+			if err := fc.cache.save(filesToProcess); err != nil {
+				diags.warn(CodeCacheNotSaved, fc.cache.path, "could not save cache: %v", err)
+			}
+			fc.cache = nil
+		}()
 	}
 
-	if len(filesToProcess) == 0 {
-		if progressCallback != nil {
-			progressCallback(0, 0)
+	info := &OutputInfo{}
+	if fc.Config.Tree.Enabled {
+		if info.Tree, err = fc.buildTree(ctx, filesToProcess); err != nil {
+			return nil, err
 		}
-		jsonBytes, marshalErr := json.MarshalIndent(outputData, "", "  ")
-		if marshalErr != nil {
-			return 0, "", fmt.Errorf("marshaling empty output JSON: %w", marshalErr)
+	}
+	if fc.Config.Meta {
+		if info.Meta, err = fc.newMeta(diags); err != nil {
+			return nil, err
 		}
-		if err := os.WriteFile(fc.Config.Output, jsonBytes, 0644); err != nil {
-			return 0, "", fmt.Errorf("writing empty output file: %w", err)
+	}
+	fc.sizes = newWriterSizes(fc.newWriter, sizingInfo(info, filesToProcess))
+
+	result := &RunResult{Tokenizer: fc.tokenizer.Name()}
+	var out outputSink
+	if fc.Config.Chunking.Enabled {
+		out, err = fc.newChunkWriter(info, filesToProcess, result, diags)
+	} else {
+		out, err = createOutputFile(fc.Config.Output, fc.newWriter, info)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer out.abort()
+
+	// Stops the workers when on_error "fail" ends the run early.
+	processCtx, stopProcessing := context.WithCancel(ctx)
+	defer stopProcessing()
+
+	budget := fc.newBudgetFilter(result)
+	var collected []string // Files written, for the apply allowlist
+	write := func(entries []*processedEntry) error {
+		for _, r := range entries {
+			if err := out.write(r); err != nil {
+				return err
+			}
+			collected = append(collected, r.entry.OriginalPath)
+			result.FileCount++
+			result.FileTokens = append(result.FileTokens, FileTokens{Path: r.entry.Path, Tokens: r.tokens})
+			result.TotalTokens += r.tokens
+			if info.Meta != nil {
+				info.Meta.FileCount++
+				info.Meta.TotalBytes += r.entry.Size
+				info.Meta.TotalTokens += r.tokens
+			}
 		}
-		return 0, utils.FormatSize(int64(len(jsonBytes))), nil
+		return nil
 	}
 
-	var allProcessedFiles []ProcessedFile
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	numWorkers := runtime.NumCPU()
-	if numWorkers > len(filesToProcess) {
-		numWorkers = len(filesToProcess)
+	for r := range fc.processInOrder(processCtx, filesToProcess, progressCallback, diags) {
+		if err != nil {
+			continue // Drain the remaining results so the workers can exit.
+		}
+		if r != nil && r.err != nil {
+			if r, err = fc.handleFailure(r, result, diags); err != nil {
+				stopProcessing()
+				continue
+			}
+		}
+		if r != nil {
+			err = write(budget.push(r))
+		}
 	}
-	jobs := make(chan FileEntry, len(filesToProcess))
-	processedCount := 0
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	held, err := budget.flush()
+	if err != nil {
+		return nil, err
+	}
+	if err := write(held); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err // Checked last before the output replaces the previous one.
+	}
+
+	if err := out.commit(); err != nil {
+		return nil, err
+	}
+	if fc.Config.ApplyRestricted() {
+		if err := saveCollected(fc.Config.Root, collected); err != nil {
+			diags.warn(CodeCollectedNotSaved, filepath.Join(fc.Config.Root, StateDirName, collectedFileName), "could not record the collected files for apply_allowlist: %v", err)
+		}
+	}
+	result.OutputBytes = out.size()
+	result.OutputSize = utils.FormatSize(result.OutputBytes)
+	if fc.cache != nil {
+		result.CacheHits, result.CacheMisses = fc.cache.hits, fc.cache.misses
+	}
+	return result, nil
+}
+
+// handleFailure applies Config.OnError to an entry whose file could not be
+// processed. It returns the entry to write in its place, if any, or the
+// error that ends the run.
+func (fc *FileCollector) handleFailure(r *processedEntry, result *RunResult, diags *diagnostics) (*processedEntry, error) {
+	switch fc.Config.OnError {
+	case "fail":
+		return nil, fmt.Errorf("%w; on_error is \"fail\", output left unchanged", r.err)
+	case "placeholder":
+		diags.error(CodeProcessFailed, r.entry.SourcePath, "written as a placeholder: %v", r.err)
+		result.Placeholders++
+		placeholder := &processedEntry{
+			entry: r.entry,
+			file:  ProcessedFile{Path: r.entry.Path, Error: placeholderError(r.err)},
+		}
+		fc.measure(placeholder)
+		return placeholder, nil
+	default:
+		diags.error(CodeProcessFailed, r.entry.SourcePath, "left out of the output: %v", r.err)
+		result.Skipped++
+		return nil, nil
+	}
+}
+
+// placeholderError describes err for the output without the absolute path
+// of the source file, e.g. "open: permission denied".
+func placeholderError(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Op + ": " + pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+// processInOrder processes files on all CPUs and yields the results in the
+// order of files: an entry with err set for files that failed, nil for files
+// that produced no entry. At most a
+// small window of files is in flight, so memory stays bounded however many
+// files finish before a slow one that precedes them. When ctx is done no
+// further file is started and the channel is closed early; it is only closed
+// once every worker has returned.
+func (fc *FileCollector) processInOrder(ctx context.Context, files []FileEntry, progressCallback func(current, total int), diags *diagnostics) <-chan *processedEntry {
+	numWorkers := min(runtime.NumCPU(), len(files))
+	done := make([]chan *processedEntry, len(files))
+	for i := range done {
+		done[i] = make(chan *processedEntry, 1)
+	}
+	window := make(chan struct{}, 4*max(numWorkers, 1))
+	jobs := make(chan int)
+	ordered := make(chan *processedEntry)
+
+	go func() {
+		defer close(jobs)
+		for idx := range files {
+			select {
+			case window <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case jobs <- idx:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
 
+	var mu sync.Mutex
+	var workers sync.WaitGroup
+	processedCount := 0
 	for i := 0; i < numWorkers; i++ {
-		wg.Add(1)
+		workers.Add(1)
 		go func() {
-			defer wg.Done()
-			for entry := range jobs {
-				processed, err := fc.processFile(entry)
-				if err != nil {
-					fmt.Printf("Error processing file %s: %v\n", entry.SourcePath, err)
-					mu.Lock()
-					processedCount++
-					if progressCallback != nil {
-						progressCallback(processedCount, len(filesToProcess))
-					}
-					mu.Unlock()
+			defer workers.Done()
+			for idx := range jobs {
+				entry := files[idx]
+				var r *processedEntry
+				if ctx.Err() != nil {
+					done[idx] <- nil
 					continue
 				}
-				if processed != nil {
-					mu.Lock()
-					allProcessedFiles = append(allProcessedFiles, processed)
-					mu.Unlock()
+				processed, err := fc.processFile(entry, diags)
+				if err != nil {
+					r = &processedEntry{entry: entry, err: err}
+				} else if processed != nil {
+					r = &processedEntry{entry: entry, file: *processed}
+					fc.measure(r)
 				}
+				done[idx] <- r
 				mu.Lock()
 				processedCount++
 				if progressCallback != nil {
-					progressCallback(processedCount, len(filesToProcess))
+					progressCallback(processedCount, len(files))
 				}
 				mu.Unlock()
 			}
 		}()
 	}
 
-	for _, fileEntry := range filesToProcess {
-		jobs <- fileEntry
-	}
-	close(jobs)
-	wg.Wait()
-
-	if progressCallback != nil {
-		progressCallback(len(filesToProcess), len(filesToProcess))
-	}
-
-	outputData.ProjectFiles = allProcessedFiles
-	jsonBytes, err := json.MarshalIndent(outputData, "", "  ")
-	if err != nil {
-		return 0, "", fmt.Errorf("marshaling JSON output: %w", err)
-	}
-	err = os.WriteFile(fc.Config.Output, jsonBytes, 0644)
-	if err != nil {
-		return 0, "", fmt.Errorf("writing output file: %w", err)
-	}
-	return len(allProcessedFiles), utils.FormatSize(int64(len(jsonBytes))), nil
+	go func() {
+		defer close(ordered)
+		defer workers.Wait()
+		for idx := range files {
+			var r *processedEntry
+			select {
+			case r = <-done[idx]:
+			case <-ctx.Done():
+				return
+			}
+			done[idx] = nil
+			<-window
+			select {
+			case ordered <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ordered
 }
 
 // GetFileContent retrieves the raw content of a file given its original relative path.
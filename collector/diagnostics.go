@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Severity says how much a Diagnostic matters.
+type Severity string
+
+const (
+	// SeverityWarning marks a problem the collection worked around, such as
+	// a missing include path or a file that could not be outlined.
+	SeverityWarning Severity = "warning"
+	// SeverityError marks a file or setting that was left out of the output
+	// because it could not be used.
+	SeverityError Severity = "error"
+)
+
+// Diagnostic codes. They are stable, so scripts can match on them.
+const (
+	CodeInvalidExcludePattern = "invalid_exclude_pattern"
+	CodeInvalidIncludeGlob    = "invalid_include_glob"
+	CodeIncludeNotFound       = "include_not_found"
+	CodeUnreadablePath        = "unreadable_path"
+	CodeInvalidContentRule    = "invalid_content_rule"
+	CodeCommentStripFailed    = "comment_strip_failed"
+	CodeOutlineFailed         = "outline_failed"
+	CodeProcessFailed         = "process_failed"
+	CodeGitStateUnavailable   = "git_state_unavailable"
+	CodeCacheUnreadable       = "cache_unreadable"
+	CodeCacheNotSaved         = "cache_not_saved"
+	CodeCollectedNotSaved     = "collected_not_saved"
+	CodeStalePartNotRemoved   = "stale_part_not_removed"
+	CodeWatchFailed           = "watch_failed"
+)
+
+// Diagnostic is a problem found while listing or processing files that did
+// not stop the collection.
+type Diagnostic struct {
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	Path     string   `json:"path,omitempty"` // File or directory concerned, if any
+	Message  string   `json:"message"`
+}
+
+// String formats d as "severity: path: message [code]".
+func (d Diagnostic) String() string {
+	if d.Path == "" {
+		return fmt.Sprintf("%s: %s [%s]", d.Severity, d.Message, d.Code)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", d.Severity, d.Path, d.Message, d.Code)
+}
+
+// diagnostics gathers the diagnostics of one PreviewFiles or Run call. It is
+// safe for concurrent use, and a nil *diagnostics discards everything.
+// Repeats of a diagnostic, such as an invalid content rule met for every
+// file, are kept once.
+type diagnostics struct {
+	mu   sync.Mutex
+	list []Diagnostic
+	seen map[Diagnostic]bool
+}
+
+// newDiagnostics returns a diagnostics holding the ones fc found when it
+// was created.
+func (fc *FileCollector) newDiagnostics() *diagnostics {
+	d := &diagnostics{}
+	d.add(fc.setupDiagnostics...)
+	return d
+}
+
+func (d *diagnostics) add(list ...Diagnostic) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.seen == nil {
+		d.seen = make(map[Diagnostic]bool)
+	}
+	for _, diag := range list {
+		if !d.seen[diag] {
+			d.seen[diag] = true
+			d.list = append(d.list, diag)
+		}
+	}
+}
+
+func (d *diagnostics) warn(code, path, format string, args ...any) {
+	d.add(Diagnostic{Code: code, Severity: SeverityWarning, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *diagnostics) error(code, path, format string, args ...any) {
+	d.add(Diagnostic{Code: code, Severity: SeverityError, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// all returns a copy of the diagnostics gathered so far, sorted by path so
+// the order does not depend on worker scheduling. Those without a path come
+// first, in the order they were found.
+func (d *diagnostics) all() []Diagnostic {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	list := append([]Diagnostic(nil), d.list...)
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
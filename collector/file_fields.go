@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+)
+
+// hasFileField reports whether a per-file field is selected in Config.FileFields.
+func (fc *FileCollector) hasFileField(name string) bool {
+	for _, field := range fc.Config.FileFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addFileFields sets the selected fields that describe the source file.
+// source is the processed source, read when "lines" or "sha256" is selected.
+// "tokens" depends on the final content and is set by measure, and
+// "bytes_removed" by processFile.
+func (fc *FileCollector) addFileFields(file *ProcessedFile, entry FileEntry, source *sourceResult) error {
+	if fc.hasFileField("language") {
+		file.Language = fenceLanguage(entry.Format)
+	}
+	if fc.hasFileField("size_bytes") {
+		size := entry.Size
+		file.SizeBytes = &size
+	}
+	if fc.hasFileField("lines") {
+		lines := source.Lines
+		file.Lines = &lines
+	}
+	if fc.hasFileField("sha256") {
+		file.SHA256 = source.SHA256
+	}
+	if fc.hasFileField("mtime") {
+		info, err := os.Stat(entry.SourcePath)
+		if err != nil {
+			return fmt.Errorf("reading modification time of %s: %w", entry.SourcePath, err)
+		}
+		file.MTime = info.ModTime().UTC().Format(time.RFC3339)
+	}
+	return nil
+}
+
+// countLines counts lines the way editors number them: a final line without
+// a trailing newline counts, an empty file has none.
+func countLines(data []byte) int {
+	lines := bytes.Count(data, []byte{'\n'})
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
@@ -1,14 +1,53 @@
 package collector
 
+import "encoding/json"
+
 // FileEntry holds metadata for a file to be previewed or processed.
 type FileEntry struct {
 	Path         string `json:"path"`          // Relative path from root (including root's basename)
 	SourcePath   string `json:"-"`             // Full system path to the file
-	Mode         string `json:"-"`             // Collection mode ("path", "content", "both")
+	Mode         string `json:"-"`             // Collection mode ("path", "content", "both", "outline")
 	Size         int64  `json:"size_bytes"`    // File size in bytes
 	Format       string `json:"format"`        // File extension (e.g., "vue", "ts")
 	OriginalPath string `json:"original_path"` // Relative path from root (as per os.Rel)
+	Priority     int    `json:"-"`             // Priority of the include entry that matched the file
+	IncludeIndex int    `json:"-"`             // Position of that include entry among the include rules
+}
+
+// ProcessedFile is one entry of the output. Path is empty for entries
+// without a path (mode "content"); HasContent is false for entries without
+// content (mode "path"). The other fields are set only when selected in
+// Config.FileFields; their JSON names are the names used there.
+type ProcessedFile struct {
+	Path         string `json:"path,omitempty"`
+	Language     string `json:"language,omitempty"`      // Code block language of the format, e.g. "python"
+	SizeBytes    *int64 `json:"size_bytes,omitempty"`    // Size of the source file
+	Lines        *int   `json:"lines,omitempty"`         // Lines in the source file
+	Tokens       *int   `json:"tokens,omitempty"`        // Tokens of the entry's path and content
+	SHA256       string `json:"sha256,omitempty"`        // Hex SHA-256 of the source file
+	MTime        string `json:"mtime,omitempty"`         // Modification time of the source file, RFC 3339 UTC
+	BytesRemoved *int64 `json:"bytes_removed,omitempty"` // Bytes removed from the content by content_exclusions
+	Error        string `json:"error,omitempty"`         // Why the file could not be processed; set on on_error "placeholder" entries
+	Content      string `json:"-"`
+	HasContent   bool   `json:"-"`
 }
 
-// ProcessedFile represents the data extracted from a file for the output JSON.
-type ProcessedFile map[string]string // Typically {"path": "...", "content": "..."}
+// MarshalJSON writes the fields in declaration order with "content" last,
+// present whenever HasContent is set, even if empty.
+func (f ProcessedFile) MarshalJSON() ([]byte, error) {
+	type fields ProcessedFile // Drops the method to avoid recursion
+	out := struct {
+		fields
+		Content *string `json:"content,omitempty"`
+	}{fields: fields(f)}
+	if f.HasContent {
+		out.Content = &f.Content
+	}
+	return json.Marshal(out)
+}
+
+// withoutContent returns a copy of f reduced to its path and metadata.
+func (f ProcessedFile) withoutContent() ProcessedFile {
+	f.Content, f.HasContent = "", false
+	return f
+}
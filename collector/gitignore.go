@@ -0,0 +1,200 @@
+package collector
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// gitignorePattern is a single compiled line from a .gitignore-style file.
+type gitignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool // Pattern started with "!" and re-includes matches
+	dirOnly bool // Pattern ended with "/" and only matches directories
+}
+
+// gitignoreFile holds the patterns of one ignore file together with the
+// directory (relative to root, slash-separated, "" for root) they apply to.
+type gitignoreFile struct {
+	baseDir  string
+	patterns []gitignorePattern
+}
+
+// gitignoreMatcher evaluates paths against the global ignore file,
+// .git/info/exclude and every .gitignore between root and the path.
+// Nested .gitignore files are loaded lazily as directories are visited.
+type gitignoreMatcher struct {
+	root   string
+	global []gitignoreFile // global ignore file and .git/info/exclude, lowest precedence first
+
+	mu      sync.Mutex
+	perDir  map[string]*gitignoreFile // keyed by slash-separated dir relative to root
+	visited map[string]bool
+}
+
+// newGitignoreMatcher creates a matcher for root. globalFile is optional.
+func newGitignoreMatcher(root string, globalFile string) *gitignoreMatcher {
+	m := &gitignoreMatcher{
+		root:    root,
+		perDir:  make(map[string]*gitignoreFile),
+		visited: make(map[string]bool),
+	}
+	if globalFile != "" {
+		if f := loadGitignoreFile(expandHome(globalFile), ""); f != nil {
+			m.global = append(m.global, *f)
+		}
+	}
+	if f := loadGitignoreFile(filepath.Join(root, ".git", "info", "exclude"), ""); f != nil {
+		m.global = append(m.global, *f)
+	}
+	return m
+}
+
+// dirFile returns the parsed .gitignore of dir (relative to root), or nil.
+func (m *gitignoreMatcher) dirFile(dir string) *gitignoreFile {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.visited[dir] {
+		return m.perDir[dir]
+	}
+	m.visited[dir] = true
+	f := loadGitignoreFile(filepath.Join(m.root, filepath.FromSlash(dir), ".gitignore"), dir)
+	m.perDir[dir] = f
+	return f
+}
+
+// IsIgnored reports whether absPath is ignored. A path is also ignored when any
+// of its parent directories is, since git never descends into ignored directories.
+func (m *gitignoreMatcher) IsIgnored(absPath string, isDir bool) bool {
+	relPath, err := filepath.Rel(m.root, absPath)
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return false
+	}
+	relPath = filepath.ToSlash(relPath)
+
+	segments := strings.Split(relPath, "/")
+	for i := range segments {
+		if segments[i] == ".git" {
+			return true
+		}
+		current := strings.Join(segments[:i+1], "/")
+		currentIsDir := isDir || i < len(segments)-1
+		if m.matchSingle(current, currentIsDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSingle applies all applicable patterns to relPath; the last match wins.
+func (m *gitignoreMatcher) matchSingle(relPath string, isDir bool) bool {
+	ignored := false
+	apply := func(f *gitignoreFile) {
+		if f == nil {
+			return
+		}
+		target := relPath
+		if f.baseDir != "" {
+			if !strings.HasPrefix(relPath, f.baseDir+"/") {
+				return
+			}
+			target = strings.TrimPrefix(relPath, f.baseDir+"/")
+		}
+		for _, p := range f.patterns {
+			if p.dirOnly && !isDir {
+				continue
+			}
+			if p.re.MatchString(target) {
+				ignored = !p.negate
+			}
+		}
+	}
+
+	for i := range m.global {
+		apply(&m.global[i])
+	}
+	apply(m.dirFile(""))
+	dir := path.Dir(relPath)
+	if dir != "." {
+		parts := strings.Split(dir, "/")
+		for i := range parts {
+			apply(m.dirFile(strings.Join(parts[:i+1], "/")))
+		}
+	}
+	return ignored
+}
+
+// loadGitignoreFile parses an ignore file. It returns nil if the file cannot be read.
+func loadGitignoreFile(filePath string, baseDir string) *gitignoreFile {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	result := &gitignoreFile{baseDir: baseDir}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if p, ok := parseGitignoreLine(scanner.Text()); ok {
+			result.patterns = append(result.patterns, p)
+		}
+	}
+	return result
+}
+
+// parseGitignoreLine compiles a single line following gitignore(5) rules.
+func parseGitignoreLine(line string) (gitignorePattern, bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are ignored unless escaped with a backslash.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimSuffix(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return gitignorePattern{}, false
+	}
+
+	p := gitignorePattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return gitignorePattern{}, false
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to the
+	// directory of the .gitignore; otherwise it matches at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(?:.*/)?" + expr
+	}
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return gitignorePattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+// expandHome replaces a leading "~" with the user's home directory.
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") || strings.HasPrefix(p, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+	}
+	return p
+}
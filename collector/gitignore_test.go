@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGitignoreMatcher(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, root, ".gitignore", "*.log\n!keep.log\n/build\n!build/keep.go\ndocs/*.tmp\ncache/\n# comment\n\\#hash\n")
+	writeTestFile(t, root, "sub/.gitignore", "local.txt\n/anchored.txt\n!important.log\n")
+	writeTestFile(t, root, ".git/info/exclude", "secret.env\n")
+	m := newGitignoreMatcher(root, "")
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"a.log", false, true},
+		{"keep.log", false, false},            // Negated after "*.log"
+		{"sub/b.log", false, true},            // No slash: matches at any depth
+		{"sub/important.log", false, false},   // Negated by the nested .gitignore
+		{"build", true, true},                 // Anchored to the root
+		{"build/main.go", false, true},        // Inside an ignored directory
+		{"build/keep.go", false, true},        // Cannot be re-included below an ignored directory
+		{"sub/build/main.go", false, false},   // "/build" only matches at the root
+		{"docs/a.tmp", false, true},           // A slash in the middle anchors the pattern
+		{"docs/deep/a.tmp", false, false},     // "*" does not cross directories
+		{"sub/docs/a.tmp", false, false},      // Anchored patterns do not match deeper
+		{"cache", false, false},               // Directory-only pattern, but a file
+		{"cache", true, true},                 // Directory-only pattern on a directory
+		{"cache/x.go", false, true},           // Inside the directory
+		{"sub/local.txt", false, true},        // Nested .gitignore
+		{"sub/deeper/local.txt", false, true}, // Nested pattern without slash matches below it
+		{"local.txt", false, false},           // Nested patterns do not apply above their directory
+		{"sub/anchored.txt", false, true},     // Anchored to the directory of the .gitignore
+		{"sub/deeper/anchored.txt", false, false},
+		{"#hash", false, true}, // Escaped "#" is not a comment
+		{"comment", false, false},
+		{"secret.env", false, true},  // .git/info/exclude
+		{".git/config", false, true}, // .git is always skipped
+		{"main.go", false, false},
+	}
+	for _, tt := range tests {
+		if got := m.IsIgnored(filepath.Join(root, filepath.FromSlash(tt.path)), tt.isDir); got != tt.ignored {
+			t.Errorf("IsIgnored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.ignored)
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
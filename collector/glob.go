@@ -0,0 +1,204 @@
+package collector
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// globRule is a compiled entry of exclude_patterns. Rules are evaluated in
+// order and the last matching rule decides, so a "!pattern" re-includes
+// paths excluded by earlier rules.
+type globRule struct {
+	pattern   string
+	negate    bool
+	regex     *regexp.Regexp // Set for "/regex/" entries, matched like before (base name, relative or full path)
+	glob      *regexp.Regexp // Set for glob entries
+	matchBase bool           // Glob has no slash and is matched against the base name only
+}
+
+// matches reports whether the rule applies to a path. relPath must be slash-separated.
+func (r globRule) matches(baseName, relPath, fullPath string) bool {
+	if r.regex != nil {
+		return r.regex.MatchString(baseName) || r.regex.MatchString(relPath) || r.regex.MatchString(fullPath)
+	}
+	if r.matchBase {
+		return r.glob.MatchString(baseName)
+	}
+	return r.glob.MatchString(relPath)
+}
+
+// compileGlobRule compiles an exclude pattern: "!" negation, "/regex/" or a glob.
+func compileGlobRule(pattern string) (globRule, error) {
+	rule := globRule{pattern: pattern}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return rule, err
+		}
+		rule.regex = re
+		return rule, nil
+	}
+
+	pattern = filepath.ToSlash(pattern)
+	pattern = strings.TrimSuffix(pattern, "/")
+	rule.matchBase = !strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	re, err := compileGlob(pattern)
+	if err != nil {
+		return rule, err
+	}
+	rule.glob = re
+	return rule, nil
+}
+
+// CompileGlob compiles a glob as used in include and exclude_patterns, with
+// "**" and brace expansion, into a regular expression matching whole
+// slash-separated paths.
+func CompileGlob(pattern string) (*regexp.Regexp, error) {
+	return compileGlob(strings.TrimPrefix(filepath.ToSlash(pattern), "./"))
+}
+
+// compileGlob compiles a slash-separated glob with "**" and brace expansion
+// ("*.{ts,tsx}") into an anchored regular expression.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	alternatives := expandBraces(pattern)
+	parts := make([]string, 0, len(alternatives))
+	for _, alt := range alternatives {
+		parts = append(parts, globToRegexp(alt))
+	}
+	re, err := regexp.Compile("^(?:" + strings.Join(parts, "|") + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// expandBraces expands the first top-level {a,b} group recursively,
+// e.g. "src/*.{ts,tsx}" becomes ["src/*.ts", "src/*.tsx"].
+func expandBraces(pattern string) []string {
+	start := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				prefix, body, suffix := pattern[:start], pattern[start+1:i], pattern[i+1:]
+				options := splitBraceBody(body)
+				if len(options) < 2 {
+					// "{x}" is not an alternation; keep it literal.
+					return prefixAll(pattern[:i+1], expandBraces(suffix))
+				}
+				var result []string
+				for _, opt := range options {
+					result = append(result, expandBraces(prefix+opt+suffix)...)
+				}
+				return result
+			}
+		}
+	}
+	return []string{pattern}
+}
+
+// splitBraceBody splits the contents of a brace group on top-level commas.
+func splitBraceBody(body string) []string {
+	var options []string
+	depth, last := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch body[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				options = append(options, body[last:i])
+				last = i + 1
+			}
+		}
+	}
+	return append(options, body[last:])
+}
+
+func prefixAll(prefix string, items []string) []string {
+	result := make([]string, len(items))
+	for i, item := range items {
+		result[i] = prefix + item
+	}
+	return result
+}
+
+// globToRegexp translates a slash-separated glob with "**" support into a regexp fragment.
+// "**/" matches zero or more directories and a trailing "/**" matches everything inside.
+func globToRegexp(pattern string) string {
+	var b strings.Builder
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		last := i == len(segments)-1
+		if seg == "**" {
+			if last {
+				b.WriteString(".*")
+			} else {
+				b.WriteString("(?:.*/)?")
+			}
+			continue
+		}
+		b.WriteString(globSegmentToRegexp(seg))
+		if !last {
+			b.WriteString("/")
+		}
+	}
+	return b.String()
+}
+
+// globSegmentToRegexp translates one path segment of a glob ("*", "?", "[...]", "\x").
+func globSegmentToRegexp(seg string) string {
+	var b strings.Builder
+	for i := 0; i < len(seg); i++ {
+		c := seg[i]
+		switch c {
+		case '*':
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '\\':
+			if i+1 < len(seg) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(seg[i])))
+			}
+		case '[':
+			end := strings.IndexByte(seg[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := seg[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,100 @@
+package collector
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"*.go", []string{"*.go"}},
+		{"src/*.{ts,tsx}", []string{"src/*.ts", "src/*.tsx"}},
+		{"{a,b}/{c,d}", []string{"a/c", "a/d", "b/c", "b/d"}},
+		{"{a,{b,c}}.txt", []string{"a.txt", "b.txt", "c.txt"}},
+		{"{x}.{y,z}", []string{"{x}.y", "{x}.z"}}, // A single option is literal
+		{`\{a,b\}`, []string{`\{a,b\}`}},          // Escaped braces
+		{"a}{b", []string{"a}{b"}},                // Unbalanced
+		{"{,.min}.js", []string{".js", ".min.js"}},
+	}
+	for _, tt := range tests {
+		if got := expandBraces(tt.pattern); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandBraces(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestCompileGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false}, // "*" does not cross directories
+		{"**/*.go", "main.go", true},   // "**/" matches zero directories
+		{"**/*.go", "cmd/cli/main.go", true},
+		{"src/**/test", "src/test", true},
+		{"src/**/test", "src/a/b/test", true},
+		{"src/**/test", "srcx/test", false},
+		{"docs/**", "docs/a/b.md", true}, // A trailing "/**" matches everything inside
+		{"docs/**", "docs", false},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "ab.txt", false},
+		{"?.txt", "/.txt", false},
+		{"[abc].go", "b.go", true},
+		{"[abc].go", "d.go", false},
+		{"[!abc].go", "d.go", true},
+		{"[!abc].go", "a.go", false},
+		{"[a-c]x", "bx", true},
+		{"src/*.{ts,tsx}", "src/a.tsx", true},
+		{"src/*.{ts,tsx}", "src/a.js", false},
+		{"a.b", "axb", false}, // Regexp metacharacters are literal
+		{`\*.md`, "*.md", true},
+		{`\*.md`, "a.md", false},
+		{"./main.go", "main.go", true},
+	}
+	for _, tt := range tests {
+		re, err := CompileGlob(tt.pattern)
+		if err != nil {
+			t.Errorf("CompileGlob(%q): %v", tt.pattern, err)
+			continue
+		}
+		if got := re.MatchString(tt.path); got != tt.match {
+			t.Errorf("CompileGlob(%q) matching %q = %v, want %v (regexp %s)", tt.pattern, tt.path, got, tt.match, re)
+		}
+	}
+}
+
+func TestGlobRuleMatches(t *testing.T) {
+	tests := []struct {
+		pattern string
+		relPath string
+		match   bool
+		negate  bool
+	}{
+		{"*.log", "a/b/c.log", true, false}, // No slash: matched against the base name
+		{"/build", "build", true, false},
+		{"/build", "src/build", false, false},
+		{"vendor/", "vendor", true, false},
+		{"!keep.log", "keep.log", true, true},
+		{"/_test\\.go$/", "pkg/a_test.go", true, false},
+		{"/^cmd/", "cmd/cli/main.go", true, false},
+	}
+	for _, tt := range tests {
+		rule, err := compileGlobRule(tt.pattern)
+		if err != nil {
+			t.Errorf("compileGlobRule(%q): %v", tt.pattern, err)
+			continue
+		}
+		if got := rule.matches(path.Base(tt.relPath), tt.relPath, "/root/"+tt.relPath); got != tt.match || rule.negate != tt.negate {
+			t.Errorf("compileGlobRule(%q) on %q = %v (negate %v), want %v (negate %v)", tt.pattern, tt.relPath, got, rule.negate, tt.match, tt.negate)
+		}
+	}
+	if _, err := compileGlobRule("/[/"); err == nil {
+		t.Error(`compileGlobRule("/[/") succeeded, want an error`)
+	}
+}
@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"projectson/gitinfo"
+	"runtime/debug"
+	"time"
+)
+
+// Version is the projectson version recorded in the meta object. Release
+// builds set it with -ldflags "-X projectson/collector.Version=v1.2.3";
+// otherwise the module version from the build info is used when known.
+var Version = "dev"
+
+func init() {
+	if Version != "dev" {
+		return
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		Version = info.Main.Version
+	}
+}
+
+// Meta describes how and from what an output was generated. It is written
+// when Config.Meta is set.
+type Meta struct {
+	GeneratedAt  string        `json:"generated_at"` // RFC 3339, UTC
+	Version      string        `json:"version"`
+	ConfigPath   string        `json:"config_path,omitempty"`
+	ConfigSHA256 string        `json:"config_sha256"` // See config.Config.SHA256
+	Root         string        `json:"root"`          // Basename of the project root
+	FileCount    int           `json:"file_count"`
+	TotalBytes   int64         `json:"total_bytes"` // Sum of the source file sizes of the written entries
+	TotalTokens  int           `json:"total_tokens"`
+	Git          *gitinfo.Info `json:"git,omitempty"`  // Set when the root is inside a git work tree
+	Part         int           `json:"part,omitempty"` // 1-based part number in chunked output; the totals are those of the part
+}
+
+// newMeta fills the parts of the meta object known before any file is
+// written. The totals are added by Run as entries are written. A git state
+// that cannot be read is left out and reported to diags.
+func (fc *FileCollector) newMeta(diags *diagnostics) (*Meta, error) {
+	configHash, err := fc.Config.SHA256()
+	if err != nil {
+		return nil, fmt.Errorf("hashing config: %w", err)
+	}
+	meta := &Meta{
+		GeneratedAt:  time.Now().UTC().Format(time.RFC3339),
+		Version:      Version,
+		ConfigPath:   fc.Config.ConfigPath,
+		ConfigSHA256: configHash,
+		Root:         filepath.Base(fc.Config.Root),
+	}
+	if meta.ConfigPath != "" {
+		if abs, err := filepath.Abs(meta.ConfigPath); err == nil {
+			meta.ConfigPath = abs
+		}
+	}
+	// Read before the output is written, as it may be a tracked file.
+	meta.Git, err = gitinfo.Read(fc.Config.Root)
+	if err != nil {
+		diags.warn(CodeGitStateUnavailable, fc.Config.Root, "could not read git state: %v", err)
+		meta.Git = nil
+	}
+	return meta, nil
+}
+
+// sizingInfo returns a copy of info for measuring entries against the
+// budgets. Its meta object holds the largest totals the run can reach, so
+// the space reserved for the real one is never too small.
+func sizingInfo(info *OutputInfo, files []FileEntry) *OutputInfo {
+	if info.Meta == nil {
+		return info
+	}
+	meta := *info.Meta
+	meta.FileCount = len(files)
+	meta.TotalBytes = 0
+	for _, f := range files {
+		meta.TotalBytes += f.Size
+	}
+	meta.TotalTokens = math.MaxInt32
+	sized := *info
+	sized.Meta = &meta
+	return &sized
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// outlineBody replaces function bodies in an outline.
+const outlineBody = "{ ... }"
+
+// GoOutline reduces Go source to its API surface: the package clause,
+// imports, type, const and var declarations, function and method signatures
+// and their doc comments. Every function body, including function literals
+// in top-level declarations, is replaced by "{ ... }".
+func GoOutline(src string) (string, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return "", fmt.Errorf("parsing Go source: %w", err)
+	}
+
+	var bodies []*ast.BlockStmt
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Body != nil {
+				bodies = append(bodies, d.Body)
+			}
+		case *ast.GenDecl:
+			ast.Inspect(d, func(n ast.Node) bool {
+				if lit, ok := n.(*ast.FuncLit); ok {
+					bodies = append(bodies, lit.Body)
+					return false
+				}
+				return true
+			})
+		}
+	}
+	sort.Slice(bodies, func(i, j int) bool { return bodies[i].Lbrace < bodies[j].Lbrace })
+
+	tokFile := fset.File(file.Package)
+	var b strings.Builder
+	b.Grow(len(src))
+	last := 0
+	for _, body := range bodies {
+		start := tokFile.Offset(body.Lbrace)
+		end := tokFile.Offset(body.Rbrace) + 1
+		b.WriteString(src[last:start])
+		b.WriteString(outlineBody)
+		last = end
+	}
+	b.WriteString(src[last:])
+	return b.String(), nil
+}
+
+// outlineContent returns the outline of a Go file, or content unchanged for
+// other formats. Go files that fail to parse are collected in full and
+// reported to diags.
+func outlineContent(content string, entry FileEntry, diags *diagnostics) string {
+	if entry.Format != "go" {
+		return content
+	}
+	outline, err := GoOutline(content)
+	if err != nil {
+		diags.warn(CodeOutlineFailed, entry.SourcePath, "cannot outline, collecting full content: %v", err)
+		return content
+	}
+	return outline
+}
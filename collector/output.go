@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"projectson/utils"
+)
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// outputSink receives the entries of a run in output order. Nothing is
+// visible at the output paths until commit.
+type outputSink interface {
+	write(e *processedEntry) error
+	commit() error
+	abort()
+	size() int64
+}
+
+// outputFile streams entries into a temporary file that replaces
+// Config.Output only when the whole document has been written.
+type outputFile struct {
+	file    *utils.AtomicFile
+	buf     *bufio.Writer
+	counter *countingWriter
+	writer  Writer
+}
+
+func createOutputFile(path string, newWriter writerFactory, info *OutputInfo) (*outputFile, error) {
+	file, err := utils.CreateAtomicFile(path)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriterSize(file, 64*1024)
+	counter := &countingWriter{w: buf}
+	out := &outputFile{file: file, buf: buf, counter: counter, writer: newWriter(counter, info)}
+	if err := out.writer.Begin(); err != nil {
+		file.Abort()
+		return nil, fmt.Errorf("writing output file: %w", err)
+	}
+	return out, nil
+}
+
+func (o *outputFile) write(e *processedEntry) error {
+	if err := o.writer.WriteFile(e.entry, e.file); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return nil
+}
+
+// finish ends the document and flushes it to the temporary file.
+func (o *outputFile) finish() error {
+	if err := o.writer.End(); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	if err := o.buf.Flush(); err != nil {
+		return fmt.Errorf("writing output file: %w", err)
+	}
+	return nil
+}
+
+// stage finishes the document and closes the temporary file, leaving only
+// the rename to commit.
+func (o *outputFile) stage() error {
+	if err := o.finish(); err != nil {
+		return err
+	}
+	return o.file.Stage(0644)
+}
+
+// commit finishes the document and moves it into place.
+func (o *outputFile) commit() error {
+	if err := o.finish(); err != nil {
+		return err
+	}
+	return o.file.Commit(0644)
+}
+
+// abort removes the temporary file; a no-op after commit.
+func (o *outputFile) abort() {
+	o.file.Abort()
+}
+
+// size returns the bytes written so far.
+func (o *outputFile) size() int64 {
+	return o.counter.n
+}
@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// TemplateFile is a collected file as seen by output templates.
+type TemplateFile struct {
+	Path         string        // Path in the output, including the root basename
+	OriginalPath string        // Path relative to the root
+	Format       string        // Lower-cased file extension without the dot
+	Mode         string        // Include mode: "path", "content", "both" or "outline"
+	Size         int64         // Size of the source file in bytes
+	Content      string        // Processed content; empty for path-only entries
+	HasContent   bool          // Whether the entry has content, which may be empty
+	HasPath      bool          // Whether the entry includes its path
+	Error        string        // Why the file could not be processed; set on on_error "placeholder" entries
+	File         ProcessedFile // The entry as written to JSON, with the fields selected in file_fields
+}
+
+// TemplateRun is the run metadata available to output templates.
+type TemplateRun struct {
+	Root        string // Basename of the project root
+	FileCount   int
+	TotalTokens int
+	TotalSize   int64 // Sum of the source file sizes in bytes
+	Tokenizer   string
+}
+
+// TemplateData is the value an output template is executed with.
+type TemplateData struct {
+	Files []TemplateFile
+	Run   TemplateRun
+	Tree  string // Project tree configured by Config.Tree; empty when disabled
+	Meta  *Meta  // Meta object when Config.Meta is set; nil otherwise
+}
+
+// parseOutputTemplate reads Config.OutputTemplate with the template helper functions.
+func (fc *FileCollector) parseOutputTemplate() (*template.Template, error) {
+	data, err := os.ReadFile(fc.Config.OutputTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("reading output template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(fc.Config.OutputTemplate)).Funcs(fc.templateFuncs()).Parse(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing output template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// templateFuncs returns the helper functions available to output templates:
+//   - lang: the code block language of a file format or path ("py" -> "python"),
+//   - indent: prefixes every non-empty line of a string with n spaces,
+//   - tokens: the token count of a string with the configured tokenizer,
+//   - tree: a directory tree of a list of files (.Files).
+func (fc *FileCollector) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"lang": func(formatOrPath string) string {
+			if strings.ContainsAny(formatOrPath, `./\`) {
+				formatOrPath = fileFormat(formatOrPath)
+			}
+			return fenceLanguage(strings.ToLower(formatOrPath))
+		},
+		"indent": func(n int, s string) string {
+			pad := strings.Repeat(" ", n)
+			lines := strings.Split(s, "\n")
+			for i, line := range lines {
+				if line != "" {
+					lines[i] = pad + line
+				}
+			}
+			return strings.Join(lines, "\n")
+		},
+		"tokens": func(s string) int {
+			return fc.tokenizer.Count(s)
+		},
+		"tree": func(files []TemplateFile) string {
+			paths := make([]string, len(files))
+			for i, f := range files {
+				paths[i] = f.Path
+			}
+			return RenderTree(paths, nil, TreeOptions{})
+		},
+	}
+}
+
+// templateWriter collects the entries and executes the output template with
+// all of them in End, so templates can refer to the whole file list anywhere.
+// Unlike the other writers it holds every entry, content included, until End.
+type templateWriter struct {
+	w     io.Writer
+	info  *OutputInfo
+	tmpl  *template.Template
+	fc    *FileCollector
+	files []TemplateFile
+}
+
+func (t *templateWriter) Begin() error { return nil }
+
+func (t *templateWriter) WriteFile(entry FileEntry, file ProcessedFile) error {
+	path := file.Path
+	if path == "" {
+		path = entry.Path
+	}
+	t.files = append(t.files, TemplateFile{
+		Path:         path,
+		OriginalPath: entry.OriginalPath,
+		Format:       entry.Format,
+		Mode:         entry.Mode,
+		Size:         entry.Size,
+		Content:      file.Content,
+		HasContent:   file.HasContent,
+		HasPath:      file.Path != "",
+		Error:        file.Error,
+		File:         file,
+	})
+	return nil
+}
+
+// entryBytes measures file as the difference between the template executed
+// with an empty entry and file, and with the empty entry alone. The tree is
+// left out, so the cost does not grow with the project.
+func (t *templateWriter) entryBytes(entry FileEntry, file ProcessedFile) int64 {
+	var sizes [2]int64
+	for i := range sizes {
+		counter := &countingWriter{w: io.Discard}
+		w := &templateWriter{w: counter, info: &OutputInfo{Meta: t.info.Meta}, tmpl: t.tmpl, fc: t.fc}
+		_ = w.WriteFile(FileEntry{}, ProcessedFile{})
+		if i == 1 {
+			_ = w.WriteFile(entry, file)
+		}
+		_ = w.End()
+		sizes[i] = counter.n
+	}
+	return sizes[1] - sizes[0]
+}
+
+func (t *templateWriter) End() error {
+	run := TemplateRun{
+		Root:      filepath.Base(t.fc.Config.Root),
+		FileCount: len(t.files),
+		Tokenizer: t.fc.tokenizer.Name(),
+	}
+	for _, f := range t.files {
+		run.TotalSize += f.Size
+		run.TotalTokens += t.fc.tokenizer.Count(f.Content)
+		if f.HasPath {
+			run.TotalTokens += t.fc.tokenizer.Count(f.Path)
+		}
+	}
+	if err := t.tmpl.Execute(t.w, TemplateData{Files: t.files, Run: run, Tree: t.info.Tree, Meta: t.info.Meta}); err != nil {
+		return fmt.Errorf("executing output template: %w", err)
+	}
+	return nil
+}
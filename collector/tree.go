@@ -0,0 +1,210 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// uncollectedMark follows files and directories in the tree that exist but
+// are not part of the output.
+const uncollectedMark = " [not collected]"
+
+// TreeOptions controls how RenderTree draws a tree.
+type TreeOptions struct {
+	MaxDepth     int // Levels shown below the root; deeper directories are collapsed. 0 shows all
+	CollapseOver int // Directories with more entries are collapsed. 0 never collapses
+}
+
+// treeNode is a directory or file in a rendered tree.
+type treeNode struct {
+	name      string
+	children  map[string]*treeNode
+	collected bool // The file, or any file below the directory, is collected
+}
+
+func (n *treeNode) child(name string) *treeNode {
+	if n.children == nil {
+		n.children = make(map[string]*treeNode)
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &treeNode{name: name}
+		n.children[name] = c
+	}
+	return c
+}
+
+func (n *treeNode) isDir() bool {
+	return n.children != nil
+}
+
+// add inserts a file path, marking the nodes on its way as collected.
+func (n *treeNode) add(path string, collected bool) {
+	node := n
+	for _, part := range strings.Split(strings.Trim(filepath.ToSlash(path), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		node = node.child(part)
+		node.collected = node.collected || collected
+	}
+}
+
+// sortedChildren returns directories first, then files, each sorted by name.
+func (n *treeNode) sortedChildren() []*treeNode {
+	children := make([]*treeNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].isDir() != children[j].isDir() {
+			return children[i].isDir()
+		}
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+// RenderTree draws file paths as a directory tree. Paths in uncollected are
+// drawn with a "[not collected]" mark, as are directories holding only such
+// files. Collapsed directories show their number of entries instead of them:
+//
+//	myproject/
+//	├── node_modules/ (412 entries)
+//	├── src/
+//	│   ├── main.go
+//	│   └── main_test.go [not collected]
+//	└── README.md
+func RenderTree(paths, uncollected []string, opts TreeOptions) string {
+	root := &treeNode{}
+	for _, path := range paths {
+		root.add(path, true)
+	}
+	for _, path := range uncollected {
+		root.add(path, false)
+	}
+	var b strings.Builder
+	children := root.sortedChildren()
+	if len(children) == 1 && children[0].isDir() {
+		// The common case: every path starts with the root's basename.
+		writeTreeLine(&b, "", children[0], opts, 0)
+		renderTreeLevel(&b, children[0], "", opts, 1)
+	} else {
+		renderTreeLevel(&b, root, "", opts, 1)
+	}
+	return b.String()
+}
+
+func renderTreeLevel(b *strings.Builder, node *treeNode, prefix string, opts TreeOptions, depth int) {
+	children := node.sortedChildren()
+	for i, c := range children {
+		branch, indent := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		if writeTreeLine(b, prefix+branch, c, opts, depth) {
+			renderTreeLevel(b, c, prefix+indent, opts, depth+1)
+		}
+	}
+}
+
+// writeTreeLine writes the line of node and reports whether its children
+// should follow.
+func writeTreeLine(b *strings.Builder, prefix string, node *treeNode, opts TreeOptions, depth int) bool {
+	b.WriteString(prefix + node.name)
+	expand := false
+	if node.isDir() {
+		b.WriteString("/")
+		collapsed := (opts.MaxDepth > 0 && depth >= opts.MaxDepth) || (opts.CollapseOver > 0 && depth > 0 && len(node.children) > opts.CollapseOver)
+		if collapsed && len(node.children) == 1 {
+			b.WriteString(" (1 entry)")
+		} else if collapsed {
+			fmt.Fprintf(b, " (%d entries)", len(node.children))
+		}
+		expand = !collapsed
+	}
+	if !node.collected {
+		b.WriteString(uncollectedMark)
+	}
+	b.WriteString("\n")
+	return expand
+}
+
+// buildTree renders the tree section for Config.Tree from the previewed files.
+func (fc *FileCollector) buildTree(ctx context.Context, files []FileEntry) (string, error) {
+	paths := make([]string, len(files))
+	collected := make(map[string]bool, len(files))
+	for i, f := range files {
+		paths[i] = f.Path
+		collected[f.Path] = true
+	}
+	var uncollected []string
+	if fc.Config.Tree.ShowUncollected {
+		var err error
+		uncollected, err = fc.uncollectedFiles(ctx, collected)
+		if err != nil {
+			return "", err
+		}
+	}
+	return RenderTree(paths, uncollected, TreeOptions{
+		MaxDepth:     fc.Config.Tree.MaxDepth,
+		CollapseOver: fc.Config.Tree.CollapseOver,
+	}), nil
+}
+
+// uncollectedFiles lists the files below root that are not excluded by
+// exclude_patterns or gitignore rules but are missing from collected, in the
+// same "<root basename>/<relative path>" form as FileEntry.Path. The output
+// file and .git are left out.
+func (fc *FileCollector) uncollectedFiles(ctx context.Context, collected map[string]bool) ([]string, error) {
+	ignore := fc.newIgnoreMatcher()
+	rootName := filepath.Base(fc.Config.Root)
+	output, _ := filepath.Abs(fc.Config.Output)
+	var files []string
+	err := filepath.WalkDir(fc.Config.Root, func(path string, d fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if os.IsPermission(err) {
+				return nil
+			}
+			return err
+		}
+		if path == fc.Config.Root {
+			return nil
+		}
+		if d.IsDir() && (d.Name() == ".git" || isStateDir(d.Name())) {
+			return filepath.SkipDir
+		}
+		if fc.shouldSkip(path, d.IsDir(), ignore) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if abs, _ := filepath.Abs(path); abs == output {
+			return nil
+		}
+		relPath, err := filepath.Rel(fc.Config.Root, path)
+		if err != nil {
+			return nil
+		}
+		if outputPath := filepath.Join(rootName, relPath); !collected[outputPath] {
+			files = append(files, outputPath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing files for the tree: %w", err)
+	}
+	return files, nil
+}
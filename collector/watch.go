@@ -0,0 +1,236 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultDebounce is how long Watch waits after the last change before it
+// runs the collection again.
+const DefaultDebounce = 300 * time.Millisecond
+
+// WatchDirs returns the directories a run reads: every directory
+// PreviewFiles walks for the includes, skipping excluded and ignored ones,
+// the parent of each single-file include, and the whole root when the tree
+// lists uncollected files. A missing include path is watched through its
+// closest existing parent, so creating it triggers a run.
+func (fc *FileCollector) WatchDirs(ctx context.Context) ([]string, error) {
+	ignore := fc.newIgnoreMatcher()
+	found := make(map[string]bool)
+	addTree := func(dir string) error {
+		return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if err != nil {
+				if os.IsPermission(err) || os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			if path != dir && (isStateDir(d.Name()) || fc.shouldSkip(path, true, ignore)) {
+				return filepath.SkipDir
+			}
+			found[path] = true
+			return nil
+		})
+	}
+
+	if fc.Config.Tree.Enabled && fc.Config.Tree.ShowUncollected {
+		if err := addTree(fc.Config.Root); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, include := range fc.parseInclude() {
+			if include.Negate {
+				continue
+			}
+			path := filepath.Join(fc.Config.Root, include.Path)
+			if include.IsGlob {
+				pattern := strings.TrimPrefix(filepath.ToSlash(include.Path), "/")
+				path = filepath.Join(fc.Config.Root, filepath.FromSlash(globBaseDir(pattern)))
+			}
+			info, err := os.Stat(path)
+			switch {
+			case os.IsNotExist(err):
+				found[existingParent(path, fc.Config.Root)] = true
+			case err != nil:
+				return nil, fmt.Errorf("error stating include path %s: %w", path, err)
+			case !info.IsDir():
+				found[filepath.Dir(path)] = true
+			case include.IsDirOnlyFiles:
+				found[path] = true
+			default:
+				if err := addTree(path); err != nil {
+					return nil, fmt.Errorf("error walking directory %s: %w", path, err)
+				}
+			}
+		}
+	}
+
+	dirs := make([]string, 0, len(found))
+	for dir := range found {
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// existingParent returns the closest existing directory above path, stopping
+// at root.
+func existingParent(path, root string) string {
+	for path != root {
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return path
+		}
+	}
+	return root
+}
+
+// Watch calls run, which is expected to call Run with ctx, then calls it again
+// whenever something changes in the directories of WatchDirs, until ctx is
+// done. Changes are debounced: run is called once no change has been seen
+// for debounce. The watched directories are updated before every call, so
+// new directories are picked up and removed ones dropped. Problems with the
+// watcher itself are passed to report, which may be nil.
+func (fc *FileCollector) Watch(ctx context.Context, debounce time.Duration, run func(), report func(Diagnostic)) error {
+	if debounce <= 0 {
+		debounce = DefaultDebounce
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("starting file watcher: %w", err)
+	}
+	defer fsw.Close()
+
+	if report == nil {
+		report = func(Diagnostic) {}
+	}
+	w := &watcher{fc: fc, fsw: fsw, dirs: make(map[string]bool), report: report}
+	w.sync(ctx)
+	run()
+
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if w.relevant(event) {
+				fire = time.After(debounce)
+			}
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			w.warn("", "file watcher: %v", err)
+		case <-fire:
+			fire = nil
+			w.sync(ctx)
+			run()
+		}
+	}
+}
+
+// watcher keeps an fsnotify watcher on the directories of WatchDirs.
+type watcher struct {
+	fc     *FileCollector
+	fsw    *fsnotify.Watcher
+	dirs   map[string]bool
+	ignore *gitignoreMatcher
+	report func(Diagnostic)
+}
+
+func (w *watcher) warn(path, format string, args ...any) {
+	w.report(Diagnostic{Code: CodeWatchFailed, Severity: SeverityWarning, Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// sync watches the current WatchDirs and stops watching the others.
+func (w *watcher) sync(ctx context.Context) {
+	w.ignore = w.fc.newIgnoreMatcher()
+	dirs, err := w.fc.WatchDirs(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		w.warn("", "could not list directories to watch: %v", err)
+		return
+	}
+	want := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		want[dir] = true
+		if w.dirs[dir] {
+			continue
+		}
+		if err := w.fsw.Add(dir); err != nil {
+			w.warn(dir, "could not watch directory: %v", err)
+			continue
+		}
+		w.dirs[dir] = true
+	}
+	for dir := range w.dirs {
+		if !want[dir] {
+			w.fsw.Remove(dir) // Fails harmlessly for directories already removed
+			delete(w.dirs, dir)
+		}
+	}
+}
+
+// relevant reports whether event can change the output. Events on the
+// files a run writes, on the cache and state directories and on excluded
+// paths are not.
+func (w *watcher) relevant(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	if w.fc.isOutputFile(event.Name) {
+		return false
+	}
+	for _, segment := range strings.Split(filepath.ToSlash(event.Name), "/") {
+		if isStateDir(segment) {
+			return false
+		}
+	}
+	info, err := os.Stat(event.Name)
+	isDir := err == nil && info.IsDir()
+	return !w.fc.shouldSkip(event.Name, isDir, w.ignore)
+}
+
+// isOutputFile reports whether path is written by a run: the output, its
+// part files or index, or the temporary file of one of them.
+func (fc *FileCollector) isOutputFile(path string) bool {
+	dir, name := filepath.Split(path)
+	if i := strings.LastIndex(name, ".tmp-"); strings.HasPrefix(name, ".") && i > 1 {
+		name = name[1:i] // See utils.CreateAtomicFile
+	}
+	abs, err := filepath.Abs(filepath.Join(dir, name))
+	if err != nil {
+		return false
+	}
+	output, err := filepath.Abs(fc.Config.Output)
+	if err != nil {
+		return false
+	}
+	if abs == output || abs == ChunkIndexPath(output) {
+		return true
+	}
+	ext := filepath.Ext(output)
+	return strings.HasPrefix(abs, strings.TrimSuffix(output, ext)+".part-") && strings.HasSuffix(abs, ext)
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"regexp"
+	"strings"
+)
+
+// DefaultTabWidth is the tab stop width used by the "tabs_to_spaces" policy.
+const DefaultTabWidth = 4
+
+var whitespaceRunRe = regexp.MustCompile(`\s+`)
+
+// NormalizeWhitespace rewrites content according to a whitespace policy:
+//   - "collapse" (default) replaces every whitespace run with a single space,
+//   - "preserve" leaves content untouched,
+//   - "trim_trailing" strips trailing whitespace and collapses runs of blank lines,
+//     keeping indentation intact for whitespace-significant formats,
+//   - "tabs_to_spaces" does the same and also expands tabs to tabWidth columns.
+func NormalizeWhitespace(content, policy string, tabWidth int) string {
+	switch policy {
+	case "preserve":
+		return content
+	case "trim_trailing":
+		return trimTrailingWhitespace(content, 0)
+	case "tabs_to_spaces":
+		if tabWidth <= 0 {
+			tabWidth = DefaultTabWidth
+		}
+		return trimTrailingWhitespace(content, tabWidth)
+	default:
+		return strings.TrimSpace(whitespaceRunRe.ReplaceAllString(content, " "))
+	}
+}
+
+// trimTrailingWhitespace normalizes line endings, strips trailing whitespace
+// from each line, collapses consecutive blank lines into one and drops blank
+// lines at both ends. A positive tabWidth also expands tabs.
+func trimTrailingWhitespace(content string, tabWidth int) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	var b strings.Builder
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r\f\v")
+		if line == "" {
+			blank = b.Len() > 0
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+			if blank {
+				b.WriteByte('\n')
+			}
+		}
+		blank = false
+		if tabWidth > 0 {
+			line = expandTabs(line, tabWidth)
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// expandTabs replaces tabs with spaces up to the next multiple of tabWidth columns.
+func expandTabs(line string, tabWidth int) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := tabWidth - column%tabWidth
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
+
+// ProcessContent applies content exclusions and the whitespace policy for
+// the given format, producing the content as it is written to the output.
+func (fc *FileCollector) ProcessContent(content string, format string) (string, error) {
+	content, err := fc.ApplyContentExclusions(content, format)
+	if err != nil {
+		return "", err
+	}
+	return NormalizeWhitespace(content, fc.Config.WhitespaceFor(format), fc.Config.TabWidth), nil
+}
@@ -0,0 +1,412 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer streams collected files into an output document: Begin once, then
+// WriteFile for every entry in output order, then End.
+type Writer interface {
+	Begin() error
+	WriteFile(entry FileEntry, file ProcessedFile) error
+	End() error
+}
+
+// OutputInfo holds the document-level sections that writers emit around
+// the files. Fields left empty are omitted from the output.
+type OutputInfo struct {
+	Tree string // Project tree rendered by RenderTree
+	Meta *Meta  // Written after the files, once the totals are known
+}
+
+// writerFactory creates a Writer for w that reads document sections from info.
+type writerFactory func(w io.Writer, info *OutputInfo) Writer
+
+// writerFactories maps the names in config.OutputFormats to their writers.
+var writerFactories = map[string]writerFactory{
+	"json":     func(w io.Writer, info *OutputInfo) Writer { return &jsonWriter{w: w, info: info} },
+	"jsonl":    func(w io.Writer, info *OutputInfo) Writer { return &jsonlWriter{w: w, info: info} },
+	"markdown": func(w io.Writer, info *OutputInfo) Writer { return &markdownWriter{w: w, info: info} },
+	"xml":      func(w io.Writer, info *OutputInfo) Writer { return &xmlWriter{w: w, info: info} },
+	"text":     func(w io.Writer, info *OutputInfo) Writer { return &textWriter{w: w, info: info} },
+}
+
+// NewWriter returns a Writer for an output format ("json", "jsonl",
+// "markdown", "xml" or "text") that writes to w. info may be nil.
+func NewWriter(format string, w io.Writer, info *OutputInfo) (Writer, error) {
+	factory, ok := writerFactories[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+	if info == nil {
+		info = &OutputInfo{}
+	}
+	return factory(w, info), nil
+}
+
+// jsonWriter writes the {"project_files": [...]} document. Without a tree its
+// output is byte-identical to json.MarshalIndent(OutputJSON, "", "  ").
+type jsonWriter struct {
+	w     io.Writer
+	info  *OutputInfo
+	count int
+}
+
+func (j *jsonWriter) Begin() error {
+	if j.info.Tree != "" {
+		tree, err := json.Marshal(j.info.Tree)
+		if err != nil {
+			return err
+		}
+		return writeStrings(j.w, "{\n  \"tree\": ", string(tree), ",\n  \"project_files\": [")
+	}
+	return writeStrings(j.w, "{\n  \"project_files\": [")
+}
+
+func (j *jsonWriter) WriteFile(entry FileEntry, file ProcessedFile) error {
+	data, err := json.MarshalIndent(file, "    ", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling %s: %w", entry.Path, err)
+	}
+	separator := "\n    "
+	if j.count > 0 {
+		separator = ",\n    "
+	}
+	j.count++
+	return writeStrings(j.w, separator, string(data))
+}
+
+func (j *jsonWriter) End() error {
+	closing := "]"
+	if j.count > 0 {
+		closing = "\n  ]"
+	}
+	if j.info.Meta == nil {
+		return writeStrings(j.w, closing, "\n}")
+	}
+	meta, err := json.MarshalIndent(j.info.Meta, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStrings(j.w, closing, ",\n  \"meta\": ", string(meta), "\n}")
+}
+
+// jsonlWriter writes one JSON object per line, starting with a {"tree": ...}
+// line when the tree is enabled and ending with a {"meta": ...} line when
+// meta is enabled.
+type jsonlWriter struct {
+	w    io.Writer
+	info *OutputInfo
+}
+
+func (j *jsonlWriter) Begin() error {
+	if j.info.Tree == "" {
+		return nil
+	}
+	data, err := json.Marshal(map[string]string{"tree": j.info.Tree})
+	if err != nil {
+		return err
+	}
+	return writeStrings(j.w, string(data), "\n")
+}
+
+func (j *jsonlWriter) WriteFile(entry FileEntry, file ProcessedFile) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("marshaling %s: %w", entry.Path, err)
+	}
+	return writeStrings(j.w, string(data), "\n")
+}
+
+func (j *jsonlWriter) End() error {
+	if j.info.Meta == nil {
+		return nil
+	}
+	data, err := json.Marshal(map[string]*Meta{"meta": j.info.Meta})
+	if err != nil {
+		return err
+	}
+	return writeStrings(j.w, string(data), "\n")
+}
+
+// markdownWriter writes a "## `path`" heading per file followed by its
+// content in a fenced code block tagged with the language.
+type markdownWriter struct {
+	w     io.Writer
+	info  *OutputInfo
+	count int
+}
+
+func (m *markdownWriter) Begin() error {
+	if m.info.Tree == "" {
+		return nil
+	}
+	fence := markdownFence(m.info.Tree)
+	return writeStrings(m.w, "## Project tree\n\n", fence, "\n", m.info.Tree, fence, "\n\n")
+}
+
+func (m *markdownWriter) WriteFile(entry FileEntry, file ProcessedFile) error {
+	var b strings.Builder
+	if m.count > 0 {
+		b.WriteString("\n")
+	}
+	m.count++
+	if file.Path != "" {
+		fmt.Fprintf(&b, "## `%s`\n", file.Path)
+	}
+	if file.Error != "" {
+		fmt.Fprintf(&b, "\n> error: %s\n", file.Error)
+	}
+	if file.HasContent {
+		if file.Path != "" {
+			b.WriteString("\n")
+		}
+		fence := markdownFence(file.Content)
+		b.WriteString(fence + fenceLanguage(entry.Format) + "\n")
+		b.WriteString(file.Content)
+		if !strings.HasSuffix(file.Content, "\n") {
+			b.WriteString("\n")
+		}
+		b.WriteString(fence + "\n")
+	}
+	return writeStrings(m.w, b.String())
+}
+
+func (m *markdownWriter) End() error {
+	if m.info.Meta == nil {
+		return nil
+	}
+	meta, err := json.MarshalIndent(m.info.Meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	separator := ""
+	if m.count > 0 {
+		separator = "\n"
+	}
+	return writeStrings(m.w, separator, "## Metadata\n\n```json\n", string(meta), "\n```\n")
+}
+
+// markdownFence returns a backtick fence longer than any backtick run in content.
+func markdownFence(content string) string {
+	longest, run := 0, 0
+	for i := 0; i < len(content); i++ {
+		if content[i] == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// fenceLanguages maps file formats to code block languages where the
+// extension itself is not a common highlighter name.
+var fenceLanguages = map[string]string{
+	"py": "python", "pyi": "python",
+	"rs": "rust",
+	"kt": "kotlin", "kts": "kotlin",
+	"rb": "ruby",
+	"cs": "csharp",
+	"sh": "bash", "zsh": "bash",
+	"yml": "yaml",
+	"md":  "markdown",
+	"h":   "c",
+	"hpp": "cpp", "cc": "cpp", "cxx": "cpp", "hh": "cpp",
+	"mjs": "javascript", "cjs": "javascript",
+	"mts": "typescript", "cts": "typescript",
+}
+
+// fenceLanguage returns the code block language for a file format.
+func fenceLanguage(format string) string {
+	if language, ok := fenceLanguages[format]; ok {
+		return language
+	}
+	return format
+}
+
+// xmlWriter wraps every file in <file path="..."> tags inside a <files>
+// element. Content is written verbatim, as models read it, and is not
+// escaped for XML parsers.
+type xmlWriter struct {
+	w    io.Writer
+	info *OutputInfo
+}
+
+func (x *xmlWriter) Begin() error {
+	if x.info.Tree != "" {
+		if err := writeStrings(x.w, "<tree>\n", x.info.Tree, "</tree>\n"); err != nil {
+			return err
+		}
+	}
+	return writeStrings(x.w, "<files>\n")
+}
+
+func (x *xmlWriter) WriteFile(entry FileEntry, file ProcessedFile) error {
+	open := "<file" + xmlFileAttributes(file) + ">"
+	if !file.HasContent {
+		return writeStrings(x.w, strings.TrimSuffix(open, ">")+"/>\n")
+	}
+	content := file.Content
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return writeStrings(x.w, open, "\n", content, "</file>\n")
+}
+
+func (x *xmlWriter) End() error {
+	if x.info.Meta == nil {
+		return writeStrings(x.w, "</files>\n")
+	}
+	meta, err := json.MarshalIndent(x.info.Meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeStrings(x.w, "</files>\n<meta>\n", string(meta), "\n</meta>\n")
+}
+
+// xmlFileAttributes returns the path and the selected file_fields of a file
+// as XML attributes, in the order of the JSON schema.
+func xmlFileAttributes(file ProcessedFile) string {
+	var b strings.Builder
+	attr := func(name, value string) {
+		fmt.Fprintf(&b, " %s=\"%s\"", name, xmlAttrEscaper.Replace(value))
+	}
+	if file.Path != "" {
+		attr("path", file.Path)
+	}
+	if file.Language != "" {
+		attr("language", file.Language)
+	}
+	if file.SizeBytes != nil {
+		attr("size_bytes", strconv.FormatInt(*file.SizeBytes, 10))
+	}
+	if file.Lines != nil {
+		attr("lines", strconv.Itoa(*file.Lines))
+	}
+	if file.Tokens != nil {
+		attr("tokens", strconv.Itoa(*file.Tokens))
+	}
+	if file.SHA256 != "" {
+		attr("sha256", file.SHA256)
+	}
+	if file.MTime != "" {
+		attr("mtime", file.MTime)
+	}
+	if file.BytesRemoved != nil {
+		attr("bytes_removed", strconv.FormatInt(*file.BytesRemoved, 10))
+	}
+	if file.Error != "" {
+		attr("error", file.Error)
+	}
+	return b.String()
+}
+
+var xmlAttrEscaper = strings.NewReplacer(`&`, "&amp;", `<`, "&lt;", `>`, "&gt;", `"`, "&quot;")
+
+// textWriter writes a "==> path <==" header line per file followed by its
+// content, with a blank line between files.
+type textWriter struct {
+	w     io.Writer
+	info  *OutputInfo
+	count int
+}
+
+func (t *textWriter) Begin() error {
+	if t.info.Tree == "" {
+		return nil
+	}
+	return writeStrings(t.w, "==> project tree <==\n", t.info.Tree, "\n")
+}
+
+func (t *textWriter) WriteFile(entry FileEntry, file ProcessedFile) error {
+	var b strings.Builder
+	if t.count > 0 {
+		b.WriteString("\n")
+	}
+	t.count++
+	if file.Path != "" {
+		fmt.Fprintf(&b, "==> %s <==\n", file.Path)
+	}
+	if file.Error != "" {
+		fmt.Fprintf(&b, "[error: %s]\n", file.Error)
+	}
+	if file.HasContent {
+		b.WriteString(file.Content)
+		if !strings.HasSuffix(file.Content, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	return writeStrings(t.w, b.String())
+}
+
+func (t *textWriter) End() error {
+	if t.info.Meta == nil {
+		return nil
+	}
+	meta, err := json.MarshalIndent(t.info.Meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	separator := ""
+	if t.count > 0 {
+		separator = "\n"
+	}
+	return writeStrings(t.w, separator, "==> meta <==\n", string(meta), "\n")
+}
+
+func writeStrings(w io.Writer, parts ...string) error {
+	for _, part := range parts {
+		if _, err := io.WriteString(w, part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writerSizes measures documents of a writer: the bytes around the files and
+// the bytes each file adds, so budgets can be checked before anything is written.
+type writerSizes struct {
+	newWriter writerFactory
+	info      *OutputInfo
+	overhead  int64 // Size of a document without its files
+}
+
+// entryMeasurer is implemented by writers that hold the files until End, so
+// that the bytes a file adds cannot be counted while it is written.
+type entryMeasurer interface {
+	entryBytes(entry FileEntry, file ProcessedFile) int64
+}
+
+// newWriterSizes renders the document around the files once, with an empty
+// entry, to find its overhead.
+func newWriterSizes(newWriter writerFactory, info *OutputInfo) *writerSizes {
+	s := &writerSizes{newWriter: newWriter, info: info}
+	counter := &countingWriter{w: io.Discard}
+	w := newWriter(counter, info)
+	_ = w.Begin()
+	_ = w.WriteFile(FileEntry{}, ProcessedFile{})
+	_ = w.End()
+	s.overhead = counter.n - s.entryBytes(FileEntry{}, ProcessedFile{})
+	return s
+}
+
+// entryBytes returns the bytes file adds to a document that already holds
+// other files, including any separator. Only the entry itself is
+// serialized, not the document around it. It is safe for concurrent use.
+func (s *writerSizes) entryBytes(entry FileEntry, file ProcessedFile) int64 {
+	counter := &countingWriter{w: io.Discard}
+	w := s.newWriter(counter, s.info)
+	if m, ok := w.(entryMeasurer); ok {
+		return m.entryBytes(entry, file)
+	}
+	_ = w.WriteFile(FileEntry{}, ProcessedFile{})
+	before := counter.n
+	_ = w.WriteFile(entry, file)
+	return counter.n - before
+}
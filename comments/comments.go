@@ -0,0 +1,203 @@
+// Package comments removes comments from source code with small per-language
+// lexers that know about strings, raw strings and nested comments, so that
+// comment markers inside literals (URLs, "/*" in a string) are left alone.
+package comments
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Options controls which comments are kept.
+type Options struct {
+	// KeepDocComments keeps documentation comments directly attached to
+	// exported declarations (Go identifiers starting with an upper-case
+	// letter, JS/TS "export", Rust "pub", Java "public"/"protected", ...).
+	KeepDocComments bool
+}
+
+type language struct {
+	lex func(s *scanner)
+	// exported reports whether a declaration line is exported; nil for
+	// languages without doc comments on declarations.
+	exported func(line string) bool
+}
+
+var (
+	goExportedRe     = regexp.MustCompile(`^(?:(?:func\s+(?:\([^)]*\)\s*)?|type\s+|var\s+|const\s+)\p{Lu}|\p{Lu}[\p{L}\p{N}_]*(?:\s*,\s*[\p{L}_][\p{L}\p{N}_]*)*(?:\s+[^\s(]|\s*=[^=]|$))`)
+	jsExportedRe     = regexp.MustCompile(`^export\b`)
+	rustExportedRe   = regexp.MustCompile(`^pub\b`)
+	javaExportedRe   = regexp.MustCompile(`\b(?:public|protected)\b`)
+	kotlinPrivateRe  = regexp.MustCompile(`^(?:private|internal)\b`)
+	kotlinDeclRe     = regexp.MustCompile(`\b(?:fun|class|interface|object|val|var|typealias|constructor)\b`)
+	cStaticRe        = regexp.MustCompile(`^(?:static|namespace\s*\{)`)
+	kotlinExported   = func(line string) bool { return kotlinDeclRe.MatchString(line) && !kotlinPrivateRe.MatchString(line) }
+	cExported        = func(line string) bool { return !cStaticRe.MatchString(line) }
+	languageRegistry = map[string]language{
+		"go":         {lex: lexGo, exported: goExportedRe.MatchString},
+		"javascript": {lex: lexJS, exported: jsExportedRe.MatchString},
+		"typescript": {lex: lexJS, exported: jsExportedRe.MatchString},
+		"vue":        {lex: lexVue, exported: jsExportedRe.MatchString},
+		"python":     {lex: lexPython},
+		"rust":       {lex: lexRust, exported: rustExportedRe.MatchString},
+		"java":       {lex: func(s *scanner) { lexJava(s, false) }, exported: javaExportedRe.MatchString},
+		"kotlin":     {lex: func(s *scanner) { lexJava(s, true) }, exported: kotlinExported},
+		"c":          {lex: func(s *scanner) { lexC(s, false) }, exported: cExported},
+		"cpp":        {lex: func(s *scanner) { lexC(s, true) }, exported: cExported},
+		"sql":        {lex: lexSQL},
+		"shell":      {lex: lexShell},
+		"yaml":       {lex: lexYAML},
+	}
+)
+
+// formatLanguages maps file extensions (formats) to language names.
+var formatLanguages = map[string]string{
+	"go": "go",
+	"js": "javascript", "jsx": "javascript", "mjs": "javascript", "cjs": "javascript",
+	"ts": "typescript", "tsx": "typescript", "mts": "typescript", "cts": "typescript",
+	"vue": "vue",
+	"py":  "python", "pyi": "python", "pyw": "python",
+	"rs":   "rust",
+	"java": "java",
+	"kt":   "kotlin", "kts": "kotlin",
+	"c": "c", "h": "c",
+	"cc": "cpp", "cpp": "cpp", "cxx": "cpp", "c++": "cpp", "hh": "cpp", "hpp": "cpp", "hxx": "cpp",
+	"sql": "sql",
+	"sh":  "shell", "bash": "shell", "zsh": "shell", "ksh": "shell",
+	"yaml": "yaml", "yml": "yaml",
+}
+
+// Languages returns the supported language names in sorted order.
+func Languages() []string {
+	names := make([]string, 0, len(languageRegistry))
+	for name := range languageRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LanguageForFormat returns the language for a file format (extension), or
+// "" if comments of that format are not supported.
+func LanguageForFormat(format string) string {
+	return formatLanguages[strings.ToLower(strings.TrimPrefix(format, "."))]
+}
+
+// Strip removes the comments of src written in language. A comment that is
+// the only thing on its lines is removed together with those lines; a
+// trailing comment is removed with the whitespace before it.
+func Strip(src, languageName string, opts Options) (string, error) {
+	lang, ok := languageRegistry[strings.ToLower(languageName)]
+	if !ok {
+		return "", fmt.Errorf("unsupported language %q for comment stripping (supported: %s)", languageName, strings.Join(Languages(), ", "))
+	}
+	s := &scanner{src: src}
+	lang.lex(s)
+	spans := s.spans
+	if opts.KeepDocComments && lang.exported != nil {
+		spans = withoutExportedDocs(src, spans, lang.exported)
+	}
+	return removeSpans(src, spans), nil
+}
+
+// withoutExportedDocs drops the spans of doc comments attached to exported declarations.
+func withoutExportedDocs(src string, spans []span, exported func(string) bool) []span {
+	kept := spans[:0:0]
+	for i, sp := range spans {
+		if sp.doc && startsLine(src, sp.start) {
+			if decl := attachedDeclaration(src, spans, i); decl != "" && exported(decl) {
+				continue
+			}
+		}
+		kept = append(kept, sp)
+	}
+	return kept
+}
+
+// attachedDeclaration returns the code line documented by spans[i]: the next
+// line that is not a comment, provided no blank line comes in between.
+// Annotation and attribute lines ("@Override", "#[derive(...)]") are skipped.
+func attachedDeclaration(src string, spans []span, i int) string {
+	pos := spans[i].end
+	next := i + 1
+	for {
+		newlines := 0
+		for ; pos < len(src) && isSpace(src[pos]); pos++ {
+			if src[pos] == '\n' {
+				if newlines++; newlines > 1 {
+					return ""
+				}
+			}
+		}
+		if pos >= len(src) {
+			return ""
+		}
+		if next < len(spans) && spans[next].start == pos {
+			pos = spans[next].end
+			next++
+			continue
+		}
+		line := src[pos:]
+		if end := strings.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+		}
+		pos += len(line)
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "@") || strings.HasPrefix(line, "#[") {
+			continue
+		}
+		return line
+	}
+}
+
+// startsLine reports whether only horizontal whitespace precedes pos on its line.
+func startsLine(src string, pos int) bool {
+	for pos > 0 && (src[pos-1] == ' ' || src[pos-1] == '\t') {
+		pos--
+	}
+	return pos == 0 || src[pos-1] == '\n'
+}
+
+// removeSpans cuts the comment spans out of src, dropping lines that held
+// nothing but comments and keeping neighbouring tokens apart.
+func removeSpans(src string, spans []span) string {
+	var b strings.Builder
+	b.Grow(len(src))
+	last := 0
+	for _, sp := range spans {
+		if sp.start < last {
+			continue
+		}
+		before := sp.start
+		for before > last && (src[before-1] == ' ' || src[before-1] == '\t') {
+			before--
+		}
+		after := sp.end
+		for after < len(src) && (src[after] == ' ' || src[after] == '\t' || src[after] == '\r') {
+			after++
+		}
+		atLineStart := before == 0 || src[before-1] == '\n'
+		atLineEnd := after == len(src) || src[after] == '\n'
+		switch {
+		case atLineStart && atLineEnd:
+			b.WriteString(src[last:before])
+			last = min(after+1, len(src))
+		case atLineEnd:
+			b.WriteString(src[last:before])
+			last = sp.end
+		case after > sp.end:
+			// Whitespace follows the comment; drop the whitespace before it.
+			b.WriteString(src[last:before])
+			last = sp.end
+		default:
+			b.WriteString(src[last:sp.start])
+			if sp.start > 0 && !isSpace(src[sp.start-1]) {
+				b.WriteByte(' ')
+			}
+			last = sp.end
+		}
+	}
+	b.WriteString(src[last:])
+	return b.String()
+}
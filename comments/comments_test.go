@@ -0,0 +1,168 @@
+package comments
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStrip(t *testing.T) {
+	tests := []struct {
+		language string
+		src      string
+		want     string
+	}{
+		// Go
+		{"go", "s := \"// not a comment\" // c", "s := \"// not a comment\""},
+		{"go", "s := \"a\\\" // b\" // c", "s := \"a\\\" // b\""},
+		{"go", "r := '\"' // c", "r := '\"'"},
+		{"go", "s := `/* raw\n// still */` + x // c", "s := `/* raw\n// still */` + x"},
+		{"go", "a /* c */ b", "a b"},
+		{"go", "a/*c*/b", "a b"},
+		{"go", "// c\nx\n", "x\n"},
+		{"go", "/* a /* b */ x */", " x */"}, // Go block comments do not nest
+		{"go", "x := 1 /* open\ny := 2", "x := 1"},
+		{"go", "s := \"abc\n// c\nx\n", "s := \"abc\nx\n"}, // An unterminated string ends at the newline
+
+		// JavaScript and TypeScript
+		{"javascript", "const u = \"http://x\"; // c", "const u = \"http://x\";"},
+		{"javascript", "const r = /\\/\\/ not/g; // c", "const r = /\\/\\/ not/g;"},
+		{"javascript", "const r = /[/]/; // c", "const r = /[/]/;"},
+		{"javascript", "a = b / c; // d", "a = b / c;"},
+		{"javascript", "const t = `a ${ b /* in */ } // kept`; // c", "const t = `a ${ b } // kept`;"},
+		{"javascript", "`${ `//x` }` // c", "`${ `//x` }`"},
+		{"javascript", "x = '/* no */' + y", "x = '/* no */' + y"},
+		{"javascript", "a; /* open", "a;"},
+		{"typescript", "const s: string = '//'; // c", "const s: string = '//';"},
+		{"vue", "<template><a href=\"//x\"><!-- c --></a></template>\n<script>\n// c\nconst a = '//'; /* b */\n</script>\n",
+			"<template><a href=\"//x\"><!-- c --></a></template>\n<script>\nconst a = '//';\n</script>\n"},
+
+		// Python
+		{"python", "s = \"# not\" # c", "s = \"# not\""},
+		{"python", "s = 'it\\'s # x' # c", "s = 'it\\'s # x'"},
+		{"python", "s = \"\"\"\n# kept\n\"\"\" # c", "s = \"\"\"\n# kept\n\"\"\""},
+		{"python", "s = f\"#{x}\"  # c", "s = f\"#{x}\""},
+		{"python", "#!/usr/bin/env python\n# c\nx = 1\n", "#!/usr/bin/env python\nx = 1\n"},
+		{"python", "s = 'abc\n# c\nx\n", "s = 'abc\nx\n"},
+		{"python", "s = \"\"\"open\n# kept", "s = \"\"\"open\n# kept"},
+
+		// Rust
+		{"rust", "a /* x /* y */ z */ b", "a b"},
+		{"rust", "let s = r#\"// \"quoted\" */\"#; // c", "let s = r#\"// \"quoted\" */\"#;"},
+		{"rust", "let c = '\"'; // c", "let c = '\"';"},
+		{"rust", "let c = '\\''; // c", "let c = '\\'';"},
+		{"rust", "fn f<'a>(x: &'a str) -> &'a str { x } // c", "fn f<'a>(x: &'a str) -> &'a str { x }"},
+		{"rust", "let b = b\"//\"; // c", "let b = b\"//\";"},
+		{"rust", "let s = \"/*\"; let t = 1; // c", "let s = \"/*\"; let t = 1;"},
+		{"rust", "x /* a /* b */", "x"},
+
+		// Java and Kotlin
+		{"java", "String s = \"/* no */\"; // c", "String s = \"/* no */\";"},
+		{"java", "String t = \"\"\"\n  // kept \\\"\"\"\n  \"\"\"; // c", "String t = \"\"\"\n  // kept \\\"\"\"\n  \"\"\";"},
+		{"java", "char c = '\"'; // c", "char c = '\"';"},
+		{"java", "int a; /* a /* b */ int b;", "int a; int b;"},
+		{"java", "int a; /* x\nint b;", "int a;"},
+		{"kotlin", "val a = 1 /* x /* y */ z */ + 2", "val a = 1 + 2"},
+		{"kotlin", "val s = \"\"\"C:\\\"\"\" // c", "val s = \"\"\"C:\\\"\"\""}, // Raw strings have no escapes
+		{"kotlin", "val s = \"// no\" // c", "val s = \"// no\""},
+
+		// C and C++
+		{"c", "// a \\\nb\nint x;\n", "int x;\n"}, // A backslash continues a line comment
+		{"c", "int n = 1'000; // c", "int n = 1'000;"},
+		{"c", "char c = '\"'; /* c */", "char c = '\"';"},
+		{"c", "puts(\"/* no */ // no\");", "puts(\"/* no */ // no\");"},
+		{"c", "int a; /* x", "int a;"},
+		{"cpp", "auto s = R\"x(// )\" */)x\"; // c", "auto s = R\"x(// )\" */)x\";"},
+		{"cpp", "auto s = u8R\"(/*)\"; // c", "auto s = u8R\"(/*)\";"},
+
+		// SQL
+		{"sql", "SELECT '--no' -- c", "SELECT '--no'"},
+		{"sql", "SELECT 'it''s -- x' -- c", "SELECT 'it''s -- x'"},
+		{"sql", "SELECT \"a--b\" -- c", "SELECT \"a--b\""},
+		{"sql", "SELECT /* a /* b */ c */ 1", "SELECT 1"},
+		{"sql", "SELECT $$ -- kept $$; -- c", "SELECT $$ -- kept $$;"},
+		{"sql", "SELECT $fn$ /* kept */ $fn$", "SELECT $fn$ /* kept */ $fn$"},
+		{"sql", "SELECT E'\\' -- x' -- c", "SELECT E'\\' -- x'"},
+		{"sql", "SELECT $1 -- c", "SELECT $1"},
+		{"sql", "SELECT 1 /* open", "SELECT 1"},
+
+		// Shell
+		{"shell", "echo \"# no\" # c", "echo \"# no\""},
+		{"shell", "echo a#b # c", "echo a#b"},
+		{"shell", "echo \\# # c", "echo \\#"},
+		{"shell", "echo '# no' $'# no\\'' # c", "echo '# no' $'# no\\''"},
+		{"shell", "cat <<EOF\n# kept\nEOF\n# c\n", "cat <<EOF\n# kept\nEOF\n"},
+		{"shell", "cat <<-'END' # c\n\t# kept\n\tEND\n", "cat <<-'END'\n\t# kept\n\tEND\n"},
+		{"shell", "x=$(echo '#' # in\n)\n", "x=$(echo '#'\n)\n"},
+		{"shell", "#!/bin/sh\n# c\necho\n", "#!/bin/sh\necho\n"},
+		{"shell", "echo \"$(echo \")#\")\" # c", "echo \"$(echo \")#\")\""},
+
+		// YAML
+		{"yaml", "a: \"# no\" # c", "a: \"# no\""},
+		{"yaml", "a: 'it''s # x' # c", "a: 'it''s # x'"},
+		{"yaml", "url: http://x#frag # c", "url: http://x#frag"},
+		{"yaml", "s: |\n  # kept\n  line\n# c\nb: 1\n", "s: |\n  # kept\n  line\nb: 1\n"},
+		{"yaml", "s: >- # c\n  # kept\n", "s: >-\n  # kept\n"},
+	}
+	for _, tt := range tests {
+		got, err := Strip(tt.src, tt.language, Options{})
+		if err != nil {
+			t.Errorf("%s: Strip(%q): %v", tt.language, tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Strip(%q) =\n%q\nwant\n%q", tt.language, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestStripKeepDocComments(t *testing.T) {
+	tests := []struct {
+		language string
+		src      string
+		want     string
+	}{
+		{"go", "// Exported is kept.\nfunc Exported() {}\n// helper is not.\nfunc helper() {}\n",
+			"// Exported is kept.\nfunc Exported() {}\nfunc helper() {}\n"},
+		{"go", "// Detached.\n\nfunc Exported() {}\n", "\nfunc Exported() {}\n"},
+		{"javascript", "/** Kept. */\nexport function a() {}\n/** Not. */\nfunction b() {}\n// Line.\nexport const c = 1;\n",
+			"/** Kept. */\nexport function a() {}\nfunction b() {}\nexport const c = 1;\n"},
+		{"rust", "/// Kept.\n#[inline]\npub fn a() {}\n/// Not.\nfn b() {}\n",
+			"/// Kept.\n#[inline]\npub fn a() {}\nfn b() {}\n"},
+		{"java", "/** Kept. */\n@Override\npublic void a() {}\n/** Not. */\nprivate void b() {}\n",
+			"/** Kept. */\n@Override\npublic void a() {}\nprivate void b() {}\n"},
+		{"python", "# Not a doc comment.\ndef a():\n    \"\"\"Docstring.\"\"\"\n",
+			"def a():\n    \"\"\"Docstring.\"\"\"\n"},
+	}
+	for _, tt := range tests {
+		got, err := Strip(tt.src, tt.language, Options{KeepDocComments: true})
+		if err != nil {
+			t.Errorf("%s: Strip(%q): %v", tt.language, tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Strip(%q) =\n%q\nwant\n%q", tt.language, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestLanguageForFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"go", "go"},
+		{".TSX", "typescript"},
+		{"h", "c"},
+		{"hpp", "cpp"},
+		{"yml", "yaml"},
+		{"md", ""},
+	}
+	for _, tt := range tests {
+		if got := LanguageForFormat(tt.format); got != tt.want {
+			t.Errorf("LanguageForFormat(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+	if _, err := Strip("x", "cobol", Options{}); err == nil || !strings.Contains(err.Error(), "unsupported language") {
+		t.Errorf("Strip with an unknown language: error %v, want an unsupported language error", err)
+	}
+}
@@ -0,0 +1,547 @@
+package comments
+
+import (
+	"regexp"
+	"strings"
+)
+
+// lexGo handles "//" and "/* */" comments, interpreted strings, runes and raw `strings`.
+func lexGo(s *scanner) {
+	for s.pos < len(s.src) {
+		switch c := s.src[s.pos]; {
+		case s.hasPrefix("//"):
+			s.lineComment(true, false)
+		case s.hasPrefix("/*"):
+			s.blockComment("/*", "*/", false, true)
+		case c == '"' || c == '\'':
+			s.quoted(string(c), true, false)
+		case c == '`':
+			s.quoted("`", false, true)
+		default:
+			s.pos++
+		}
+	}
+}
+
+// jsKeywordsBeforeExpression are keywords after which "/" starts a regex literal.
+var jsKeywordsBeforeExpression = map[string]bool{
+	"return": true, "typeof": true, "instanceof": true, "in": true, "of": true, "new": true,
+	"delete": true, "void": true, "throw": true, "case": true, "do": true, "else": true,
+	"yield": true, "await": true,
+}
+
+// lexJS handles JavaScript and TypeScript: strings, template literals with
+// nested substitutions, and regex literals.
+func lexJS(s *scanner) {
+	s.jsCode(false)
+}
+
+// jsCode lexes code until the end of input or, inside a template
+// substitution, until the brace that closes it.
+func (s *scanner) jsCode(inSubstitution bool) {
+	depth := 0
+	regexAllowed := true
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case s.hasPrefix("//"):
+			s.lineComment(false, false)
+		case s.hasPrefix("/*"):
+			s.blockComment("/*", "*/", false, isDocBlock(s.src[s.pos:]))
+		case c == '/' && regexAllowed:
+			s.regexLiteral()
+			regexAllowed = false
+		case c == '"' || c == '\'':
+			s.quoted(string(c), true, false)
+			regexAllowed = false
+		case c == '`':
+			s.templateLiteral()
+			regexAllowed = false
+		case c == '{':
+			depth++
+			s.pos++
+			regexAllowed = true
+		case c == '}':
+			s.pos++
+			if inSubstitution && depth == 0 {
+				return
+			}
+			depth--
+			regexAllowed = false
+		case isIdentByte(c):
+			regexAllowed = jsKeywordsBeforeExpression[s.ident()]
+		case isSpace(c):
+			s.pos++
+		default:
+			regexAllowed = c != ')' && c != ']'
+			s.pos++
+		}
+	}
+}
+
+func (s *scanner) templateLiteral() {
+	s.pos++
+	for s.pos < len(s.src) {
+		switch {
+		case s.src[s.pos] == '\\':
+			s.advance(2)
+		case s.src[s.pos] == '`':
+			s.pos++
+			return
+		case s.hasPrefix("${"):
+			s.pos += 2
+			s.jsCode(true)
+		default:
+			s.pos++
+		}
+	}
+}
+
+func (s *scanner) regexLiteral() {
+	s.pos++
+	inClass := false
+	for s.pos < len(s.src) {
+		switch s.src[s.pos] {
+		case '\\':
+			s.advance(2)
+			continue
+		case '\n':
+			return
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		case '/':
+			if !inClass {
+				s.pos++
+				return
+			}
+		}
+		s.pos++
+	}
+}
+
+var (
+	vueScriptOpenRe  = regexp.MustCompile(`(?i)<script\b[^>]*>`)
+	vueScriptCloseRe = regexp.MustCompile(`(?i)</script\s*>`)
+)
+
+// lexVue lexes the <script> blocks of a single-file component as JavaScript
+// or TypeScript; the template and styles are left alone.
+func lexVue(s *scanner) {
+	for s.pos < len(s.src) {
+		open := vueScriptOpenRe.FindStringIndex(s.src[s.pos:])
+		if open == nil {
+			return
+		}
+		bodyStart := s.pos + open[1]
+		bodyEnd := len(s.src)
+		if closing := vueScriptCloseRe.FindStringIndex(s.src[bodyStart:]); closing != nil {
+			bodyEnd = bodyStart + closing[0]
+		}
+		script := &scanner{src: s.src[bodyStart:bodyEnd]}
+		lexJS(script)
+		for _, sp := range script.spans {
+			s.spans = append(s.spans, span{start: bodyStart + sp.start, end: bodyStart + sp.end, doc: sp.doc})
+		}
+		s.pos = bodyEnd
+		if s.pos < len(s.src) {
+			s.pos++
+		}
+	}
+}
+
+// lexPython handles "#" comments (keeping a "#!" first line) and single,
+// triple-quoted and prefixed strings. Docstrings are string literals and are always kept.
+func lexPython(s *scanner) {
+	for s.pos < len(s.src) {
+		switch c := s.src[s.pos]; {
+		case c == '#' && s.pos == 0 && s.hasPrefix("#!"):
+			s.skipLine()
+		case c == '#':
+			s.lineComment(false, false)
+		case c == '"' || c == '\'':
+			if triple := strings.Repeat(string(c), 3); s.hasPrefix(triple) {
+				s.quoted(triple, true, true)
+			} else {
+				s.quoted(string(c), true, false)
+			}
+		default:
+			s.pos++
+		}
+	}
+}
+
+// lexRust handles nested block comments, "///" and "/** */" doc comments,
+// byte and C strings, raw strings (r#"..."#), char literals and lifetimes.
+func lexRust(s *scanner) {
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case s.hasPrefix("//"):
+			s.lineComment(s.hasPrefix("///") && !s.hasPrefix("////"), false)
+		case s.hasPrefix("/*"):
+			s.blockComment("/*", "*/", true, isDocBlock(s.src[s.pos:]))
+		case c == '"':
+			s.quoted(`"`, true, true)
+		case c == '\'':
+			s.charLiteral()
+		case isIdentStart(c):
+			switch word := s.ident(); {
+			case (word == "r" || word == "br" || word == "cr") && (s.peek(0) == '"' || s.peek(0) == '#'):
+				s.rustRawString()
+			case word == "b" && s.peek(0) == '\'':
+				s.charLiteral()
+			}
+		default:
+			s.pos++
+		}
+	}
+}
+
+func (s *scanner) rustRawString() {
+	start := s.pos
+	for s.pos < len(s.src) && s.src[s.pos] == '#' {
+		s.pos++
+	}
+	hashes := s.pos - start
+	if s.peek(0) != '"' {
+		return // Raw identifier such as r#type
+	}
+	s.pos++
+	s.skipTo(`"` + strings.Repeat("#", hashes))
+}
+
+// lexJava handles Java and Kotlin: text blocks / raw strings in triple
+// quotes and char literals. Kotlin block comments nest and its triple-quoted
+// strings have no escapes.
+func lexJava(s *scanner, kotlin bool) {
+	for s.pos < len(s.src) {
+		switch c := s.src[s.pos]; {
+		case s.hasPrefix("//"):
+			s.lineComment(false, false)
+		case s.hasPrefix("/*"):
+			s.blockComment("/*", "*/", kotlin, isDocBlock(s.src[s.pos:]))
+		case s.hasPrefix(`"""`):
+			s.quoted(`"""`, !kotlin, true)
+		case c == '"':
+			s.quoted(`"`, true, false)
+		case c == '\'':
+			s.charLiteral()
+		default:
+			s.pos++
+		}
+	}
+}
+
+// lexC handles C and C++: backslash-continued line comments, Doxygen doc
+// comments ("///", "//!", "/**", "/*!"), digit separators and C++ raw strings.
+func lexC(s *scanner, cpp bool) {
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case s.hasPrefix("//"):
+			doc := (s.hasPrefix("///") && !s.hasPrefix("////")) || s.hasPrefix("//!")
+			s.lineComment(doc, true)
+		case s.hasPrefix("/*"):
+			s.blockComment("/*", "*/", false, isDocBlock(s.src[s.pos:]) || s.hasPrefix("/*!"))
+		case c == '"':
+			s.quoted(`"`, true, false)
+		case c == '\'':
+			s.quoted("'", true, false)
+		case isDigit(c):
+			// Numbers may contain digit separators (1'000'000) that are not char literals.
+			for s.pos < len(s.src) && (isIdentByte(s.src[s.pos]) || s.src[s.pos] == '.' || s.src[s.pos] == '\'') {
+				s.pos++
+			}
+		case isIdentStart(c):
+			word := s.ident()
+			if cpp && s.peek(0) == '"' && strings.HasSuffix(word, "R") && (word == "R" || word == "LR" || word == "uR" || word == "UR" || word == "u8R") {
+				s.cppRawString()
+			}
+		default:
+			s.pos++
+		}
+	}
+}
+
+// cppRawString skips R"delim( ... )delim" starting at the opening quote.
+func (s *scanner) cppRawString() {
+	s.pos++
+	paren := strings.IndexByte(s.src[s.pos:], '(')
+	if paren < 0 || paren > 16 {
+		return
+	}
+	delimiter := s.src[s.pos : s.pos+paren]
+	s.pos += paren + 1
+	s.skipTo(")" + delimiter + `"`)
+}
+
+// lexSQL handles "--" and nested "/* */" comments, quoted strings and
+// identifiers, E'...' escape strings and PostgreSQL dollar quoting ($tag$...$tag$).
+func lexSQL(s *scanner) {
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case s.hasPrefix("--"):
+			s.lineComment(false, false)
+		case s.hasPrefix("/*"):
+			s.blockComment("/*", "*/", true, false)
+		case c == '\'' || c == '"' || c == '`':
+			s.doubledQuoted(c)
+		case c == '$':
+			s.dollarQuote()
+		case isIdentStart(c):
+			if word := s.ident(); (word == "E" || word == "e") && s.peek(0) == '\'' {
+				s.quoted("'", true, true)
+			}
+		default:
+			s.pos++
+		}
+	}
+}
+
+func (s *scanner) dollarQuote() {
+	end := s.pos + 1
+	if end < len(s.src) && isDigit(s.src[end]) {
+		s.pos++ // Positional parameter such as $1
+		return
+	}
+	for end < len(s.src) && isIdentByte(s.src[end]) && s.src[end] != '$' {
+		end++
+	}
+	if end >= len(s.src) || s.src[end] != '$' {
+		s.pos++
+		return
+	}
+	tag := s.src[s.pos : end+1]
+	s.pos = end + 1
+	s.skipTo(tag)
+}
+
+// heredoc is a pending here-document body of a shell command line.
+type heredoc struct {
+	delimiter string
+	stripTabs bool // "<<-" form
+}
+
+// lexShell handles "#" comments at the start of a word, the "#!" line, single,
+// double and $” quotes, command substitutions and here-documents.
+func lexShell(s *scanner) {
+	s.shellCode(false)
+}
+
+// shellCode lexes commands until the end of input or, inside "$(...)", the closing parenthesis.
+func (s *scanner) shellCode(inSubstitution bool) {
+	depth := 0
+	var pending []heredoc
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case c == '#' && s.shellWordStart():
+			if s.pos == 0 && s.hasPrefix("#!") {
+				s.skipLine()
+				continue
+			}
+			s.lineComment(false, false)
+		case c == '\\':
+			s.advance(2)
+		case c == '\'':
+			s.quoted("'", false, true)
+		case s.hasPrefix("$'"):
+			s.pos++
+			s.quoted("'", true, true)
+		case c == '"':
+			s.shellDoubleQuoted()
+		case s.hasPrefix("$("):
+			s.pos += 2
+			s.shellCode(true)
+		case c == '`':
+			s.quoted("`", true, true)
+		case c == '(':
+			depth++
+			s.pos++
+		case c == ')':
+			s.pos++
+			if inSubstitution && depth == 0 {
+				return
+			}
+			depth--
+		case s.hasPrefix("<<") && !s.hasPrefix("<<<"):
+			if h, ok := s.heredocStart(); ok {
+				pending = append(pending, h)
+			}
+		case c == '\n':
+			s.pos++
+			for _, h := range pending {
+				s.skipHeredoc(h)
+			}
+			pending = nil
+		default:
+			s.pos++
+		}
+	}
+}
+
+func (s *scanner) shellWordStart() bool {
+	return s.pos == 0 || strings.IndexByte(" \t\n;&|()<>", s.src[s.pos-1]) >= 0
+}
+
+func (s *scanner) shellDoubleQuoted() {
+	s.pos++
+	for s.pos < len(s.src) {
+		switch {
+		case s.src[s.pos] == '\\':
+			s.advance(2)
+		case s.src[s.pos] == '"':
+			s.pos++
+			return
+		case s.hasPrefix("$("):
+			s.pos += 2
+			s.shellCode(true)
+		case s.src[s.pos] == '`':
+			s.quoted("`", true, true)
+		default:
+			s.pos++
+		}
+	}
+}
+
+// heredocStart parses the operator and delimiter word of "<<WORD", "<<-WORD", "<<'WORD'".
+func (s *scanner) heredocStart() (heredoc, bool) {
+	s.pos += 2
+	var h heredoc
+	if s.peek(0) == '-' {
+		h.stripTabs = true
+		s.pos++
+	}
+	for s.pos < len(s.src) && (s.src[s.pos] == ' ' || s.src[s.pos] == '\t') {
+		s.pos++
+	}
+	var word strings.Builder
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		if c == '\'' || c == '"' {
+			end := strings.IndexByte(s.src[s.pos+1:], c)
+			if end < 0 {
+				break
+			}
+			word.WriteString(s.src[s.pos+1 : s.pos+1+end])
+			s.pos += end + 2
+			continue
+		}
+		if isSpace(c) || strings.IndexByte(";&|<>()", c) >= 0 {
+			break
+		}
+		if c != '\\' {
+			word.WriteByte(c)
+		}
+		s.pos++
+	}
+	h.delimiter = word.String()
+	return h, h.delimiter != ""
+}
+
+// skipHeredoc skips body lines up to and including the delimiter line.
+func (s *scanner) skipHeredoc(h heredoc) {
+	for s.pos < len(s.src) {
+		lineEnd := strings.IndexByte(s.src[s.pos:], '\n')
+		var line string
+		if lineEnd < 0 {
+			line = s.src[s.pos:]
+			s.pos = len(s.src)
+		} else {
+			line = s.src[s.pos : s.pos+lineEnd]
+			s.pos += lineEnd + 1
+		}
+		line = strings.TrimSuffix(line, "\r")
+		if h.stripTabs {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == h.delimiter {
+			return
+		}
+	}
+}
+
+var yamlBlockIndicatorRe = regexp.MustCompile(`^[|>][0-9+-]*[ \t]*(?:#.*)?\r?$`)
+
+// lexYAML handles "#" comments, single and double quoted scalars and
+// literal/folded block scalars, whose indented lines are kept verbatim.
+func lexYAML(s *scanner) {
+	blockIndent := -1 // Indentation of the line that opened a block scalar
+	lineStart := true
+	for s.pos < len(s.src) {
+		if lineStart {
+			lineStart = false
+			if blockIndent >= 0 {
+				if indent, blank := lineIndent(s.src[s.pos:]); blank || indent > blockIndent {
+					s.skipLine()
+					s.advance(1)
+					lineStart = true
+					continue
+				}
+				blockIndent = -1
+			}
+		}
+		c := s.src[s.pos]
+		switch {
+		case c == '#' && (s.pos == 0 || isSpace(s.src[s.pos-1])):
+			s.lineComment(false, false)
+		case c == '\'' && s.yamlValueStart():
+			s.doubledQuoted('\'')
+		case c == '"' && s.yamlValueStart():
+			s.quoted(`"`, true, true)
+		case (c == '|' || c == '>') && s.yamlValueStart() && yamlBlockIndicatorRe.MatchString(s.restOfLine()):
+			blockIndent, _ = lineIndent(s.src[s.lineStart():])
+			s.pos++
+		case c == '\n':
+			s.pos++
+			lineStart = true
+		default:
+			s.pos++
+		}
+	}
+}
+
+// yamlValueStart reports whether pos begins a scalar: the first thing on
+// the line or after ":", "-", "?", ",", "[" or "{".
+func (s *scanner) yamlValueStart() bool {
+	for i := s.pos - 1; i >= 0; i-- {
+		switch c := s.src[i]; c {
+		case ' ', '\t':
+			continue
+		case '\n', ':', '-', '?', ',', '[', '{':
+			return true
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (s *scanner) lineStart() int {
+	return strings.LastIndexByte(s.src[:s.pos], '\n') + 1
+}
+
+func (s *scanner) restOfLine() string {
+	rest := s.src[s.pos:]
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		return rest[:i]
+	}
+	return rest
+}
+
+// lineIndent returns the number of leading spaces of the line starting text,
+// and whether the line is blank.
+func lineIndent(text string) (int, bool) {
+	indent := 0
+	for indent < len(text) && text[indent] == ' ' {
+		indent++
+	}
+	rest := text[indent:]
+	if i := strings.IndexByte(rest, '\n'); i >= 0 {
+		rest = rest[:i]
+	}
+	return indent, strings.TrimSpace(rest) == ""
+}
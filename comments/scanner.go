@@ -0,0 +1,177 @@
+package comments
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// span is the byte range of a comment in the source.
+type span struct {
+	start, end int
+	doc        bool // Comment uses the language's documentation syntax
+}
+
+// scanner walks source code and records comment spans. Language lexers move
+// pos over literals so that comment markers inside them are not recorded.
+type scanner struct {
+	src   string
+	pos   int
+	spans []span
+}
+
+func (s *scanner) hasPrefix(prefix string) bool {
+	return strings.HasPrefix(s.src[s.pos:], prefix)
+}
+
+// peek returns the byte at pos+offset, or 0 past the end of input.
+func (s *scanner) peek(offset int) byte {
+	if i := s.pos + offset; i >= 0 && i < len(s.src) {
+		return s.src[i]
+	}
+	return 0
+}
+
+func (s *scanner) advance(n int) {
+	s.pos = min(s.pos+n, len(s.src))
+}
+
+// lineComment records a comment from pos to the end of the line. With
+// continued, a backslash before the newline continues the comment (C, C++).
+func (s *scanner) lineComment(doc, continued bool) {
+	start := s.pos
+	for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+		if continued && s.src[s.pos] == '\\' && s.peek(1) == '\n' {
+			s.pos += 2
+			continue
+		}
+		s.pos++
+	}
+	end := s.pos
+	if end > start && s.src[end-1] == '\r' {
+		end--
+	}
+	s.spans = append(s.spans, span{start: start, end: end, doc: doc})
+}
+
+// blockComment records a comment from open to the matching close. Nested
+// comments (Rust, Kotlin, SQL) need a close for every open.
+func (s *scanner) blockComment(open, close string, nested, doc bool) {
+	start := s.pos
+	s.pos += len(open)
+	depth := 1
+	for s.pos < len(s.src) {
+		switch {
+		case nested && s.hasPrefix(open):
+			depth++
+			s.pos += len(open)
+		case s.hasPrefix(close):
+			s.pos += len(close)
+			if depth--; depth == 0 {
+				s.spans = append(s.spans, span{start: start, end: s.pos, doc: doc})
+				return
+			}
+		default:
+			s.pos++
+		}
+	}
+	s.spans = append(s.spans, span{start: start, end: s.pos, doc: doc})
+}
+
+// quoted skips a literal opened by quote at pos. With escapes a backslash
+// skips the following byte; without multiline a newline ends an unterminated literal.
+func (s *scanner) quoted(quote string, escapes, multiline bool) {
+	s.pos += len(quote)
+	for s.pos < len(s.src) {
+		switch c := s.src[s.pos]; {
+		case escapes && c == '\\':
+			s.advance(2)
+		case s.hasPrefix(quote):
+			s.pos += len(quote)
+			return
+		case c == '\n' && !multiline:
+			return
+		default:
+			s.pos++
+		}
+	}
+}
+
+// doubledQuoted skips a literal in which a doubled quote stands for the
+// quote itself, as in SQL and YAML single-quoted strings.
+func (s *scanner) doubledQuoted(quote byte) {
+	s.pos++
+	for s.pos < len(s.src) {
+		if s.src[s.pos] == quote {
+			if s.peek(1) != quote {
+				s.pos++
+				return
+			}
+			s.pos++
+		}
+		s.pos++
+	}
+}
+
+// skipTo moves pos past the next occurrence of closing, or to the end of input.
+func (s *scanner) skipTo(closing string) {
+	if i := strings.Index(s.src[s.pos:], closing); i >= 0 {
+		s.pos += i + len(closing)
+	} else {
+		s.pos = len(s.src)
+	}
+}
+
+// skipLine moves pos to the newline ending the current line.
+func (s *scanner) skipLine() {
+	if i := strings.IndexByte(s.src[s.pos:], '\n'); i >= 0 {
+		s.pos += i
+	} else {
+		s.pos = len(s.src)
+	}
+}
+
+// ident consumes an identifier and returns it.
+func (s *scanner) ident() string {
+	start := s.pos
+	for s.pos < len(s.src) && isIdentByte(s.src[s.pos]) {
+		s.pos++
+	}
+	return s.src[start:s.pos]
+}
+
+// charLiteral skips a character literal such as 'a', '\n' or 'é' at pos. A
+// quote that does not start one (a Rust lifetime) is skipped on its own.
+func (s *scanner) charLiteral() {
+	if s.peek(1) == '\\' {
+		s.quoted("'", true, false)
+		return
+	}
+	_, size := utf8.DecodeRuneInString(s.src[s.pos+1:])
+	if size > 0 && s.peek(1+size) == '\'' {
+		s.pos += 2 + size
+		return
+	}
+	s.pos++
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentByte(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// isDocBlock reports whether a block comment at the start of rest is a
+// "/** ... */" documentation comment (and not "/**/" or a "/****" banner).
+func isDocBlock(rest string) bool {
+	return strings.HasPrefix(rest, "/**") && !strings.HasPrefix(rest, "/**/") && !strings.HasPrefix(rest, "/***")
+}
@@ -1,37 +1,234 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"os"
 	"path/filepath"
+	"projectson/utils"
+	"strconv"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 // ContentExclusionRule defines a rule for excluding content from files.
 type ContentExclusionRule struct {
-	Type        string `yaml:"type"`              // "delimiters" or "regexp"
-	FilePattern string `yaml:"file_pattern"`      // Glob pattern for files (e.g., "*.vue", "vue")
-	Start       string `yaml:"start,omitempty"`   // Start delimiter
-	End         string `yaml:"end,omitempty"`     // End delimiter
-	Pattern     string `yaml:"pattern,omitempty"` // Regex pattern
+	Type            string `yaml:"type"`                        // "delimiters", "regexp" or "comments"
+	FilePattern     string `yaml:"file_pattern"`                // Glob pattern for files (e.g., "*.vue", "vue")
+	Start           string `yaml:"start,omitempty"`             // Start delimiter
+	End             string `yaml:"end,omitempty"`               // End delimiter
+	Pattern         string `yaml:"pattern,omitempty"`           // Regex pattern
+	Language        string `yaml:"language,omitempty"`          // Lexer for "comments"; inferred from the file format when empty
+	KeepDocComments bool   `yaml:"keep_doc_comments,omitempty"` // For "comments": keep doc comments on exported declarations
 }
 
 // Config holds the application configuration.
 type Config struct {
 	Root              string                 `yaml:"root"`
-	Include           []string               `yaml:"include"` // Each entry can be "path" or "path:mode" (path, content, both)
+	Include           []string               `yaml:"include"` // Each entry can be "path", "path:mode[:priority]" (path, content, both), a glob or "!glob"
 	Formats           []string               `yaml:"formats"`
 	Output            string                 `yaml:"output"`
 	ExcludePatterns   []string               `yaml:"exclude_patterns,omitempty"`
 	ContentExclusions []ContentExclusionRule `yaml:"content_exclusions,omitempty"`
+	RespectGitignore  bool                   `yaml:"respect_gitignore,omitempty"` // Apply .gitignore, .git/info/exclude and GlobalGitignore
+	GlobalGitignore   string                 `yaml:"global_gitignore,omitempty"`  // Optional path to a global ignore file (e.g. ~/.config/git/ignore)
+	Tokenizer         string                 `yaml:"tokenizer,omitempty"`         // Token estimator: "chars" (default) or "bpe-approx"
+	CharsPerToken     float64                `yaml:"chars_per_token,omitempty"`   // Ratio for the "chars" tokenizer (default 4)
+	MaxTokens         int                    `yaml:"max_tokens,omitempty"`        // Token budget for the whole output; 0 disables it
+	MaxOutputBytes    int64                  `yaml:"max_output_bytes,omitempty"`  // Size budget for the output file; 0 disables it
+	BudgetAction      string                 `yaml:"budget_action,omitempty"`     // What a run does when a budget is exceeded, see BudgetActions (default "trim")
+	ExcerptTokens     int                    `yaml:"excerpt_tokens,omitempty"`    // Head and tail size of excerpts made by "prune" (default 200)
+	Whitespace        string                 `yaml:"whitespace,omitempty"`        // Whitespace policy for content, see WhitespacePolicies (default "collapse")
+	FormatWhitespace  map[string]string      `yaml:"format_whitespace,omitempty"` // Per-format overrides of Whitespace, e.g. {py: trim_trailing}
+	TabWidth          int                    `yaml:"tab_width,omitempty"`         // Tab stop width for "tabs_to_spaces" (default 4)
+	Order             string                 `yaml:"order,omitempty"`             // Output order of files, see OutputOrders (default "path")
+	OutputFormat      string                 `yaml:"output_format,omitempty"`     // See OutputFormats; inferred from the Output extension when empty
+	OutputTemplate    string                 `yaml:"output_template,omitempty"`   // Path to a text/template file rendering the output; overrides OutputFormat
+	Tree              TreeConfig             `yaml:"tree,omitempty"`              // Project tree section of the output
+	Meta              bool                   `yaml:"meta,omitempty"`              // Add a meta object with the version, config hash, totals and git state
+	Chunking          ChunkingConfig         `yaml:"chunking,omitempty"`          // Split the output into part files
+	FileFields        []string               `yaml:"file_fields,omitempty"`       // Extra per-file fields in the output, see FileFields
+	Cache             bool                   `yaml:"cache,omitempty"`             // Reuse processed files across runs, stored in CacheDir
+	CacheDir          string                 `yaml:"cache_dir,omitempty"`         // Cache directory (default ".projectson-cache" in Root)
+	OnError           string                 `yaml:"on_error,omitempty"`          // What a run does with files it cannot process, see OnErrorPolicies (default "skip")
+	ApplyAllowlist    bool                   `yaml:"apply_allowlist,omitempty"`   // Only let applied AI responses touch the files of the last run and ApplyAllow
+	ApplyAllow        []string               `yaml:"apply_allow,omitempty"`       // Globs relative to Root that applied AI responses may touch; implies ApplyAllowlist
+
+	// ConfigPath is the file the config was loaded from; empty for configs
+	// built in memory.
+	ConfigPath string `yaml:"-"`
+}
+
+// TreeConfig controls the project tree section of the output.
+type TreeConfig struct {
+	Enabled         bool `yaml:"enabled"`
+	MaxDepth        int  `yaml:"max_depth,omitempty"`        // Levels shown below the root; 0 shows all
+	CollapseOver    int  `yaml:"collapse_over,omitempty"`    // Directories with more entries are collapsed; 0 never collapses
+	ShowUncollected bool `yaml:"show_uncollected,omitempty"` // Also list files that exist but are not collected
+}
+
+// ChunkingConfig splits the output into part files next to Config.Output
+// ("output.part-001.json", ...) plus an index file ("output.index.json").
+type ChunkingConfig struct {
+	Enabled   bool  `yaml:"enabled"`
+	MaxTokens int   `yaml:"max_tokens,omitempty"` // Token limit per part; 0 disables it
+	MaxBytes  int64 `yaml:"max_bytes,omitempty"`  // Size limit per part file; 0 disables it
+}
+
+// FileFields lists the accepted values of Config.FileFields, in the order
+// they appear in each output entry.
+var FileFields = []string{"language", "size_bytes", "lines", "tokens", "sha256", "mtime", "bytes_removed"}
+
+// OutputFormats lists the accepted values of Config.OutputFormat.
+var OutputFormats = []string{"json", "jsonl", "markdown", "xml", "text"}
+
+// outputFormatExtensions maps output file extensions to the format they imply.
+var outputFormatExtensions = map[string]string{
+	".jsonl":    "jsonl",
+	".ndjson":   "jsonl",
+	".md":       "markdown",
+	".markdown": "markdown",
+	".xml":      "xml",
+	".txt":      "text",
+	".text":     "text",
+}
+
+// EffectiveOutputFormat returns OutputFormat, or the format implied by the
+// extension of Output when it is empty ("json" for unknown extensions).
+func (c *Config) EffectiveOutputFormat() string {
+	if c.OutputFormat != "" {
+		return c.OutputFormat
+	}
+	if format, ok := outputFormatExtensions[strings.ToLower(filepath.Ext(c.Output))]; ok {
+		return format
+	}
+	return OutputFormats[0]
+}
+
+// OutputOrders lists the accepted values of Config.Order, the first being the default:
+// "path" sorts files by path, "include" groups them by the include entry that
+// collected them, in the order of the include list, and by path within an entry.
+var OutputOrders = []string{"path", "include"}
+
+// OnErrorPolicies lists the accepted values of Config.OnError, the first being
+// the default: "skip" leaves a file that cannot be read or processed out of
+// the output, "fail" stops the run without writing it, and "placeholder"
+// writes an entry with the path and an "error" field instead of the content.
+var OnErrorPolicies = []string{"skip", "fail", "placeholder"}
+
+// BudgetActions lists the accepted values of Config.BudgetAction, the first
+// being the default: "trim" truncates the file crossing a budget and omits
+// the rest, "prune" degrades the lowest include priorities first, and "fail"
+// stops the run without writing the output.
+var BudgetActions = []string{"trim", "prune", "fail"}
+
+// WhitespacePolicies lists the accepted values of Config.Whitespace, the first being the default.
+var WhitespacePolicies = []string{"collapse", "preserve", "trim_trailing", "tabs_to_spaces"}
+
+// WhitespaceFor returns the whitespace policy for a file format, applying
+// FormatWhitespace overrides over the global Whitespace setting.
+func (c *Config) WhitespaceFor(format string) string {
+	if policy, ok := c.FormatWhitespace[strings.ToLower(strings.TrimPrefix(format, "."))]; ok && policy != "" {
+		return policy
+	}
+	if c.Whitespace != "" {
+		return c.Whitespace
+	}
+	return WhitespacePolicies[0]
 }
 
 // ParsedIncludeEntry represents a parsed include item with its mode.
 type ParsedIncludeEntry struct {
 	Path           string
-	Mode           string // "path", "content", or "both"
+	Mode           string // "path", "content", "both", or "outline" (Go API surface)
+	Priority       int    // Higher priorities are degraded last when a budget is exceeded
 	IsDirOnlyFiles bool
+	IsGlob         bool // Path contains glob syntax ("**", "*", "?", "[...]", "{a,b}")
+	Negate         bool // Entry started with "!" and removes matching files collected by earlier entries
+}
+
+// ParseIncludeEntry parses "[!]path[/*][:mode][:priority]". The mode and
+// priority parameters may appear in any order; unknown parameters are ignored.
+func ParseIncludeEntry(entry string) ParsedIncludeEntry {
+	parsed := ParsedIncludeEntry{Mode: "both"}
+	path := strings.TrimSpace(entry)
+	if strings.HasPrefix(path, "!") {
+		parsed.Negate = true
+		path = strings.TrimSpace(path[1:])
+	}
+	if strings.Contains(path, ":") {
+		parts := strings.Split(path, ":")
+		path = strings.TrimSpace(parts[0])
+		for _, part := range parts[1:] {
+			param := strings.TrimSpace(strings.ToLower(part))
+			if param == "path" || param == "content" || param == "both" || param == "outline" {
+				parsed.Mode = param
+			} else if priority, err := strconv.Atoi(param); err == nil {
+				parsed.Priority = priority
+			}
+		}
+	}
+	if strings.HasSuffix(path, "/*") && !utils.HasGlobMeta(strings.TrimSuffix(path, "/*")) {
+		path = strings.TrimSuffix(path, "/*")
+		parsed.IsDirOnlyFiles = true
+	}
+	parsed.Path = path
+	parsed.IsGlob = !parsed.IsDirOnlyFiles && utils.HasGlobMeta(path)
+	return parsed
+}
+
+// String formats the entry back into include syntax, omitting default values.
+func (p ParsedIncludeEntry) String() string {
+	var b strings.Builder
+	if p.Negate {
+		b.WriteString("!")
+	}
+	b.WriteString(p.Path)
+	if p.IsDirOnlyFiles {
+		b.WriteString("/*")
+	}
+	if p.Mode != "" && p.Mode != "both" {
+		b.WriteString(":" + p.Mode)
+	}
+	if p.Priority != 0 {
+		b.WriteString(":" + strconv.Itoa(p.Priority))
+	}
+	return b.String()
+}
+
+func isFileField(name string) bool {
+	for _, f := range FileFields {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isOutputFormat(format string) bool {
+	if format == "" {
+		return true
+	}
+	for _, f := range OutputFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+func isWhitespacePolicy(policy string) bool {
+	if policy == "" {
+		return true
+	}
+	for _, p := range WhitespacePolicies {
+		if p == policy {
+			return true
+		}
+	}
+	return false
 }
 
 // NewDefaultConfig creates a config with some default values.
@@ -69,9 +266,21 @@ func LoadConfig(filePath string) (*Config, error) {
 	if cfg.ContentExclusions == nil {
 		cfg.ContentExclusions = []ContentExclusionRule{}
 	}
+	cfg.ConfigPath = filePath
 	return cfg, nil
 }
 
+// SHA256 returns the hex SHA-256 of the config as SaveConfig would write it,
+// which identifies the effective settings including command-line overrides.
+func (c *Config) SHA256() (string, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 // SaveConfig saves configuration to a YAML file.
 func (c *Config) SaveConfig(filePath string) error {
 	data, err := yaml.Marshal(c)
@@ -81,6 +290,35 @@ func (c *Config) SaveConfig(filePath string) error {
 	return os.WriteFile(filePath, data, 0644)
 }
 
+// ApplyRestricted reports whether applied AI responses are limited to an
+// allowlist: ApplyAllowlist is set or ApplyAllow is not empty.
+func (c *Config) ApplyRestricted() bool {
+	return c.ApplyAllowlist || len(c.ApplyAllow) > 0
+}
+
+// ValidateApply checks the settings used when applying AI responses: the
+// root and ApplyAllow. Unlike Validate it does not require the settings of
+// a collection run, and it creates nothing.
+func (c *Config) ValidateApply() error {
+	if c.Root == "" {
+		return errors.New("config error: 'root' directory not specified")
+	}
+	if info, err := os.Stat(c.Root); err != nil || !info.IsDir() {
+		return errors.New("config error: 'root' directory does not exist: " + c.Root)
+	}
+	return c.validateApplyAllow()
+}
+
+func (c *Config) validateApplyAllow() error {
+	for _, pattern := range c.ApplyAllow {
+		slashed := filepath.ToSlash(pattern)
+		if pattern == "" || filepath.IsAbs(pattern) || strings.HasPrefix(slashed, "/") || slashed == ".." || strings.HasPrefix(slashed, "../") {
+			return errors.New("config error: 'apply_allow' patterns must be relative to the root: " + pattern)
+		}
+	}
+	return nil
+}
+
 // Validate checks if the configuration is valid.
 func (c *Config) Validate() error {
 	if c.Root == "" {
@@ -92,6 +330,58 @@ func (c *Config) Validate() error {
 	if len(c.Formats) == 0 {
 		return errors.New("config error: no file formats specified")
 	}
+	if c.MaxTokens < 0 {
+		return errors.New("config error: 'max_tokens' must not be negative")
+	}
+	if c.MaxOutputBytes < 0 {
+		return errors.New("config error: 'max_output_bytes' must not be negative")
+	}
+	switch c.BudgetAction {
+	case "", "trim", "prune", "fail":
+	default:
+		return errors.New("config error: 'budget_action' must be 'trim', 'prune' or 'fail': " + c.BudgetAction)
+	}
+	if !isWhitespacePolicy(c.Whitespace) {
+		return errors.New("config error: 'whitespace' must be one of " + strings.Join(WhitespacePolicies, ", ") + ": " + c.Whitespace)
+	}
+	for format, policy := range c.FormatWhitespace {
+		if !isWhitespacePolicy(policy) {
+			return errors.New("config error: 'format_whitespace' for '" + format + "' must be one of " + strings.Join(WhitespacePolicies, ", ") + ": " + policy)
+		}
+	}
+	if c.TabWidth < 0 {
+		return errors.New("config error: 'tab_width' must not be negative")
+	}
+	if c.Tree.MaxDepth < 0 || c.Tree.CollapseOver < 0 {
+		return errors.New("config error: 'tree.max_depth' and 'tree.collapse_over' must not be negative")
+	}
+	for _, field := range c.FileFields {
+		if !isFileField(field) {
+			return errors.New("config error: 'file_fields' entries must be one of " + strings.Join(FileFields, ", ") + ": " + field)
+		}
+	}
+	if c.Chunking.MaxTokens < 0 || c.Chunking.MaxBytes < 0 {
+		return errors.New("config error: 'chunking.max_tokens' and 'chunking.max_bytes' must not be negative")
+	}
+	if c.Chunking.Enabled && c.Chunking.MaxTokens == 0 && c.Chunking.MaxBytes == 0 {
+		return errors.New("config error: 'chunking' needs 'max_tokens' or 'max_bytes'")
+	}
+	if !isOutputFormat(c.OutputFormat) {
+		return errors.New("config error: 'output_format' must be one of " + strings.Join(OutputFormats, ", ") + ": " + c.OutputFormat)
+	}
+	switch c.Order {
+	case "", "path", "include":
+	default:
+		return errors.New("config error: 'order' must be 'path' or 'include': " + c.Order)
+	}
+	switch c.OnError {
+	case "", "skip", "fail", "placeholder":
+	default:
+		return errors.New("config error: 'on_error' must be 'skip', 'fail' or 'placeholder': " + c.OnError)
+	}
+	if err := c.validateApplyAllow(); err != nil {
+		return err
+	}
 	if c.Output == "" {
 		return errors.New("config error: output path not specified")
 	}
@@ -0,0 +1,221 @@
+// Package gitinfo reads the state of a git work tree (HEAD commit, branch and
+// whether there are uncommitted changes) straight from the .git directory,
+// without running git.
+package gitinfo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Info describes the checked-out state of a work tree.
+type Info struct {
+	Commit string `json:"commit,omitempty"` // Hex hash of HEAD; empty on an unborn branch
+	Branch string `json:"branch,omitempty"` // Short branch name; empty when HEAD is detached
+	Dirty  bool   `json:"dirty"`            // Tracked files differ from HEAD, in the index or the work tree
+}
+
+// repo locates the parts of a repository. gitDir holds HEAD and the index of
+// the work tree; commonDir holds objects, refs and config, and differs from
+// gitDir only in linked work trees ("git worktree add").
+type repo struct {
+	workTree  string
+	gitDir    string
+	commonDir string
+	config    map[string]string // "section.key" -> value, keys lower-cased
+	hashSize  int               // 20 for SHA-1, 32 for SHA-256 repositories
+}
+
+// Read returns the state of the work tree that contains dir, or nil when dir
+// is not inside a git work tree.
+func Read(dir string) (*Info, error) {
+	r, err := openRepo(dir)
+	if err != nil || r == nil {
+		return nil, err
+	}
+	info := &Info{}
+	ref, commit, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	info.Commit = commit
+	info.Branch = strings.TrimPrefix(ref, "refs/heads/")
+
+	info.Dirty, err = r.dirty(commit)
+	if err != nil {
+		return nil, fmt.Errorf("checking work tree status: %w", err)
+	}
+	return info, nil
+}
+
+// openRepo finds the .git directory or file in dir or one of its parents.
+func openRepo(dir string) (*repo, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if fi, err := os.Stat(dotGit); err == nil {
+			gitDir := dotGit
+			if !fi.IsDir() {
+				if gitDir, err = readGitFile(dotGit); err != nil {
+					return nil, err
+				}
+			}
+			return newRepo(dir, gitDir)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// readGitFile follows a "gitdir: <path>" file, as used by linked work trees
+// and submodules.
+func readGitFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return "", fmt.Errorf("%s is not a gitdir file", path)
+	}
+	target = strings.TrimSpace(target)
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	return target, nil
+}
+
+func newRepo(workTree, gitDir string) (*repo, error) {
+	r := &repo{workTree: workTree, gitDir: gitDir, commonDir: gitDir, hashSize: 20}
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(gitDir, common)
+		}
+		r.commonDir = common
+	}
+	config, err := readConfig(filepath.Join(r.commonDir, "config"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	r.config = config
+	switch strings.ToLower(r.config["extensions.objectformat"]) {
+	case "", "sha1":
+	case "sha256":
+		r.hashSize = 32
+	default:
+		return nil, fmt.Errorf("unsupported object format %q", r.config["extensions.objectformat"])
+	}
+	if storage := strings.ToLower(r.config["extensions.refstorage"]); storage != "" && storage != "files" {
+		return nil, fmt.Errorf("unsupported ref storage %q", storage)
+	}
+	return r, nil
+}
+
+// readConfig reads the plain "key = value" entries of a git config file.
+// Includes, subsections and multi-line values are not needed here and are
+// not interpreted.
+func readConfig(path string) (map[string]string, error) {
+	config := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return config, err
+	}
+	defer file.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' {
+			name, _, _ := strings.Cut(strings.Trim(line, "[]"), " ")
+			section = strings.ToLower(name)
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if !found {
+			value = "true" // A bare key is a boolean true
+		}
+		config[section+"."+key] = value
+	}
+	return config, scanner.Err()
+}
+
+// configBool returns a boolean config value, or def when it is not set.
+func (r *repo) configBool(key string, def bool) bool {
+	switch strings.ToLower(r.config[key]) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0":
+		return false
+	}
+	return def
+}
+
+// head returns the ref HEAD points to ("" when detached) and the commit it
+// resolves to ("" on an unborn branch).
+func (r *repo) head() (ref, commit string, err error) {
+	target, err := r.readRef("HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("reading HEAD: %w", err)
+	}
+	for depth := 0; strings.HasPrefix(target, "ref: "); depth++ {
+		if depth == 5 {
+			return "", "", errors.New("reading HEAD: too many symbolic refs")
+		}
+		ref = strings.TrimSpace(strings.TrimPrefix(target, "ref: "))
+		if target, err = r.readRef(ref); os.IsNotExist(err) {
+			return ref, "", nil
+		} else if err != nil {
+			return "", "", fmt.Errorf("reading %s: %w", ref, err)
+		}
+	}
+	return ref, target, nil
+}
+
+// readRef returns the content of a loose ref, falling back to packed-refs.
+func (r *repo) readRef(name string) (string, error) {
+	for _, dir := range []string{r.gitDir, r.commonDir} {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	file, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue
+		}
+		if hash, ref, ok := strings.Cut(line, " "); ok && ref == name {
+			return hash, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", os.ErrNotExist
+}
@@ -0,0 +1,176 @@
+package gitinfo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// File modes used in trees and the index.
+const (
+	modeTree    = 0o040000
+	modeFile    = 0o100644
+	modeExec    = 0o100755
+	modeSymlink = 0o120000
+	modeGitlink = 0o160000
+)
+
+// indexEntry is one entry of the index (.git/index).
+type indexEntry struct {
+	path         string // Slash-separated, relative to the work tree
+	mtimeSec     uint32
+	mtimeNsec    uint32
+	mode         uint32
+	size         uint32 // Work tree size, truncated to 32 bits
+	hash         string
+	stage        int // 0 unless the entry is part of an unresolved merge
+	skipWorktree bool
+	intentToAdd  bool
+}
+
+// index is the parsed index of a work tree.
+type index struct {
+	entries []indexEntry
+	tree    string // Root tree hash from the cache-tree extension, "" when unknown or invalid
+	mtime   int64  // Modification time of the index file in nanoseconds
+}
+
+// readIndex parses an index file of version 2, 3 or 4. A missing index is
+// returned as an empty one.
+func readIndex(path string, hashSize int) (*index, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &index{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	idx := &index{mtime: fi.ModTime().UnixNano()}
+
+	errMalformed := errors.New("malformed index")
+	if len(data) < 12+hashSize || string(data[:4]) != "DIRC" {
+		return nil, errMalformed
+	}
+	version := binary.BigEndian.Uint32(data[4:])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("unsupported index version %d", version)
+	}
+	count := int(binary.BigEndian.Uint32(data[8:]))
+	data = data[12 : len(data)-hashSize] // Drop the trailing checksum
+
+	fixed := 40 + hashSize + 2 // Stat data, hash and flags
+	previous := ""
+	for i := 0; i < count; i++ {
+		if len(data) < fixed {
+			return nil, errMalformed
+		}
+		e := indexEntry{
+			mtimeSec:  binary.BigEndian.Uint32(data[8:]),
+			mtimeNsec: binary.BigEndian.Uint32(data[12:]),
+			mode:      binary.BigEndian.Uint32(data[24:]),
+			size:      binary.BigEndian.Uint32(data[36:]),
+			hash:      hex.EncodeToString(data[40 : 40+hashSize]),
+		}
+		flags := binary.BigEndian.Uint16(data[40+hashSize:])
+		e.stage = int(flags>>12) & 3
+		pos := fixed
+		if flags&0x4000 != 0 { // Extended flags, version 3 and later
+			if len(data) < pos+2 {
+				return nil, errMalformed
+			}
+			extended := binary.BigEndian.Uint16(data[pos:])
+			e.skipWorktree = extended&0x4000 != 0
+			e.intentToAdd = extended&0x2000 != 0
+			pos += 2
+		}
+
+		if version == 4 {
+			// The path is stored as the number of bytes to drop from the end
+			// of the previous path, followed by the suffix to append.
+			strip, n := indexVarint(data[pos:])
+			if n == 0 || strip > len(previous) {
+				return nil, errMalformed
+			}
+			pos += n
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, errMalformed
+			}
+			e.path = previous[:len(previous)-strip] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, errMalformed
+			}
+			e.path = string(data[pos : pos+end])
+			// Entries are padded with 1 to 8 NUL bytes to a multiple of 8.
+			pos = (pos + end + 8) &^ 7
+			if pos > len(data) {
+				return nil, errMalformed
+			}
+		}
+		previous = e.path
+		idx.entries = append(idx.entries, e)
+		data = data[pos:]
+	}
+
+	for len(data) >= 8 {
+		signature := string(data[:4])
+		size := int(binary.BigEndian.Uint32(data[4:]))
+		if len(data) < 8+size {
+			return nil, errMalformed
+		}
+		if signature == "TREE" {
+			idx.tree = cacheTreeRoot(data[8:8+size], hashSize)
+		}
+		data = data[8+size:]
+	}
+	return idx, nil
+}
+
+// indexVarint decodes the offset encoding of version 4 paths and returns the
+// value and the number of bytes read, 0 on malformed input.
+func indexVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	c := data[0]
+	value, n := int(c&0x7f), 1
+	for c&0x80 != 0 {
+		if n == len(data) {
+			return 0, 0
+		}
+		c = data[n]
+		n++
+		value = (value+1)<<7 | int(c&0x7f)
+	}
+	return value, n
+}
+
+// cacheTreeRoot returns the root tree hash recorded in the cache-tree
+// extension, or "" when it was invalidated by a change in the index.
+func cacheTreeRoot(data []byte, hashSize int) string {
+	// The first record is the root: "\x00<entry count> <subtrees>\n<hash>".
+	path, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || len(path) != 0 {
+		return ""
+	}
+	header, rest, ok := bytes.Cut(rest, []byte{'\n'})
+	if !ok {
+		return ""
+	}
+	countText, _, _ := bytes.Cut(header, []byte{' '})
+	if count, err := strconv.Atoi(string(countText)); err != nil || count < 0 || len(rest) < hashSize {
+		return ""
+	}
+	return hex.EncodeToString(rest[:hashSize])
+}
@@ -0,0 +1,388 @@
+package gitinfo
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Object types as stored in pack files.
+const (
+	objCommit   = 1
+	objTree     = 2
+	objBlob     = 3
+	objTag      = 4
+	objOfsDelta = 6
+	objRefDelta = 7
+)
+
+var objectTypes = map[string]int{"commit": objCommit, "tree": objTree, "blob": objBlob, "tag": objTag}
+
+// objectStore reads objects from the loose object directories and pack files
+// of a repository and its alternates.
+type objectStore struct {
+	hashSize int
+	dirs     []string // objects directories, the repository's own first
+	packs    []*pack  // Loaded on first use
+	loaded   bool
+}
+
+func (r *repo) objects() *objectStore {
+	dirs := []string{filepath.Join(r.commonDir, "objects")}
+	if data, err := os.ReadFile(filepath.Join(dirs[0], "info", "alternates")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			if !filepath.IsAbs(line) {
+				line = filepath.Join(dirs[0], line)
+			}
+			dirs = append(dirs, line)
+		}
+	}
+	return &objectStore{hashSize: r.hashSize, dirs: dirs}
+}
+
+// read returns the type and content of the object with the given hex hash.
+func (s *objectStore) read(hash string) (int, []byte, error) {
+	for _, dir := range s.dirs {
+		typ, data, err := readLooseObject(filepath.Join(dir, hash[:2], hash[2:]))
+		if err == nil {
+			return typ, data, nil
+		}
+		if !os.IsNotExist(err) {
+			return 0, nil, fmt.Errorf("object %s: %w", hash, err)
+		}
+	}
+	raw, err := hex.DecodeString(hash)
+	if err != nil || len(raw) != s.hashSize {
+		return 0, nil, fmt.Errorf("invalid object hash %q", hash)
+	}
+	if err := s.loadPacks(); err != nil {
+		return 0, nil, err
+	}
+	for _, p := range s.packs {
+		if offset, ok := p.find(raw); ok {
+			typ, data, err := p.read(s, offset)
+			if err != nil {
+				return 0, nil, fmt.Errorf("object %s: %w", hash, err)
+			}
+			return typ, data, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("object %s not found", hash)
+}
+
+// readTyped reads an object and checks its type.
+func (s *objectStore) readTyped(hash string, want int) ([]byte, error) {
+	typ, data, err := s.read(hash)
+	if err != nil {
+		return nil, err
+	}
+	if typ != want {
+		return nil, fmt.Errorf("object %s has type %d, want %d", hash, typ, want)
+	}
+	return data, nil
+}
+
+func readLooseObject(path string) (int, []byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	zr, err := zlib.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return 0, nil, err
+	}
+	header, body, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return 0, nil, errors.New("malformed loose object")
+	}
+	name, size, _ := strings.Cut(string(header), " ")
+	typ, ok := objectTypes[name]
+	if n, err := strconv.Atoi(size); !ok || err != nil || n != len(body) {
+		return 0, nil, errors.New("malformed loose object header")
+	}
+	return typ, body, nil
+}
+
+func (s *objectStore) loadPacks() error {
+	if s.loaded {
+		return nil
+	}
+	s.loaded = true
+	for _, dir := range s.dirs {
+		indexes, _ := filepath.Glob(filepath.Join(dir, "pack", "*.idx"))
+		for _, idx := range indexes {
+			p, err := openPack(idx, s.hashSize)
+			if err != nil {
+				return fmt.Errorf("reading pack index %s: %w", filepath.Base(idx), err)
+			}
+			s.packs = append(s.packs, p)
+		}
+	}
+	return nil
+}
+
+// pack is a pack file with its version 2 index.
+type pack struct {
+	path     string
+	hashSize int
+	fanout   [256]uint32
+	hashes   []byte // Sorted object hashes, hashSize bytes each
+	offsets  []byte // 4-byte offsets; the high bit refers to largeOffsets
+	large    []byte // 8-byte offsets
+}
+
+func openPack(indexPath string, hashSize int) (*pack, error) {
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 8+256*4 || !bytes.Equal(data[:4], []byte{0xff, 't', 'O', 'c'}) || binary.BigEndian.Uint32(data[4:]) != 2 {
+		return nil, errors.New("unsupported pack index version")
+	}
+	p := &pack{path: strings.TrimSuffix(indexPath, ".idx") + ".pack", hashSize: hashSize}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(data[8+4*i:])
+	}
+	n := int(p.fanout[255])
+	pos := 8 + 256*4
+	if len(data) < pos+n*(hashSize+8) {
+		return nil, errors.New("truncated pack index")
+	}
+	p.hashes = data[pos : pos+n*hashSize]
+	pos += n*hashSize + n*4 // Skip the CRC32 table
+	p.offsets = data[pos : pos+n*4]
+	p.large = data[pos+n*4:]
+	return p, nil
+}
+
+// find returns the pack offset of an object.
+func (p *pack) find(hash []byte) (int64, bool) {
+	lo := 0
+	if hash[0] > 0 {
+		lo = int(p.fanout[hash[0]-1])
+	}
+	hi := int(p.fanout[hash[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.hashes[(lo+i)*p.hashSize:(lo+i+1)*p.hashSize], hash) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.hashes[i*p.hashSize:(i+1)*p.hashSize], hash) {
+		return 0, false
+	}
+	offset := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), true
+	}
+	j := int(offset & 0x7fffffff)
+	if len(p.large) < (j+1)*8 {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(p.large[j*8:])), true
+}
+
+// read returns the object at offset, resolving deltas against their bases.
+func (p *pack) read(s *objectStore, offset int64) (int, []byte, error) {
+	file, err := os.Open(p.path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+	return p.readAt(s, file, offset, 0)
+}
+
+func (p *pack) readAt(s *objectStore, file *os.File, offset int64, depth int) (int, []byte, error) {
+	if depth > 64 {
+		return 0, nil, errors.New("delta chain too long")
+	}
+	br := bufio.NewReader(io.NewSectionReader(file, offset, 1<<62))
+	c, err := br.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	typ := int(c>>4) & 7
+	for c&0x80 != 0 { // The inflated size; zlib tells us where the data ends
+		if c, err = br.ReadByte(); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var baseType int
+	var base []byte
+	switch typ {
+	case objCommit, objTree, objBlob, objTag:
+	case objOfsDelta:
+		c, err := br.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		back := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = br.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+			back = (back+1)<<7 | int64(c&0x7f)
+		}
+		if baseType, base, err = p.readAt(s, file, offset-back, depth+1); err != nil {
+			return 0, nil, err
+		}
+	case objRefDelta:
+		raw := make([]byte, p.hashSize)
+		if _, err := io.ReadFull(br, raw); err != nil {
+			return 0, nil, err
+		}
+		if baseType, base, err = s.read(hex.EncodeToString(raw)); err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, fmt.Errorf("unknown pack object type %d", typ)
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		return 0, nil, err
+	}
+	if base == nil {
+		return typ, data, nil
+	}
+	data, err = applyDelta(base, data)
+	return baseType, data, err
+}
+
+// applyDelta rebuilds an object from its base and a pack delta.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errMalformed := errors.New("malformed delta")
+	varint := func() (int, bool) {
+		n, shift := 0, 0
+		for len(delta) > 0 {
+			c := delta[0]
+			delta = delta[1:]
+			n |= int(c&0x7f) << shift
+			shift += 7
+			if c&0x80 == 0 {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+	baseSize, ok1 := varint()
+	size, ok2 := varint()
+	if !ok1 || !ok2 || baseSize != len(base) {
+		return nil, errMalformed
+	}
+	out := make([]byte, 0, size)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		if op&0x80 == 0 {
+			if op == 0 || int(op) > len(delta) {
+				return nil, errMalformed
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+			continue
+		}
+		var offset, n int
+		for i := 0; i < 7; i++ {
+			if op&(1<<i) == 0 {
+				continue
+			}
+			if len(delta) == 0 {
+				return nil, errMalformed
+			}
+			if i < 4 {
+				offset |= int(delta[0]) << (8 * i)
+			} else {
+				n |= int(delta[0]) << (8 * (i - 4))
+			}
+			delta = delta[1:]
+		}
+		if n == 0 {
+			n = 0x10000
+		}
+		if offset+n > len(base) {
+			return nil, errMalformed
+		}
+		out = append(out, base[offset:offset+n]...)
+	}
+	if len(out) != size {
+		return nil, errMalformed
+	}
+	return out, nil
+}
+
+// commitTree returns the tree hash of a commit.
+func (s *objectStore) commitTree(commit string) (string, error) {
+	data, err := s.readTyped(commit, objCommit)
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := bytes.Cut(data, []byte{'\n'})
+	tree, ok := bytes.CutPrefix(line, []byte("tree "))
+	if !ok {
+		return "", fmt.Errorf("commit %s has no tree", commit)
+	}
+	return string(tree), nil
+}
+
+// treeEntry is a file, symlink or submodule listed in a tree.
+type treeEntry struct {
+	mode uint32
+	hash string
+}
+
+// flattenTree lists the non-directory entries below a tree by slash-separated
+// path. Subtrees are also recorded in dirs, so sparse index entries, which
+// stand for whole directories, can be compared with them.
+func (s *objectStore) flattenTree(hash, prefix string, files, dirs map[string]treeEntry) error {
+	data, err := s.readTyped(hash, objTree)
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		header, rest, ok := bytes.Cut(data, []byte{0})
+		if !ok || len(rest) < s.hashSize {
+			return fmt.Errorf("malformed tree %s", hash)
+		}
+		modeText, name, _ := strings.Cut(string(header), " ")
+		mode, err := strconv.ParseUint(modeText, 8, 32)
+		if err != nil {
+			return fmt.Errorf("malformed tree %s", hash)
+		}
+		entry := treeEntry{mode: uint32(mode), hash: hex.EncodeToString(rest[:s.hashSize])}
+		data = rest[s.hashSize:]
+		path := prefix + name
+		if entry.mode == modeTree {
+			dirs[path] = entry
+			if err := s.flattenTree(entry.hash, path+"/", files, dirs); err != nil {
+				return err
+			}
+			continue
+		}
+		files[path] = entry
+	}
+	return nil
+}
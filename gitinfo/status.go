@@ -0,0 +1,159 @@
+package gitinfo
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dirty reports whether the index differs from the tree of commit, or the
+// work tree differs from the index, for tracked files. Untracked files do not
+// count, as they are not part of any commit. Content filters such as
+// core.autocrlf are not applied, so a file converted on checkout is compared
+// by its stat data only.
+func (r *repo) dirty(commit string) (bool, error) {
+	idx, err := readIndex(filepath.Join(r.gitDir, "index"), r.hashSize)
+	if err != nil {
+		return false, err
+	}
+	for _, e := range idx.entries {
+		if e.stage != 0 || e.intentToAdd {
+			return true, nil
+		}
+	}
+	staged, err := r.stagedChanges(idx, commit)
+	if err != nil || staged {
+		return staged, err
+	}
+	return r.worktreeChanges(idx)
+}
+
+// stagedChanges compares the index with the tree of commit.
+func (r *repo) stagedChanges(idx *index, commit string) (bool, error) {
+	if commit == "" {
+		return len(idx.entries) > 0, nil
+	}
+	objects := r.objects()
+	tree, err := objects.commitTree(commit)
+	if err != nil {
+		return false, err
+	}
+	if idx.tree != "" {
+		// The cache-tree extension is kept up to date by commands that
+		// write the index and holds the tree the index would commit.
+		return idx.tree != tree, nil
+	}
+	files := make(map[string]treeEntry)
+	dirs := make(map[string]treeEntry)
+	if err := objects.flattenTree(tree, "", files, dirs); err != nil {
+		return false, err
+	}
+	var sparseDirs []string
+	seen := 0
+	for _, e := range idx.entries {
+		if e.mode == modeTree {
+			// A sparse index entry standing for a whole directory.
+			dir := strings.TrimSuffix(e.path, "/")
+			if t, ok := dirs[dir]; !ok || t.hash != e.hash {
+				return true, nil
+			}
+			sparseDirs = append(sparseDirs, dir+"/")
+			continue
+		}
+		t, ok := files[e.path]
+		if !ok || t.hash != e.hash || t.mode != e.mode {
+			return true, nil
+		}
+		seen++
+	}
+	// Files of HEAD that are missing from the index are deleted, unless a
+	// sparse directory entry covers them.
+	return seen+countCovered(files, sparseDirs) != len(files), nil
+}
+
+// countCovered counts the files below any of the sparse directories.
+func countCovered(files map[string]treeEntry, sparseDirs []string) int {
+	if len(sparseDirs) == 0 {
+		return 0
+	}
+	n := 0
+	for path := range files {
+		for _, dir := range sparseDirs {
+			if strings.HasPrefix(path, dir) {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// worktreeChanges compares the work tree with the index. Files whose size
+// and modification time match the index are taken as unchanged, the way git
+// does; the others are hashed.
+func (r *repo) worktreeChanges(idx *index) (bool, error) {
+	fileMode := r.configBool("core.filemode", true)
+	for _, e := range idx.entries {
+		if e.skipWorktree || e.mode == modeGitlink || e.mode == modeTree {
+			continue
+		}
+		path := filepath.Join(r.workTree, filepath.FromSlash(e.path))
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		isLink := fi.Mode()&os.ModeSymlink != 0
+		if isLink != (e.mode == modeSymlink) || (!isLink && !fi.Mode().IsRegular()) {
+			return true, nil
+		}
+		if fileMode && !isLink && (fi.Mode()&0o100 != 0) != (e.mode == modeExec) {
+			return true, nil
+		}
+		if uint32(fi.Size()) != e.size {
+			return true, nil
+		}
+		mtime := fi.ModTime()
+		sameTime := uint32(mtime.Unix()) == e.mtimeSec && (e.mtimeNsec == 0 || uint32(mtime.Nanosecond()) == e.mtimeNsec)
+		// A file modified in the same instant the index was written may have
+		// changed without its stat data showing it ("racy git").
+		racy := int64(e.mtimeSec)*1e9+int64(e.mtimeNsec) >= idx.mtime
+		if sameTime && !racy {
+			continue
+		}
+		var content []byte
+		if isLink {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return false, err
+			}
+			content = []byte(target)
+		} else if content, err = os.ReadFile(path); err != nil {
+			return false, err
+		}
+		if r.blobHash(content) != e.hash {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// blobHash returns the object hash git gives content stored as a blob.
+func (r *repo) blobHash(content []byte) string {
+	var h hash.Hash
+	if r.hashSize == 32 {
+		h = sha256.New()
+	} else {
+		h = sha1.New()
+	}
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,300 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// bpeVocab is a byte-level BPE vocabulary in tiktoken format ("<base64 token> <rank>"
+// per line). Single bytes are implicit and take ranks 0-255. The vocabulary was
+// trained on source code and documentation with the cl100k pre-tokenizer, but
+// it is far smaller than cl100k_base and its ranks differ, so counts are only
+// a rough approximation of what a real model's tokenizer produces.
+//
+//go:embed bpe_vocab.txt
+var bpeVocab []byte
+
+const (
+	maxPieceBytes  = 256     // Longer pieces (minified code, base64 blobs) are encoded in chunks
+	maxCachePieces = 1 << 16 // Piece count cache is reset once it grows past this
+)
+
+var (
+	bpeRanksOnce sync.Once
+	bpeRanks     map[string]int
+	bpeRanksErr  error
+)
+
+func loadBPERanks() (map[string]int, error) {
+	bpeRanksOnce.Do(func() {
+		ranks := make(map[string]int, 16384)
+		scanner := bufio.NewScanner(bytes.NewReader(bpeVocab))
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			sep := bytes.IndexByte(line, ' ')
+			if sep < 0 {
+				bpeRanksErr = fmt.Errorf("malformed vocabulary line %q", line)
+				return
+			}
+			token, err := base64.StdEncoding.DecodeString(string(line[:sep]))
+			if err != nil {
+				bpeRanksErr = fmt.Errorf("decoding vocabulary token %q: %w", line[:sep], err)
+				return
+			}
+			rank, err := strconv.Atoi(string(line[sep+1:]))
+			if err != nil {
+				bpeRanksErr = fmt.Errorf("parsing vocabulary rank %q: %w", line[sep+1:], err)
+				return
+			}
+			ranks[string(token)] = rank
+		}
+		bpeRanks = ranks
+	})
+	return bpeRanks, bpeRanksErr
+}
+
+// bpeEstimator counts tokens with byte-level BPE over cl100k-style pre-tokenized pieces.
+type bpeEstimator struct {
+	name  string
+	ranks map[string]int
+
+	mu    sync.Mutex
+	cache map[string]int
+}
+
+func newBPE(name string) (*bpeEstimator, error) {
+	ranks, err := loadBPERanks()
+	if err != nil {
+		return nil, fmt.Errorf("loading %s vocabulary: %w", name, err)
+	}
+	return &bpeEstimator{name: name, ranks: ranks, cache: make(map[string]int)}, nil
+}
+
+func (b *bpeEstimator) Name() string { return b.name }
+
+func (b *bpeEstimator) Count(text string) int {
+	total := 0
+	splitPieces(text, func(piece string) {
+		total += b.pieceCount(piece)
+	})
+	return total
+}
+
+func (b *bpeEstimator) Truncate(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	total, end := 0, 0
+	done := false
+	splitPieces(text, func(piece string) {
+		if done {
+			return
+		}
+		tokens := b.encodePiece(piece)
+		if total+len(tokens) <= maxTokens {
+			total += len(tokens)
+			end += len(piece)
+			return
+		}
+		for _, token := range tokens[:maxTokens-total] {
+			end += len(token)
+		}
+		done = true
+	})
+	prefix := text[:end]
+	// Byte-level tokens may end inside a multi-byte rune.
+	for !utf8.ValidString(prefix) && len(prefix) > 0 {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
+
+func (b *bpeEstimator) pieceCount(piece string) int {
+	b.mu.Lock()
+	if n, ok := b.cache[piece]; ok {
+		b.mu.Unlock()
+		return n
+	}
+	b.mu.Unlock()
+
+	n := len(b.encodePiece(piece))
+
+	b.mu.Lock()
+	if len(b.cache) >= maxCachePieces {
+		b.cache = make(map[string]int)
+	}
+	b.cache[piece] = n
+	b.mu.Unlock()
+	return n
+}
+
+// encodePiece splits a pre-tokenized piece into BPE tokens by repeatedly
+// merging the adjacent pair with the lowest rank.
+func (b *bpeEstimator) encodePiece(piece string) []string {
+	if _, ok := b.ranks[piece]; ok || len(piece) <= 1 {
+		return []string{piece}
+	}
+	if len(piece) > maxPieceBytes {
+		var tokens []string
+		for start := 0; start < len(piece); start += maxPieceBytes {
+			end := min(start+maxPieceBytes, len(piece))
+			tokens = append(tokens, b.encodePiece(piece[start:end])...)
+		}
+		return tokens
+	}
+
+	parts := make([]string, len(piece))
+	for i := range piece {
+		parts[i] = piece[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, int(^uint(0)>>1)
+		for i := 0; i < len(parts)-1; i++ {
+			if rank, ok := b.ranks[parts[i]+parts[i+1]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	return parts
+}
+
+// splitPieces implements the cl100k_base pre-tokenization pattern:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// by hand, since Go's regexp has no lookahead.
+func splitPieces(text string, fn func(piece string)) {
+	for i := 0; i < len(text); {
+		n := matchPiece(text[i:])
+		fn(text[i : i+n])
+		i += n
+	}
+}
+
+func matchPiece(s string) int {
+	r, size := utf8.DecodeRuneInString(s)
+
+	if r == '\'' {
+		if n := matchContraction(s[1:]); n > 0 {
+			return 1 + n
+		}
+	}
+
+	if unicode.IsLetter(r) {
+		return size + runLength(s[size:], unicode.IsLetter)
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) {
+		if next, _ := utf8.DecodeRuneInString(s[size:]); size < len(s) && unicode.IsLetter(next) {
+			return size + runLength(s[size:], unicode.IsLetter)
+		}
+	}
+
+	if unicode.IsNumber(r) {
+		n := size
+		for count := 1; count < 3 && n < len(s); count++ {
+			next, nextSize := utf8.DecodeRuneInString(s[n:])
+			if !unicode.IsNumber(next) {
+				break
+			}
+			n += nextSize
+		}
+		return n
+	}
+
+	start := 0
+	if r == ' ' {
+		start = 1
+	}
+	if start < len(s) {
+		if next, _ := utf8.DecodeRuneInString(s[start:]); isPunct(next) {
+			n := start + runLength(s[start:], isPunct)
+			for n < len(s) && (s[n] == '\r' || s[n] == '\n') {
+				n++
+			}
+			return n
+		}
+	}
+
+	if unicode.IsSpace(r) {
+		end, lastNewlineEnd, lastRuneStart := 0, -1, 0
+		for end < len(s) {
+			next, nextSize := utf8.DecodeRuneInString(s[end:])
+			if !unicode.IsSpace(next) {
+				break
+			}
+			lastRuneStart = end
+			end += nextSize
+			if next == '\r' || next == '\n' {
+				lastNewlineEnd = end
+			}
+		}
+		switch {
+		case lastNewlineEnd > 0: // \s*[\r\n]+
+			return lastNewlineEnd
+		case end == len(s): // \s+(?!\S) at end of text
+			return end
+		case lastRuneStart > 0: // \s+(?!\S): leave the last space for the next piece
+			return lastRuneStart
+		default: // \s+
+			return end
+		}
+	}
+	return size
+}
+
+func matchContraction(s string) int {
+	if len(s) >= 2 {
+		switch lower := toLowerASCII(s[:2]); lower {
+		case "re", "ve", "ll":
+			return 2
+		}
+	}
+	if len(s) >= 1 {
+		switch toLowerASCII(s[:1]) {
+		case "s", "t", "m", "d":
+			return 1
+		}
+	}
+	return 0
+}
+
+func toLowerASCII(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + 'a' - 'A'
+		}
+	}
+	return string(b)
+}
+
+func runLength(s string, pred func(rune) bool) int {
+	n := 0
+	for n < len(s) {
+		r, size := utf8.DecodeRuneInString(s[n:])
+		if !pred(r) {
+			break
+		}
+		n += size
+	}
+	return n
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
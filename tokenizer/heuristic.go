@@ -0,0 +1,47 @@
+package tokenizer
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// DefaultCharsPerToken is a common rule of thumb for English text and source code.
+const DefaultCharsPerToken = 4.0
+
+// CharsEstimator estimates tokens as characters divided by a fixed ratio.
+// It is much faster than BPE and good enough for rough budgets.
+type CharsEstimator struct {
+	CharsPerToken float64
+}
+
+// NewCharsEstimator creates a heuristic estimator. A non-positive ratio selects DefaultCharsPerToken.
+func NewCharsEstimator(charsPerToken float64) *CharsEstimator {
+	if charsPerToken <= 0 {
+		charsPerToken = DefaultCharsPerToken
+	}
+	return &CharsEstimator{CharsPerToken: charsPerToken}
+}
+
+func (e *CharsEstimator) Name() string { return "chars" }
+
+func (e *CharsEstimator) Count(text string) int {
+	if text == "" {
+		return 0
+	}
+	return int(math.Ceil(float64(utf8.RuneCountInString(text)) / e.CharsPerToken))
+}
+
+func (e *CharsEstimator) Truncate(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+	maxChars := int(float64(maxTokens) * e.CharsPerToken)
+	count := 0
+	for i := range text {
+		if count == maxChars {
+			return text[:i]
+		}
+		count++
+	}
+	return text
+}
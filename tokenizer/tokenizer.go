@@ -0,0 +1,72 @@
+package tokenizer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Estimator counts (or estimates) the number of LLM tokens in a text.
+type Estimator interface {
+	// Name returns the identifier the estimator was registered under.
+	Name() string
+	// Count returns the number of tokens in text.
+	Count(text string) int
+	// Truncate returns the longest prefix of text that fits into maxTokens.
+	Truncate(text string, maxTokens int) string
+}
+
+// Options configures estimators created by New.
+type Options struct {
+	CharsPerToken float64 // Used by the "chars" heuristic; defaults to DefaultCharsPerToken
+}
+
+// Factory creates an Estimator from Options.
+type Factory func(opts Options) (Estimator, error)
+
+// DefaultName is the estimator used when the config does not name one.
+const DefaultName = "chars"
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Factory{}
+)
+
+// Register makes an estimator available under name. It replaces any previous registration.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[strings.ToLower(name)] = factory
+}
+
+// Names returns the registered estimator names in sorted order.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the estimator registered under name ("" selects DefaultName).
+func New(name string, opts Options) (Estimator, error) {
+	if name == "" {
+		name = DefaultName
+	}
+	registryMu.RLock()
+	factory, ok := registry[strings.ToLower(name)]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown tokenizer %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return factory(opts)
+}
+
+func init() {
+	Register("bpe-approx", func(opts Options) (Estimator, error) { return newBPE("bpe-approx") })
+	Register("chars", func(opts Options) (Estimator, error) { return NewCharsEstimator(opts.CharsPerToken), nil })
+}
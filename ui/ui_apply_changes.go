@@ -1,11 +1,10 @@
 package ui
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
-	"projectson/collector" // For AIResponse and AIFileModification
+	"projectson/changeset"
+	"projectson/collector"
 	"strings"
 
 	"fyne.io/fyne/v2"
@@ -19,27 +18,112 @@ func MakeApplyChangesPage(collectorService *CollectorService, window fyne.Window
 	aiResponseEntry := widget.NewMultiLineEntry()
 	aiResponseEntry.SetPlaceHolder("Paste AI-generated JSON response here...")
 	aiResponseEntry.Wrapping = fyne.TextWrapOff // JSON is often better without wrapping
-	aiResponseEntry.SetMinRowsVisible(15)
+	aiResponseEntry.SetMinRowsVisible(10)       // Leaves room for the list of changes below
 
-	// The AI response 'path' field MUST match `FileEntry.Path` format,
-	// which is `basename(Root) + os.PathSeparator + relative_path_from_root`.
-	// The `applyFileModification` function will need to strip `basename(Root) + os.PathSeparator`
-	// to get the `OriginalPath` that can be joined with `Config.Root` to get the absolute file path.
+	// The dry run of the pasted response and the modifications selected in it.
+	var planResp *collector.AIResponse
+	var plan *changeset.Report
+	var accepted []bool
+	var applyButton *widget.Button
+	var history *historyPanel
+	planLabel := widget.NewLabel("Press 'Preview Changes' to see what the response would change.")
 
-	applyButton := widget.NewButtonWithIcon("Apply Changes to Files", theme.ConfirmIcon(), func() {
-		statusBar.SetText("Processing AI response...")
-		aiJsonInput := aiResponseEntry.Text
-		if strings.TrimSpace(aiJsonInput) == "" {
-			dialog.ShowError(fmt.Errorf("AI response input is empty"), window)
-			statusBar.SetText("AI response empty.")
+	diffView := widget.NewMultiLineEntry()
+	diffView.Wrapping = fyne.TextWrapOff
+	diffView.Disable()
+	diffView.TextStyle = fyne.TextStyle{Monospace: true}
+	diffCard := widget.NewCard("Diff", "", container.NewScroll(diffView))
+
+	updateApplyButton := func() {
+		count := 0
+		for _, ok := range accepted {
+			if ok {
+				count++
+			}
+		}
+		applyButton.SetText(fmt.Sprintf("Apply %d Selected Changes", count))
+		if count == 0 {
+			applyButton.Disable()
+		} else {
+			applyButton.Enable()
+		}
+	}
+
+	changeList := widget.NewList(
+		func() int {
+			if plan == nil {
+				return 0
+			}
+			return len(plan.Results)
+		},
+		func() fyne.CanvasObject {
+			detailLabel := widget.NewLabel("status: detail")
+			detailLabel.Wrapping = fyne.TextWrapWord
+			return container.NewVBox(widget.NewCheck("update path/to/file.go", nil), detailLabel)
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			if plan == nil || id < 0 || id >= len(plan.Results) {
+				return
+			}
+			result := plan.Results[id]
+			vBox := item.(*fyne.Container)
+
+			check := vBox.Objects[0].(*widget.Check)
+			// Set the fields directly, so that reusing the row does not call OnChanged.
+			check.Text = fmt.Sprintf("%s %s", result.Action, result.Path)
+			check.Checked = accepted[id]
+			if result.Status == changeset.StatusFailed {
+				check.Disable()
+			} else {
+				check.Enable()
+			}
+			check.Refresh()
+			check.OnChanged = func(checked bool) {
+				accepted[id] = checked
+				updateApplyButton()
+			}
+
+			detail := string(result.Status)
+			if result.Err != nil {
+				detail += ": " + result.Err.Error()
+			} else if result.Note != "" {
+				detail += ": " + result.Note
+			}
+			vBox.Objects[1].(*widget.Label).SetText(detail)
+		},
+	)
+	changeList.OnSelected = func(id widget.ListItemID) {
+		if plan == nil || id < 0 || id >= len(plan.Results) {
 			return
 		}
+		result := plan.Results[id]
+		diffCard.SetTitle(result.Path)
+		switch {
+		case result.Err != nil:
+			diffView.SetText("This modification would fail: " + result.Err.Error())
+		case result.Diff == "":
+			diffView.SetText("No changes to the file. " + result.Note)
+		default:
+			diffView.SetText(result.Diff)
+		}
+	}
+
+	clearPlan := func(message string) {
+		planResp, plan, accepted = nil, nil, nil
+		changeList.UnselectAll()
+		changeList.Refresh()
+		diffCard.SetTitle("Diff")
+		diffView.SetText("")
+		updateApplyButton()
+		planLabel.SetText(message)
+	}
 
-		var aiResp collector.AIResponse
-		err := json.Unmarshal([]byte(aiJsonInput), &aiResp)
+	previewButton := widget.NewButtonWithIcon("Preview Changes", theme.SearchIcon(), func() {
+		statusBar.SetText("Processing AI response...")
+		aiResp, err := changeset.Parse([]byte(aiResponseEntry.Text))
 		if err != nil {
-			dialog.ShowError(fmt.Errorf("invalid AI JSON response: %w\n\nCheck for syntax errors, unescaped newlines, or incorrect structure. The expected root is {\"modified_files\": [...]}.", err), window)
-			statusBar.SetText("Invalid AI JSON.")
+			dialog.ShowError(err, window)
+			statusBar.SetText("Invalid AI response.")
 			return
 		}
 
@@ -49,144 +133,138 @@ func MakeApplyChangesPage(collectorService *CollectorService, window fyne.Window
 			return
 		}
 
+		scope, err := changeset.NewScope(collectorService.GetConfig())
+		if err != nil {
+			dialog.ShowError(err, window)
+			statusBar.SetText("Invalid apply allowlist.")
+			return
+		}
+		report := changeset.DryRun(collectorService.GetConfig().Root, aiResp, scope)
+		history.Reload() // The root may have changed since the page was built
+		clearPlan("")
+		planResp, plan = aiResp, report
+		accepted = make([]bool, len(report.Results))
+		for i, r := range report.Results {
+			accepted[i] = r.Status == changeset.StatusReady
+		}
+		changeList.Refresh()
+		updateApplyButton()
+		summary := fmt.Sprintf("%d of %d modifications can be applied.", report.Ready(), len(report.Results))
+		if failed := report.Failed(); failed > 0 {
+			summary += fmt.Sprintf(" %d would fail and cannot be selected.", failed)
+		}
+		planLabel.SetText(summary + " Select a file to see its diff; untick the ones to skip.")
+		statusBar.SetText("Dry run complete. No file was changed.")
+	})
+
+	applyButton = widget.NewButtonWithIcon("Apply Selected Changes", theme.ConfirmIcon(), func() {
+		if plan == nil {
+			return
+		}
+		var selected []collector.AIFileModification
+		for i, ok := range accepted {
+			if ok {
+				selected = append(selected, planResp.ModifiedFiles[i])
+			}
+		}
+		if len(selected) == 0 {
+			return
+		}
+
 		// Confirmation dialog
-		confirmMessage := fmt.Sprintf("You are about to apply %d file modification(s) to your project based on the AI response. This action can overwrite or delete files.\n\nRoot directory: %s\n\nAre you sure you want to proceed? It is recommended to have a backup or use version control.", len(aiResp.ModifiedFiles), collectorService.GetConfig().Root)
+		projectRoot := collectorService.GetConfig().Root
+		confirmMessage := fmt.Sprintf("You are about to apply %d of %d file modification(s) to your project based on the AI response. This action can overwrite or delete files.\n\nRoot directory: %s\n\nAre you sure you want to proceed? It is recommended to have a backup or use version control.", len(selected), len(plan.Results), projectRoot)
 		dialog.ShowConfirm("Confirm File Modifications", confirmMessage, func(confirm bool) {
 			if !confirm {
 				statusBar.SetText("File modification cancelled.")
 				return
 			}
 
-			statusBar.SetText(fmt.Sprintf("Applying %d changes...", len(aiResp.ModifiedFiles)))
-			appliedCount := 0
-			errorCount := 0
-			var errorMessages []string
-
-			currentConfig := collectorService.GetConfig()
-			projectRoot := currentConfig.Root
-			rootBasename := filepath.Base(projectRoot) // e.g., "myproject"
-
-			for _, mod := range aiResp.ModifiedFiles {
-				// The 'mod.Path' from AI should be like "myproject/src/file.go"
-				// We need to get "src/file.go" (the OriginalPath)
-				var originalRelativePath string
-
-				// Normalize AI path to use OS-specific separators for prefix checking
-				aiPathForCheck := filepath.FromSlash(mod.Path)
-				expectedPrefix := rootBasename + string(os.PathSeparator)
-
-				if strings.HasPrefix(aiPathForCheck, expectedPrefix) {
-					originalRelativePath = strings.TrimPrefix(aiPathForCheck, expectedPrefix)
-				} else {
-					// If AI didn't include rootBasename, or used wrong separator not caught by FromSlash
-					// (e.g. AI gave "myproject\\src\\file.go" on Linux, FromSlash won't change it)
-					// Fallback: try trimming with a generic separator as well if first check fails
-					// This is a bit of a safety net. The prompt strongly encourages rootBasename/path format.
-					genericPrefixUnix := rootBasename + "/"
-					if strings.HasPrefix(mod.Path, genericPrefixUnix) {
-						originalRelativePath = strings.TrimPrefix(mod.Path, genericPrefixUnix)
-					} else {
-						// If AI didn't include rootBasename, assume mod.Path is already the relative path.
-						// This is a fallback and might be risky if paths are ambiguous.
-						fmt.Printf("Warning: AI path '%s' does not start with project root basename '%s%c'. Assuming it's a direct relative path.\n", mod.Path, rootBasename, os.PathSeparator)
-						originalRelativePath = mod.Path
-					}
-				}
+			statusBar.SetText(fmt.Sprintf("Applying %d changes...", len(selected)))
+			scope, err := changeset.NewScope(collectorService.GetConfig())
+			if err != nil {
+				dialog.ShowError(err, window)
+				statusBar.SetText("Invalid apply allowlist.")
+				return
+			}
+			report := changeset.Apply(projectRoot, &collector.AIResponse{ModifiedFiles: selected}, scope)
 
-				// Ensure originalRelativePath uses OS-specific separators for joining with projectRoot
-				originalRelativePath = filepath.FromSlash(originalRelativePath)
-				absPath := filepath.Join(projectRoot, originalRelativePath)
-
-				switch strings.ToLower(mod.Action) {
-				case "update":
-					// Ensure directory exists
-					dir := filepath.Dir(absPath)
-					if err := os.MkdirAll(dir, 0755); err != nil {
-						errMsg := fmt.Sprintf("Failed to create directory for %s: %v", mod.Path, err)
-						errorMessages = append(errorMessages, errMsg)
-						errorCount++
-						continue
-					}
-					err := os.WriteFile(absPath, []byte(mod.Content), 0644)
-					if err != nil {
-						errMsg := fmt.Sprintf("Failed to update %s: %v", mod.Path, err)
-						errorMessages = append(errorMessages, errMsg)
-						errorCount++
-					} else {
-						appliedCount++
-					}
-				case "create":
-					// Ensure directory exists
-					dir := filepath.Dir(absPath)
-					if err := os.MkdirAll(dir, 0755); err != nil {
-						errMsg := fmt.Sprintf("Failed to create directory for %s: %v", mod.Path, err)
-						errorMessages = append(errorMessages, errMsg)
-						errorCount++
-						continue
-					}
-					// Check if file already exists to prevent accidental overwrite with 'create'
-					if _, statErr := os.Stat(absPath); statErr == nil {
-						errMsg := fmt.Sprintf("File %s already exists. Use 'update' action to overwrite.", mod.Path)
-						errorMessages = append(errorMessages, errMsg)
-						errorCount++
-						continue
-					}
-					err := os.WriteFile(absPath, []byte(mod.Content), 0644)
-					if err != nil {
-						errMsg := fmt.Sprintf("Failed to create %s: %v", mod.Path, err)
-						errorMessages = append(errorMessages, errMsg)
-						errorCount++
-					} else {
-						appliedCount++
-					}
-				case "delete":
-					err := os.Remove(absPath)
-					if err != nil {
-						// Ignore "not found" errors for delete, as it might already be gone
-						if !os.IsNotExist(err) {
-							errMsg := fmt.Sprintf("Failed to delete %s: %v", mod.Path, err)
-							errorMessages = append(errorMessages, errMsg)
-							errorCount++
-						} else {
-							// Optionally log that file was already deleted or treat as success
-							fmt.Printf("File %s for deletion not found, already deleted or never existed.\n", mod.Path)
-							appliedCount++ // Count as "applied" if goal is deletion and it's not there
-						}
-					} else {
-						appliedCount++
-					}
-				default:
-					errMsg := fmt.Sprintf("Unknown action '%s' for file %s", mod.Action, mod.Path)
-					errorMessages = append(errorMessages, errMsg)
-					errorCount++
+			if report.Aborted {
+				summaryMessage := abortMessage(report)
+				dialog.ShowError(errors.New(summaryMessage), window)
+				statusBar.SetText(strings.SplitN(summaryMessage, "\n", 2)[0])
+				if report.RollbackErr != nil {
+					clearPlan("Some files could not be restored. Check them before previewing the response again.")
 				}
+				return // Otherwise the files are as they were, so the preview still holds
 			}
 
-			summaryMessage := fmt.Sprintf("Applied %d modifications successfully.", appliedCount)
-			if errorCount > 0 {
-				summaryMessage += fmt.Sprintf("\nEncountered %d errors:\n%s", errorCount, strings.Join(errorMessages, "\n"))
-				dialog.ShowError(fmt.Errorf(summaryMessage), window) // Show as error if any errors occurred
-			} else {
-				dialog.ShowInformation("Apply Complete", summaryMessage, window)
+			summaryMessage := fmt.Sprintf("Applied %d modifications successfully.", report.Applied())
+			if report.JournalID != "" {
+				summaryMessage += fmt.Sprintf(" Recorded as change set %s, which can be undone from the History below.", report.JournalID)
 			}
+			dialog.ShowInformation("Apply Complete", summaryMessage, window)
 			statusBar.SetText(summaryMessage)
+			history.Reload()
+			// The files changed, so the diffs no longer hold.
+			clearPlan("Changes applied. Press 'Preview Changes' to compare the response with the files again.")
 
 		}, window) // End of ShowConfirm
 	})
+	applyButton.Disable()
+
+	history = newHistoryPanel(collectorService, window, statusBar, func() {
+		clearPlan("A change set was undone. Press 'Preview Changes' to compare the response with the files again.")
+	})
+
+	aiResponseEntry.OnChanged = func(string) {
+		if plan != nil {
+			clearPlan("The response changed. Press 'Preview Changes' to see what it would change.")
+		}
+	}
 
 	helpText := widget.NewLabel(
 		"Paste the JSON response from the AI into the text area below.\n" +
 			"The JSON should follow the format specified in the AI System Prompt (usually an object with a 'modified_files' array).\n" +
 			"Each item in 'modified_files' should have 'path', 'content', and 'action' ('update', 'create', 'delete').\n" +
 			"Paths must match those provided to the AI (e.g., 'project_root_basename/src/file.go').\n" +
-			"**WARNING**: This operation will modify your local files. Ensure you have backups or use version control.",
+			"'Preview Changes' shows the diff of every file without changing anything; only the ticked modifications are applied.\n" +
+			"The modifications are applied together: if one fails, the others are rolled back and nothing changes.\n" +
+			"Every change set applied is recorded in the History below, from where it can be undone.\n" +
+			"**WARNING**: Applying will modify your local files. Ensure you have backups or use version control.",
 	)
 	helpText.Wrapping = fyne.TextWrapWord
 
-	return container.NewVScroll(container.NewVBox(
+	top := container.NewVBox(
 		helpText,
 		widget.NewSeparator(),
 		aiResponseEntry,
-		applyButton,
-	))
+		container.NewHBox(previewButton, applyButton),
+		planLabel,
+	)
+	split := container.NewHSplit(changeList, diffCard)
+	split.Offset = 0.35
+	return container.NewBorder(top, history.accordion, nil, nil, split)
+}
+
+// abortMessage describes a change set that was rolled back and why.
+func abortMessage(report *changeset.Report) string {
+	var errorMessages []string
+	for _, r := range report.Results {
+		if r.Err != nil {
+			errorMessages = append(errorMessages, fmt.Sprintf("%s %s: %v", r.Action, r.Path, r.Err))
+		}
+	}
+	if report.Err != nil {
+		errorMessages = append(errorMessages, report.Err.Error())
+	}
+	cause := fmt.Sprintf("%d of %d modifications failed", report.Failed(), len(report.Results))
+	if report.Failed() == 0 && report.Err != nil {
+		// Every modification was ready, but the change set could not be recorded.
+		cause = "the change set could not be recorded in the history"
+	}
+	if report.RollbackErr != nil {
+		return fmt.Sprintf("The rollback is incomplete after %s, check these files:\n%v\n\nErrors:\n%s", cause, report.RollbackErr, strings.Join(errorMessages, "\n"))
+	}
+	return fmt.Sprintf("Nothing changed: %s, so all modifications were rolled back.\n%s", cause, strings.Join(errorMessages, "\n"))
 }
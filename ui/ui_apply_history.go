@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"errors"
+	"fmt"
+	"projectson/changeset"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// historyPanel lists the change sets applied to the project, newest first,
+// each with a button to undo it.
+type historyPanel struct {
+	collectorService *CollectorService
+	window           fyne.Window
+	statusBar        *widget.Label
+	onUndo           func() // Called after a change set was reverted
+	item             *widget.AccordionItem
+	accordion        *widget.Accordion
+	rows             *fyne.Container
+}
+
+func newHistoryPanel(collectorService *CollectorService, window fyne.Window, statusBar *widget.Label, onUndo func()) *historyPanel {
+	p := &historyPanel{
+		collectorService: collectorService,
+		window:           window,
+		statusBar:        statusBar,
+		onUndo:           onUndo,
+		rows:             container.NewVBox(),
+	}
+	scroll := container.NewVScroll(p.rows)
+	scroll.SetMinSize(fyne.NewSize(0, 150))
+	reloadButton := widget.NewButtonWithIcon("Reload", theme.ViewRefreshIcon(), p.Reload)
+	p.item = widget.NewAccordionItem("History", container.NewBorder(container.NewHBox(layout.NewSpacer(), reloadButton), nil, nil, nil, scroll))
+	p.accordion = widget.NewAccordion(p.item)
+	p.Reload()
+	return p
+}
+
+// Reload reads the history of the current root again.
+func (p *historyPanel) Reload() {
+	p.rows.RemoveAll()
+	journals, err := changeset.History(p.collectorService.GetConfig().Root)
+	switch {
+	case err != nil:
+		p.rows.Add(widget.NewLabel("Could not read the history: " + err.Error()))
+	case len(journals) == 0:
+		p.rows.Add(widget.NewLabel("No change sets applied yet."))
+	}
+	for _, j := range journals {
+		text := fmt.Sprintf("%s  applied %s: %d created, %d updated, %d deleted", j.ID, j.Time.Format(time.DateTime),
+			j.Count(changeset.ChangeCreated), j.Count(changeset.ChangeUpdated), j.Count(changeset.ChangeDeleted))
+		undoButton := widget.NewButtonWithIcon("Undo", theme.ContentUndoIcon(), func() { p.undo(j) })
+		if j.Undone != nil {
+			text += fmt.Sprintf(" (undone %s)", j.Undone.Format(time.DateTime))
+			undoButton.Disable()
+		}
+		p.rows.Add(container.NewHBox(widget.NewLabel(text), layout.NewSpacer(), undoButton))
+	}
+	p.item.Title = fmt.Sprintf("History (%s)", plural(len(journals), "change set"))
+	p.accordion.Refresh()
+}
+
+func (p *historyPanel) undo(j *changeset.Journal) {
+	confirmMessage := fmt.Sprintf("Revert change set %s? Created files are deleted along with the directories made for them, and updated and deleted files get their original content back.\n\nNothing is changed if any of the files was edited since.", j.ID)
+	dialog.ShowConfirm("Undo Change Set", confirmMessage, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		_, report, err := changeset.Undo(p.collectorService.GetConfig().Root, j.ID)
+		if err == nil && report.Aborted {
+			err = errors.New(abortMessage(report))
+		}
+		if err != nil {
+			dialog.ShowError(err, p.window)
+			p.statusBar.SetText(fmt.Sprintf("Undo of change set %s failed.", j.ID))
+		} else {
+			dialog.ShowInformation("Undo Complete", fmt.Sprintf("Reverted change set %s: %d files restored.", j.ID, report.Applied()), p.window)
+			p.statusBar.SetText(fmt.Sprintf("Change set %s undone.", j.ID))
+		}
+		p.Reload()
+		if report != nil && !report.Aborted {
+			p.onUndo()
+		}
+	}, p.window)
+}
@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"projectson/collector"
 	"projectson/config"
@@ -15,9 +17,21 @@ import (
 type RunStats struct {
 	FileCount    int
 	OutputSize   string
+	Tokenizer    string
+	TotalTokens  int
+	FileTokens   []collector.FileTokens
+	Degraded     []collector.Degradation
+	Parts        []string // Part files of chunked output
+	IndexFile    string
+	CacheHits    int // Set when the config enables the cache
+	CacheMisses  int
+	Skipped      int // Files left out because they could not be processed
+	Placeholders int // Files written as placeholders because they could not be processed
 	ProcessTime  time.Duration
 	Timestamp    time.Time
 	ErrorMessage string
+	Cancelled    bool // Stopped by CancelRun; the previous output was left unchanged
+	Diagnostics  []collector.Diagnostic
 	ConfigUsed   *config.Config
 }
 
@@ -27,12 +41,20 @@ type CollectorService struct {
 	fileCollector         *collector.FileCollector
 	needsCollectorRebuild bool
 
-	PreviewedFiles []collector.FileEntry
-	PreviewError   error
+	PreviewedFiles     []collector.FileEntry
+	PreviewDiagnostics []collector.Diagnostic
+	PreviewError       error
 
 	LastRunStats RunStats
 	mu           sync.Mutex
 
+	previewTask *backgroundTask // Preview in progress; nil when idle
+	runTask     *backgroundTask // Run in progress; nil when idle
+
+	watchCancel context.CancelFunc // Stops the running watch; nil when not watching
+	watchDone   chan struct{}
+	watchOnRun  func(stats RunStats)
+
 	app          fyne.App // Храним экземпляр приложения
 	parentWindow fyne.Window
 }
@@ -112,6 +134,7 @@ func (cs *CollectorService) rebuildCollectorIfNeeded() error {
 }
 
 func (cs *CollectorService) UpdateConfig(newConfig *config.Config) {
+	onRun, watching := cs.stopWatch()
 	cs.mu.Lock()
 	cs.config = newConfig
 	cs.needsCollectorRebuild = true
@@ -119,6 +142,12 @@ func (cs *CollectorService) UpdateConfig(newConfig *config.Config) {
 
 	cs.ClearPreview()
 	cs.ClearStats()
+	if watching {
+		// Keep regenerating with the new settings.
+		if err := cs.StartWatch(onRun); err != nil {
+			fmt.Printf("Warning: auto-regenerate stopped: %v\n", err)
+		}
+	}
 }
 
 func (cs *CollectorService) GetConfig() *config.Config {
@@ -143,16 +172,21 @@ func (cs *CollectorService) GetCurrentFileCollector() (*collector.FileCollector,
 	return cs.fileCollector, nil
 }
 
+// PerformPreview lists the files to collect in the background. onComplete
+// gets context.Canceled when CancelPreview stopped it.
 func (cs *CollectorService) PerformPreview(onComplete func(files []collector.FileEntry, err error)) {
+	ctx, task := cs.startTask(&cs.previewTask)
 	go func() {
+		defer cs.finishTask(&cs.previewTask, task)
 		currentCollector, err := cs.GetCurrentFileCollector()
 		if err != nil {
 			cs.runTaskOnUITread(func() { onComplete(nil, err) })
 			return
 		}
 
-		files, previewErr := currentCollector.PreviewFiles()
+		files, diags, previewErr := currentCollector.PreviewFiles(ctx)
 		cs.mu.Lock()
+		cs.PreviewDiagnostics = diags
 		if previewErr != nil {
 			cs.PreviewError = previewErr
 			cs.PreviewedFiles = nil
@@ -165,16 +199,70 @@ func (cs *CollectorService) PerformPreview(onComplete func(files []collector.Fil
 	}()
 }
 
+// backgroundTask is a preview or run in progress.
+type backgroundTask struct {
+	cancel context.CancelFunc
+}
+
+// startTask records a new task in *slot and returns its context.
+func (cs *CollectorService) startTask(slot **backgroundTask) (context.Context, *backgroundTask) {
+	ctx, cancel := context.WithCancel(context.Background())
+	task := &backgroundTask{cancel: cancel}
+	cs.mu.Lock()
+	*slot = task
+	cs.mu.Unlock()
+	return ctx, task
+}
+
+// finishTask releases the context of a finished task and clears *slot
+// unless a newer task has replaced it.
+func (cs *CollectorService) finishTask(slot **backgroundTask, task *backgroundTask) {
+	task.cancel()
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if *slot == task {
+		*slot = nil
+	}
+}
+
+// cancelTask stops the task in *slot, if any.
+func (cs *CollectorService) cancelTask(slot **backgroundTask) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if *slot != nil {
+		(*slot).cancel()
+	}
+}
+
+// CancelPreview stops the preview in progress, if any.
+func (cs *CollectorService) CancelPreview() {
+	cs.cancelTask(&cs.previewTask)
+}
+
+// CancelRun stops the run in progress, if any. The run ends with
+// RunStats.Cancelled set and the previous output unchanged.
+func (cs *CollectorService) CancelRun() {
+	cs.cancelTask(&cs.runTask)
+}
+
 func (cs *CollectorService) GetPreviewedFiles() ([]collector.FileEntry, error) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 	return cs.PreviewedFiles, cs.PreviewError
 }
 
+// GetPreviewDiagnostics returns the problems found by the last preview.
+func (cs *CollectorService) GetPreviewDiagnostics() []collector.Diagnostic {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.PreviewDiagnostics
+}
+
 func (cs *CollectorService) ClearPreview() {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
 	cs.PreviewedFiles = nil
+	cs.PreviewDiagnostics = nil
 	cs.PreviewError = nil
 }
 
@@ -182,7 +270,9 @@ func (cs *CollectorService) PerformRun(
 	progressCallback func(current, total int),
 	onComplete func(stats RunStats),
 ) {
+	ctx, task := cs.startTask(&cs.runTask)
 	go func() {
+		defer cs.finishTask(&cs.runTask, task)
 		currentCollector, err := cs.GetCurrentFileCollector()
 		runConfig := cs.GetConfig()
 
@@ -213,25 +303,10 @@ func (cs *CollectorService) PerformRun(
 			})
 		}
 
-		count, size, runErr := currentCollector.Run(uiProgressCallbackWrapper)
+		result, runErr := currentCollector.Run(ctx, uiProgressCallbackWrapper)
 		endTime := time.Now()
 
-		var runStats RunStats
-		if runErr != nil {
-			runStats = RunStats{
-				ErrorMessage: fmt.Sprintf("Run failed: %v", runErr),
-				Timestamp:    endTime,
-				ConfigUsed:   runConfig,
-			}
-		} else {
-			runStats = RunStats{
-				FileCount:   count,
-				OutputSize:  size,
-				ProcessTime: endTime.Sub(startTime),
-				Timestamp:   endTime,
-				ConfigUsed:  runConfig,
-			}
-		}
+		runStats := newRunStats(result, runErr, runConfig, startTime, endTime)
 		cs.mu.Lock()
 		cs.LastRunStats = runStats
 		cs.mu.Unlock()
@@ -240,6 +315,119 @@ func (cs *CollectorService) PerformRun(
 	}()
 }
 
+// newRunStats builds the statistics of a run that started at start and
+// ended at end.
+func newRunStats(result *collector.RunResult, runErr error, runConfig *config.Config, start, end time.Time) RunStats {
+	var runStats RunStats
+	if errors.Is(runErr, context.Canceled) {
+		runStats = RunStats{
+			ErrorMessage: "Run cancelled, output left unchanged",
+			Cancelled:    true,
+			Timestamp:    end,
+			ConfigUsed:   runConfig,
+		}
+	} else if runErr != nil {
+		runStats = RunStats{
+			ErrorMessage: fmt.Sprintf("Run failed: %v", runErr),
+			Timestamp:    end,
+			ConfigUsed:   runConfig,
+		}
+	} else {
+		runStats = RunStats{
+			FileCount:    result.FileCount,
+			OutputSize:   result.OutputSize,
+			Tokenizer:    result.Tokenizer,
+			TotalTokens:  result.TotalTokens,
+			FileTokens:   result.FileTokens,
+			Degraded:     result.Degraded,
+			Parts:        result.Parts,
+			IndexFile:    result.IndexFile,
+			CacheHits:    result.CacheHits,
+			CacheMisses:  result.CacheMisses,
+			Skipped:      result.Skipped,
+			Placeholders: result.Placeholders,
+			ProcessTime:  end.Sub(start),
+			Timestamp:    end,
+			ConfigUsed:   runConfig,
+		}
+	}
+	runStats.Diagnostics = result.Diagnostics
+	return runStats
+}
+
+// StartWatch regenerates the output now and whenever a collected file
+// changes, until StopWatch is called. onRun is called on the UI thread after
+// every run; a config change restarts the watch with the new settings.
+func (cs *CollectorService) StartWatch(onRun func(stats RunStats)) error {
+	currentCollector, err := cs.GetCurrentFileCollector()
+	if err != nil {
+		return err
+	}
+	runConfig := cs.GetConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	cs.mu.Lock()
+	if cs.watchCancel != nil {
+		cs.mu.Unlock()
+		cancel()
+		return fmt.Errorf("auto-regenerate is already running")
+	}
+	cs.watchCancel, cs.watchDone, cs.watchOnRun = cancel, done, onRun
+	cs.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		var watchDiags []collector.Diagnostic // Watcher problems since the last run
+		err := currentCollector.Watch(ctx, collector.DefaultDebounce, func() {
+			startTime := time.Now()
+			result, runErr := currentCollector.Run(ctx, nil)
+			if ctx.Err() != nil {
+				return // Stopped during the run; the last stats stay
+			}
+			runStats := newRunStats(result, runErr, runConfig, startTime, time.Now())
+			runStats.Diagnostics = append(watchDiags, runStats.Diagnostics...)
+			watchDiags = nil
+			cs.mu.Lock()
+			cs.LastRunStats = runStats
+			cs.mu.Unlock()
+			// Not waited for: StopWatch blocks the UI thread until this goroutine ends.
+			go cs.runTaskOnUITread(func() { onRun(runStats) })
+		}, func(d collector.Diagnostic) {
+			watchDiags = append(watchDiags, d)
+		})
+		if err != nil {
+			fmt.Printf("Warning: auto-regenerate stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// StopWatch stops the watch started by StartWatch and waits for a run in
+// progress to finish.
+func (cs *CollectorService) StopWatch() {
+	cs.stopWatch()
+}
+
+func (cs *CollectorService) stopWatch() (onRun func(stats RunStats), wasWatching bool) {
+	cs.mu.Lock()
+	cancel, done, onRun := cs.watchCancel, cs.watchDone, cs.watchOnRun
+	cs.watchCancel, cs.watchDone, cs.watchOnRun = nil, nil, nil
+	cs.mu.Unlock()
+	if cancel == nil {
+		return nil, false
+	}
+	cancel()
+	<-done
+	return onRun, true
+}
+
+// IsWatching reports whether auto-regenerate is on.
+func (cs *CollectorService) IsWatching() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.watchCancel != nil
+}
+
 func (cs *CollectorService) GetLastRunStats() RunStats {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -262,7 +450,7 @@ func (cs *CollectorService) GetFileContentWithExclusions(originalRelPath string,
 	if err != nil {
 		return "", "", err
 	}
-	modified, err = currentCollector.ApplyContentExclusions(original, fileExt)
+	modified, err = currentCollector.ProcessContent(original, fileExt)
 	if err != nil {
 		return original, "", fmt.Errorf("error applying exclusions: %w", err)
 	}
@@ -2,6 +2,11 @@ package ui
 
 import (
 	"fmt"
+	"projectson/collector"
+	"projectson/config"
+	"projectson/tokenizer"
+	"sort"
+	"strconv"
 	"strings"
 
 	"fyne.io/fyne/v2"
@@ -11,6 +16,9 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
+// autoOutputFormat is shown when the output format is inferred from the output extension.
+const autoOutputFormat = "auto"
+
 // MakeConfigPage creates the UI for the configuration settings.
 func MakeConfigPage(collectorService *CollectorService, onConfigModified func()) fyne.CanvasObject {
 	cfg := collectorService.GetConfig()
@@ -18,9 +26,21 @@ func MakeConfigPage(collectorService *CollectorService, onConfigModified func())
 
 	rootHelp := "Specify the root directory of your project."
 	formatsHelp := "List file extensions to include (one per line, e.g., 'vue', 'ts')."
-	outputHelp := "Specify the full path for the output JSON file."
-	includesHelp := "Paths to include, relative to Project Root. Syntax: path[:mode] or path/*[:mode]. Modes: path, content, both (default). '/*' means non-recursive."
-	excludesHelp := "Patterns to exclude files/directories (one per line). Glob (e.g., node_modules, *.log) or /regex/."
+	outputHelp := "Specify the full path for the output file."
+	outputTemplateHelp := "Optional Go text/template file that renders the output instead of Output Format. It gets .Files (Path, OriginalPath, Format, Mode, Size, Content, HasContent, HasPath, Error), .Run (Root, FileCount, TotalTokens, TotalSize, Tokenizer), .Tree and .Meta, plus the functions lang, indent, tokens and tree. See the configuration docs for an example."
+	fileFieldsHelp := "Extra fields written with every file: language (code block language), size_bytes, lines and sha256 of the source file, tokens of the entry, mtime (modification time, UTC) and bytes_removed by content exclusions. JSON and JSONL get them as keys next to path, XML as attributes of <file>; markdown and text show path and content only."
+	outputFormatHelp := "Format of the output file: 'json' ({\"project_files\": [...]}), 'jsonl' (one JSON object per line), 'markdown' (a heading and fenced code block per file), 'xml' (<file path=\"...\"> tags) or 'text' (==> path <== headers). 'auto' infers it from the output extension (.jsonl, .md, .xml, .txt), defaulting to json."
+	includesHelp := "Paths to include, relative to Project Root. Syntax: path[:mode][:priority] or path/*[:mode][:priority]. Modes: path, content, both (default). Priority (default 0) decides which files budget_action 'prune' degrades first: lower goes first. '/*' means non-recursive. Globs with '**' and braces are supported (e.g. src/**/*.{ts,tsx}); '!glob' removes files matched by earlier entries. Output Order 'path' (default) sorts files by path; 'include' keeps the order of these entries, sorting by path within each."
+	excludesHelp := "Patterns to exclude files/directories (one per line), evaluated in order. Glob (e.g., node_modules, *.log, **/testdata/**, *.{png,jpg}) or /regex/. Prefix with '!' to re-include paths excluded by an earlier pattern."
+	whitespaceHelp := "How whitespace in file content is written. 'collapse' (default) turns every whitespace run into one space, 'preserve' keeps content as is, 'trim_trailing' strips trailing spaces and extra blank lines but keeps indentation (Python, YAML, Makefiles), 'tabs_to_spaces' also expands tabs to Tab Width columns. Per Format overrides the default, one 'format: policy' per line."
+	tokensHelp := "Tokenizer used to count tokens: 'chars' (characters / ratio, the default) or 'bpe-approx' (BPE with a small built-in vocabulary, a rough approximation only). Max Tokens and Max Output Bytes set budgets for the whole output (0 = none). When exceeded the run trims files in output order (default), prunes (lowest-priority files are cut to head/tail excerpts of Excerpt Tokens, then reduced to their path, then removed), or fails."
+	treeHelp := "Adds a project tree section to the output, built from the previewed files. Max Depth limits the levels shown below the root and Collapse Over folds directories with more entries into a '(N entries)' line (0 = no limit). Show non-collected files also lists files that exist but are not collected, marked '[not collected]', so the model knows they are there; exclude patterns and gitignore rules still apply."
+	metaHelp := "Adds a meta object after the files: generation time, projectson version, config file path and SHA-256 of the effective config, root name, file count, source byte and token totals, and when the root is in a git work tree the HEAD commit, branch and whether tracked files have uncommitted changes. The timestamp makes every run's output different."
+	chunkingHelp := "Splits the output into part files next to Output Path (output.part-001.json, output.part-002.json, ...) that each stay within Max Tokens and Max Bytes per part, plus an index file (output.index.json) listing the paths in every part. Files of the same directory are kept in one part when they fit; a file is only split when it exceeds a limit on its own. The tree goes into the first part."
+	cacheHelp := "Keeps processed files in a cache directory (default .projectson-cache in the project root) and reuses them on later runs. A file is processed again when its size, modification time or content changes, or when its mode, a content exclusion rule that applies to it or its whitespace settings change. Hits and misses are shown on the Stats page. Add the directory to .gitignore."
+	onErrorHelp := "What a run does with a file it cannot read or process: 'skip' (default) leaves it out of the output, 'fail' stops the run and leaves the previous output unchanged, 'placeholder' writes an entry with the path and an 'error' field instead of the content, so the model knows the file exists. Skipped files and placeholders are counted on the Stats page."
+	applyAllowHelp := "Limits the files an AI response applied in the Apply tab may touch. Paths are always checked: absolute paths, paths leaving the project root (also through symbolic links) and writes into .git are rejected. With the allowlist on, a response may only touch files written to the output by the last run, which runs record in .projectson/collected.json, and files matching the Allowed Patterns (globs relative to the root, one per line, e.g. src/**/*.go). Setting a pattern turns the allowlist on."
+	gitignoreHelp := "Skip files ignored by git: the root .gitignore, nested .gitignore files, .git/info/exclude and an optional global ignore file (e.g. ~/.config/git/ignore)."
 
 	applyChangesAndNotify := func() {
 		// Basic validation before updating service
@@ -90,6 +110,27 @@ func MakeConfigPage(collectorService *CollectorService, onConfigModified func())
 	})
 	outputContainer := container.NewBorder(nil, nil, nil, browseOutputButton, outputEntry)
 
+	outputTemplateEntry := widget.NewEntry()
+	outputTemplateEntry.SetPlaceHolder("optional, e.g. prompt.tmpl")
+	outputTemplateEntry.SetText(cfg.OutputTemplate)
+	outputTemplateEntry.OnChanged = func(s string) {
+		cfg.OutputTemplate = strings.TrimSpace(s)
+		applyChangesAndNotify()
+	}
+	browseTemplateButton := widget.NewButtonWithIcon("Browse", theme.FileIcon(), func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil {
+				dialog.ShowError(err, parentWin)
+				return
+			}
+			if reader != nil {
+				outputTemplateEntry.SetText(reader.URI().Path()) // Triggers OnChanged
+				_ = reader.Close()
+			}
+		}, parentWin)
+	})
+	outputTemplateContainer := container.NewBorder(nil, nil, nil, browseTemplateButton, outputTemplateEntry)
+
 	includesListContainer := container.NewVBox()
 	var rebuildIncludesUI func()
 	rebuildIncludesUI = func() {
@@ -99,37 +140,31 @@ func MakeConfigPage(collectorService *CollectorService, onConfigModified func())
 		}
 		for i, incFullString := range cfg.Include {
 			localIdx := i
-			pathForEntry := incFullString
-			modeForSelect := "both"
-			colonIndex := strings.LastIndex(incFullString, ":")
-			if colonIndex != -1 {
-				pathSegment := strings.TrimSpace(incFullString[:colonIndex])
-				modeSegment := strings.ToLower(strings.TrimSpace(incFullString[colonIndex+1:]))
-				if modeSegment == "path" || modeSegment == "content" {
-					pathForEntry = pathSegment
-					modeForSelect = modeSegment
-				} else if modeSegment == "both" {
-					pathForEntry = pathSegment
-				}
-			}
+			parsed := config.ParseIncludeEntry(incFullString)
+			pathOnly := parsed
+			pathOnly.Mode, pathOnly.Priority = "", 0
 
 			pathEntryItem := widget.NewEntry()
-			pathEntryItem.SetText(pathForEntry)
-			pathEntryItem.SetPlaceHolder("path/to/include/*:mode")
+			pathEntryItem.SetText(pathOnly.String())
+			pathEntryItem.SetPlaceHolder("path/to/include/*")
 
-			modeSelectItem := widget.NewSelect([]string{"both", "path", "content"}, nil)
-			modeSelectItem.SetSelected(modeForSelect)
+			modeSelectItem := widget.NewSelect([]string{"both", "path", "content", "outline"}, nil)
+			modeSelectItem.SetSelected(parsed.Mode)
+
+			priorityEntryItem := widget.NewEntry()
+			priorityEntryItem.SetPlaceHolder("priority (0)")
+			if parsed.Priority != 0 {
+				priorityEntryItem.SetText(strconv.Itoa(parsed.Priority))
+			}
 
 			updateIncludeEntry := func() {
 				currentPathInput := strings.TrimSpace(pathEntryItem.Text)
-				currentModeSelected := modeSelectItem.Selected
 				finalEntryString := ""
-				if currentPathInput == "" {
-					finalEntryString = ""
-				} else if currentModeSelected != "both" {
-					finalEntryString = currentPathInput + ":" + currentModeSelected
-				} else {
-					finalEntryString = currentPathInput
+				if currentPathInput != "" {
+					entry := config.ParseIncludeEntry(currentPathInput)
+					entry.Mode = modeSelectItem.Selected
+					entry.Priority, _ = strconv.Atoi(strings.TrimSpace(priorityEntryItem.Text))
+					finalEntryString = entry.String()
 				}
 				if localIdx < len(cfg.Include) {
 					cfg.Include[localIdx] = finalEntryString
@@ -138,6 +173,7 @@ func MakeConfigPage(collectorService *CollectorService, onConfigModified func())
 			}
 			pathEntryItem.OnChanged = func(s string) { updateIncludeEntry() }
 			modeSelectItem.OnChanged = func(s string) { updateIncludeEntry() }
+			priorityEntryItem.OnChanged = func(s string) { updateIncludeEntry() }
 
 			removeButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
 				if localIdx < len(cfg.Include) {
@@ -146,7 +182,7 @@ func MakeConfigPage(collectorService *CollectorService, onConfigModified func())
 					applyChangesAndNotify()
 				}
 			})
-			entryRow := container.NewBorder(nil, nil, removeButton, nil, container.NewGridWithColumns(2, pathEntryItem, modeSelectItem))
+			entryRow := container.NewBorder(nil, nil, removeButton, nil, container.NewGridWithColumns(3, pathEntryItem, modeSelectItem, priorityEntryItem))
 			includesListContainer.Add(entryRow)
 		}
 		includesListContainer.Refresh()
@@ -169,24 +205,481 @@ func MakeConfigPage(collectorService *CollectorService, onConfigModified func())
 	excludePatternsEntry.Wrapping = fyne.TextWrapOff
 	excludePatternsEntry.SetMinRowsVisible(3)
 
+	globalGitignoreEntry := widget.NewEntry()
+	globalGitignoreEntry.SetPlaceHolder("~/.config/git/ignore (optional)")
+	globalGitignoreEntry.SetText(cfg.GlobalGitignore)
+	globalGitignoreEntry.OnChanged = func(s string) {
+		cfg.GlobalGitignore = strings.TrimSpace(s)
+		applyChangesAndNotify()
+	}
+	if !cfg.RespectGitignore {
+		globalGitignoreEntry.Disable()
+	}
+
+	respectGitignoreCheck := widget.NewCheck("Respect .gitignore files", func(checked bool) {
+		cfg.RespectGitignore = checked
+		if checked {
+			globalGitignoreEntry.Enable()
+		} else {
+			globalGitignoreEntry.Disable()
+		}
+		applyChangesAndNotify()
+	})
+	respectGitignoreCheck.Checked = cfg.RespectGitignore
+
+	charsPerTokenEntry := widget.NewEntry()
+	charsPerTokenEntry.SetPlaceHolder(fmt.Sprintf("%.0f", tokenizer.DefaultCharsPerToken))
+	if cfg.CharsPerToken > 0 {
+		charsPerTokenEntry.SetText(strconv.FormatFloat(cfg.CharsPerToken, 'f', -1, 64))
+	}
+	charsPerTokenEntry.OnChanged = func(s string) {
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+		if err != nil {
+			ratio = 0
+		}
+		cfg.CharsPerToken = ratio
+		applyChangesAndNotify()
+	}
+
+	tokenizerSelect := widget.NewSelect(tokenizer.Names(), func(selected string) {
+		cfg.Tokenizer = selected
+		if selected == "chars" {
+			charsPerTokenEntry.Enable()
+		} else {
+			charsPerTokenEntry.Disable()
+		}
+		applyChangesAndNotify()
+	})
+	if cfg.Tokenizer == "" {
+		tokenizerSelect.Selected = tokenizer.DefaultName
+	} else {
+		tokenizerSelect.Selected = cfg.Tokenizer
+	}
+	if tokenizerSelect.Selected != "chars" {
+		charsPerTokenEntry.Disable()
+	}
+
+	maxTokensEntry := widget.NewEntry()
+	maxTokensEntry.SetPlaceHolder("0 (no limit)")
+	if cfg.MaxTokens > 0 {
+		maxTokensEntry.SetText(strconv.Itoa(cfg.MaxTokens))
+	}
+	maxTokensEntry.OnChanged = func(s string) {
+		limit, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			limit = 0
+		}
+		cfg.MaxTokens = limit
+		applyChangesAndNotify()
+	}
+
+	maxOutputBytesEntry := widget.NewEntry()
+	maxOutputBytesEntry.SetPlaceHolder("0 (no limit)")
+	if cfg.MaxOutputBytes > 0 {
+		maxOutputBytesEntry.SetText(strconv.FormatInt(cfg.MaxOutputBytes, 10))
+	}
+	maxOutputBytesEntry.OnChanged = func(s string) {
+		limit, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			limit = 0
+		}
+		cfg.MaxOutputBytes = limit
+		applyChangesAndNotify()
+	}
+
+	excerptTokensEntry := widget.NewEntry()
+	excerptTokensEntry.SetPlaceHolder(strconv.Itoa(collector.DefaultExcerptTokens))
+	if cfg.ExcerptTokens > 0 {
+		excerptTokensEntry.SetText(strconv.Itoa(cfg.ExcerptTokens))
+	}
+	excerptTokensEntry.OnChanged = func(s string) {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			n = 0
+		}
+		cfg.ExcerptTokens = n
+		applyChangesAndNotify()
+	}
+
+	budgetActionSelect := widget.NewSelect(config.BudgetActions, func(selected string) {
+		cfg.BudgetAction = selected
+		if selected == "prune" {
+			excerptTokensEntry.Enable()
+		} else {
+			excerptTokensEntry.Disable()
+		}
+		applyChangesAndNotify()
+	})
+	if cfg.BudgetAction == "" {
+		budgetActionSelect.Selected = config.BudgetActions[0]
+	} else {
+		budgetActionSelect.Selected = cfg.BudgetAction
+	}
+	if budgetActionSelect.Selected != "prune" {
+		excerptTokensEntry.Disable()
+	}
+
+	whitespaceSelect := widget.NewSelect(config.WhitespacePolicies, func(selected string) {
+		cfg.Whitespace = selected
+		applyChangesAndNotify()
+	})
+	if cfg.Whitespace == "" {
+		whitespaceSelect.Selected = config.WhitespacePolicies[0]
+	} else {
+		whitespaceSelect.Selected = cfg.Whitespace
+	}
+
+	formatWhitespaceEntry := widget.NewMultiLineEntry()
+	formatWhitespaceEntry.SetPlaceHolder("e.g.\npy: trim_trailing\nyaml: preserve")
+	formatWhitespaceEntry.SetText(formatFormatWhitespace(cfg.FormatWhitespace))
+	formatWhitespaceEntry.OnChanged = func(s string) {
+		cfg.FormatWhitespace = parseFormatWhitespace(s)
+		applyChangesAndNotify()
+	}
+	formatWhitespaceEntry.Wrapping = fyne.TextWrapOff
+
+	tabWidthEntry := widget.NewEntry()
+	tabWidthEntry.SetPlaceHolder(strconv.Itoa(collector.DefaultTabWidth))
+	if cfg.TabWidth > 0 {
+		tabWidthEntry.SetText(strconv.Itoa(cfg.TabWidth))
+	}
+	tabWidthEntry.OnChanged = func(s string) {
+		width, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			width = 0
+		}
+		cfg.TabWidth = width
+		applyChangesAndNotify()
+	}
+
+	orderSelect := widget.NewSelect(config.OutputOrders, func(selected string) {
+		cfg.Order = selected
+		applyChangesAndNotify()
+	})
+	if cfg.Order == "" {
+		orderSelect.Selected = config.OutputOrders[0]
+	} else {
+		orderSelect.Selected = cfg.Order
+	}
+
+	outputFormatSelect := widget.NewSelect(append([]string{autoOutputFormat}, config.OutputFormats...), func(selected string) {
+		if selected == autoOutputFormat {
+			selected = ""
+		}
+		cfg.OutputFormat = selected
+		applyChangesAndNotify()
+	})
+	if cfg.OutputFormat == "" {
+		outputFormatSelect.Selected = autoOutputFormat
+	} else {
+		outputFormatSelect.Selected = cfg.OutputFormat
+	}
+
+	treeMaxDepthEntry := widget.NewEntry()
+	treeMaxDepthEntry.SetPlaceHolder("0 (all levels)")
+	if cfg.Tree.MaxDepth > 0 {
+		treeMaxDepthEntry.SetText(strconv.Itoa(cfg.Tree.MaxDepth))
+	}
+	treeMaxDepthEntry.OnChanged = func(s string) {
+		depth, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			depth = 0
+		}
+		cfg.Tree.MaxDepth = depth
+		applyChangesAndNotify()
+	}
+
+	treeCollapseEntry := widget.NewEntry()
+	treeCollapseEntry.SetPlaceHolder("0 (never collapse)")
+	if cfg.Tree.CollapseOver > 0 {
+		treeCollapseEntry.SetText(strconv.Itoa(cfg.Tree.CollapseOver))
+	}
+	treeCollapseEntry.OnChanged = func(s string) {
+		limit, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			limit = 0
+		}
+		cfg.Tree.CollapseOver = limit
+		applyChangesAndNotify()
+	}
+
+	treeUncollectedCheck := widget.NewCheck("Show non-collected files", func(checked bool) {
+		cfg.Tree.ShowUncollected = checked
+		applyChangesAndNotify()
+	})
+	treeUncollectedCheck.Checked = cfg.Tree.ShowUncollected
+
+	setTreeFieldsEnabled := func(enabled bool) {
+		for _, w := range []fyne.Disableable{treeMaxDepthEntry, treeCollapseEntry, treeUncollectedCheck} {
+			if enabled {
+				w.Enable()
+			} else {
+				w.Disable()
+			}
+		}
+	}
+	treeEnabledCheck := widget.NewCheck("Include project tree", func(checked bool) {
+		cfg.Tree.Enabled = checked
+		setTreeFieldsEnabled(checked)
+		applyChangesAndNotify()
+	})
+	treeEnabledCheck.Checked = cfg.Tree.Enabled
+	setTreeFieldsEnabled(cfg.Tree.Enabled)
+
+	fileFieldsCheck := widget.NewCheckGroup(config.FileFields, func(selected []string) {
+		// Keep the documented order regardless of the click order.
+		fields := []string{}
+		for _, field := range config.FileFields {
+			for _, s := range selected {
+				if s == field {
+					fields = append(fields, field)
+				}
+			}
+		}
+		cfg.FileFields = fields
+		applyChangesAndNotify()
+	})
+	fileFieldsCheck.Horizontal = true
+	fileFieldsCheck.Selected = append([]string{}, cfg.FileFields...)
+
+	metaCheck := widget.NewCheck("Include meta object", func(checked bool) {
+		cfg.Meta = checked
+		applyChangesAndNotify()
+	})
+	metaCheck.Checked = cfg.Meta
+
+	chunkMaxTokensEntry := widget.NewEntry()
+	chunkMaxTokensEntry.SetPlaceHolder("0 (no limit)")
+	if cfg.Chunking.MaxTokens > 0 {
+		chunkMaxTokensEntry.SetText(strconv.Itoa(cfg.Chunking.MaxTokens))
+	}
+	chunkMaxTokensEntry.OnChanged = func(s string) {
+		limit, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			limit = 0
+		}
+		cfg.Chunking.MaxTokens = limit
+		applyChangesAndNotify()
+	}
+
+	chunkMaxBytesEntry := widget.NewEntry()
+	chunkMaxBytesEntry.SetPlaceHolder("0 (no limit)")
+	if cfg.Chunking.MaxBytes > 0 {
+		chunkMaxBytesEntry.SetText(strconv.FormatInt(cfg.Chunking.MaxBytes, 10))
+	}
+	chunkMaxBytesEntry.OnChanged = func(s string) {
+		limit, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			limit = 0
+		}
+		cfg.Chunking.MaxBytes = limit
+		applyChangesAndNotify()
+	}
+
+	setChunkFieldsEnabled := func(enabled bool) {
+		for _, w := range []fyne.Disableable{chunkMaxTokensEntry, chunkMaxBytesEntry} {
+			if enabled {
+				w.Enable()
+			} else {
+				w.Disable()
+			}
+		}
+	}
+	chunkingCheck := widget.NewCheck("Split output into parts", func(checked bool) {
+		cfg.Chunking.Enabled = checked
+		setChunkFieldsEnabled(checked)
+		applyChangesAndNotify()
+	})
+	chunkingCheck.Checked = cfg.Chunking.Enabled
+	setChunkFieldsEnabled(cfg.Chunking.Enabled)
+
+	cacheDirEntry := widget.NewEntry()
+	cacheDirEntry.SetPlaceHolder(collector.CacheDirName + " in the project root")
+	cacheDirEntry.SetText(cfg.CacheDir)
+	cacheDirEntry.OnChanged = func(s string) {
+		cfg.CacheDir = strings.TrimSpace(s)
+		applyChangesAndNotify()
+	}
+	cacheCheck := widget.NewCheck("Reuse processed files across runs", func(checked bool) {
+		cfg.Cache = checked
+		if checked {
+			cacheDirEntry.Enable()
+		} else {
+			cacheDirEntry.Disable()
+		}
+		applyChangesAndNotify()
+	})
+	cacheCheck.Checked = cfg.Cache
+	if !cfg.Cache {
+		cacheDirEntry.Disable()
+	}
+
+	onErrorSelect := widget.NewSelect(config.OnErrorPolicies, func(selected string) {
+		cfg.OnError = selected
+		applyChangesAndNotify()
+	})
+	if cfg.OnError == "" {
+		onErrorSelect.Selected = config.OnErrorPolicies[0]
+	} else {
+		onErrorSelect.Selected = cfg.OnError
+	}
+
+	applyAllowEntry := widget.NewMultiLineEntry()
+	applyAllowEntry.SetPlaceHolder("e.g.\nsrc/**\ndocs/*.md")
+	applyAllowEntry.SetText(strings.Join(cfg.ApplyAllow, "\n"))
+	applyAllowEntry.OnChanged = func(s string) {
+		cfg.ApplyAllow = CleanSplit(s)
+		applyChangesAndNotify()
+	}
+	applyAllowEntry.Wrapping = fyne.TextWrapOff
+	applyAllowEntry.SetMinRowsVisible(3)
+	applyAllowlistCheck := widget.NewCheck("Only allow files of the last run and the patterns below", func(checked bool) {
+		cfg.ApplyAllowlist = checked
+		applyChangesAndNotify()
+	})
+	applyAllowlistCheck.Checked = cfg.ApplyAllowlist
+
 	formItems := []*widget.FormItem{
 		newFormFieldWithHelp("Project Root Path", rootContainer, rootHelp, parentWin),
 		newFormFieldWithHelp("File Formats (one per line)", formatsEntry, formatsHelp, parentWin),
-		newFormFieldWithHelp("Output JSON Path", outputContainer, outputHelp, parentWin),
+		newFormFieldWithHelp("Output Path", outputContainer, outputHelp, parentWin),
+		newFormFieldWithHelp("Output Format", outputFormatSelect, outputFormatHelp, parentWin),
+		newFormFieldWithHelp("Output Template", outputTemplateContainer, outputTemplateHelp, parentWin),
+		newFormFieldWithHelp("File Fields", fileFieldsCheck, fileFieldsHelp, parentWin),
+		newFormFieldWithHelp("On Error", onErrorSelect, onErrorHelp, parentWin),
 	}
 	baseForm := widget.NewForm(formItems...)
 
 	includesSectionTitle := newLabelWithHelp("Include Paths & Modes", fyne.TextStyle{Bold: true}, includesHelp, parentWin)
-	includesSection := container.NewVBox(includesSectionTitle, includesListContainer, addIncludeButton)
+	includesSection := container.NewVBox(
+		includesSectionTitle,
+		includesListContainer,
+		addIncludeButton,
+		widget.NewForm(widget.NewFormItem("Output Order", orderSelect)),
+	)
 
 	excludesSectionTitle := newLabelWithHelp("Exclude Patterns (one per line, /regex/ or glob)", fyne.TextStyle{Bold: true}, excludesHelp, parentWin)
 	excludesSection := container.NewVBox(excludesSectionTitle, excludePatternsEntry)
 
+	tokensSectionTitle := newLabelWithHelp("Tokens", fyne.TextStyle{Bold: true}, tokensHelp, parentWin)
+	tokensSection := container.NewVBox(
+		tokensSectionTitle,
+		widget.NewForm(
+			widget.NewFormItem("Tokenizer", tokenizerSelect),
+			widget.NewFormItem("Chars per Token", charsPerTokenEntry),
+			widget.NewFormItem("Max Tokens", maxTokensEntry),
+			widget.NewFormItem("Max Output Bytes", maxOutputBytesEntry),
+			widget.NewFormItem("When Exceeded", budgetActionSelect),
+			widget.NewFormItem("Excerpt Tokens", excerptTokensEntry),
+		),
+	)
+
+	whitespaceSectionTitle := newLabelWithHelp("Whitespace", fyne.TextStyle{Bold: true}, whitespaceHelp, parentWin)
+	whitespaceSection := container.NewVBox(
+		whitespaceSectionTitle,
+		widget.NewForm(
+			widget.NewFormItem("Default Policy", whitespaceSelect),
+			widget.NewFormItem("Per Format", formatWhitespaceEntry),
+			widget.NewFormItem("Tab Width", tabWidthEntry),
+		),
+	)
+
+	treeSectionTitle := newLabelWithHelp("Project Tree", fyne.TextStyle{Bold: true}, treeHelp, parentWin)
+	treeSection := container.NewVBox(
+		treeSectionTitle,
+		treeEnabledCheck,
+		widget.NewForm(
+			widget.NewFormItem("Max Depth", treeMaxDepthEntry),
+			widget.NewFormItem("Collapse Over", treeCollapseEntry),
+		),
+		treeUncollectedCheck,
+	)
+
+	metaSectionTitle := newLabelWithHelp("Metadata", fyne.TextStyle{Bold: true}, metaHelp, parentWin)
+	metaSection := container.NewVBox(metaSectionTitle, metaCheck)
+
+	chunkingSectionTitle := newLabelWithHelp("Chunking", fyne.TextStyle{Bold: true}, chunkingHelp, parentWin)
+	chunkingSection := container.NewVBox(
+		chunkingSectionTitle,
+		chunkingCheck,
+		widget.NewForm(
+			widget.NewFormItem("Max Tokens per Part", chunkMaxTokensEntry),
+			widget.NewFormItem("Max Bytes per Part", chunkMaxBytesEntry),
+		),
+	)
+
+	cacheSectionTitle := newLabelWithHelp("Cache", fyne.TextStyle{Bold: true}, cacheHelp, parentWin)
+	cacheSection := container.NewVBox(
+		cacheSectionTitle,
+		cacheCheck,
+		widget.NewForm(widget.NewFormItem("Cache Directory", cacheDirEntry)),
+	)
+
+	gitignoreSectionTitle := newLabelWithHelp("Git Ignore Rules", fyne.TextStyle{Bold: true}, gitignoreHelp, parentWin)
+	gitignoreSection := container.NewVBox(
+		gitignoreSectionTitle,
+		respectGitignoreCheck,
+		widget.NewForm(widget.NewFormItem("Global Ignore File", globalGitignoreEntry)),
+	)
+
+	applySectionTitle := newLabelWithHelp("Applying AI Responses", fyne.TextStyle{Bold: true}, applyAllowHelp, parentWin)
+	applySection := container.NewVBox(
+		applySectionTitle,
+		applyAllowlistCheck,
+		widget.NewForm(widget.NewFormItem("Allowed Patterns", applyAllowEntry)),
+	)
+
 	return container.NewVScroll(container.NewVBox(
 		baseForm,
 		widget.NewSeparator(),
 		includesSection,
 		widget.NewSeparator(),
 		excludesSection,
+		widget.NewSeparator(),
+		gitignoreSection,
+		widget.NewSeparator(),
+		whitespaceSection,
+		widget.NewSeparator(),
+		treeSection,
+		widget.NewSeparator(),
+		metaSection,
+		widget.NewSeparator(),
+		tokensSection,
+		widget.NewSeparator(),
+		chunkingSection,
+		widget.NewSeparator(),
+		cacheSection,
+		widget.NewSeparator(),
+		applySection,
 	))
 }
+
+// formatFormatWhitespace renders per-format whitespace overrides as sorted "format: policy" lines.
+func formatFormatWhitespace(overrides map[string]string) string {
+	lines := make([]string, 0, len(overrides))
+	for format, policy := range overrides {
+		lines = append(lines, format+": "+policy)
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// parseFormatWhitespace parses "format: policy" lines, ignoring malformed ones.
+func parseFormatWhitespace(text string) map[string]string {
+	overrides := make(map[string]string)
+	for _, line := range CleanSplit(text) {
+		format, policy, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		format = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(format), "."))
+		policy = strings.TrimSpace(policy)
+		if format != "" && policy != "" {
+			overrides[format] = policy
+		}
+	}
+	if len(overrides) == 0 {
+		return nil
+	}
+	return overrides
+}
@@ -35,8 +35,12 @@ root: "/path/to/your/project"
     -   ` + "`\"path/to/item:path\"`" + `: Collects only the path string for the item(s).
     -   ` + "`\"path/to/item:content\"`" + `: Collects only the content for the item(s).
     -   ` + "`\"path/to/item:both\"`" + `: Explicitly collects both path and content.
+    -   ` + "`\"path/to/item:outline\"`" + `: Collects the path and, for ` + "`.go`" + ` files, only the package clause, imports, declarations, signatures and doc comments. Function bodies become ` + "`{ ... }`" + `; other files are collected as with ` + "`both`" + `.
     -   ` + "`\"path/to/directory/*\"`" + `: Collects files *directly within* ` + "`path/to/directory`" + ` (non-recursively). Default mode is ` + "`both`" + `.
     -   ` + "`\"path/to/directory/*:mode\"`" + `: Collects files *directly within* ` + "`path/to/directory`" + ` with the specified ` + "`mode`" + `.
+    -   ` + "`\"src/**/*.{ts,tsx}[:mode]\"`" + `: A glob matched against paths relative to ` + "`root`" + `. ` + "`**`" + ` matches any number of directories and ` + "`{a,b}`" + ` expands to alternatives.
+    -   ` + "`\"path/to/item[:mode]:priority\"`" + `: An integer priority (default ` + "`0`" + `) for ` + "`budget_action: \"prune\"`" + `. Lower-priority files are degraded first.
+    -   ` + "`\"!pattern\"`" + `: Removes files collected by *earlier* entries that match the glob (or lie below the given directory).
 -   **Examples**:
 ` + "```yaml" + `
 include:
@@ -44,6 +48,23 @@ include:
   - "README.md:content" # Include only content of README.md
   - "assets/*:path"     # Include only paths of files directly in assets/
   - "docs/api.md"       # Include path & content of docs/api.md
+  - "web/**/*.{ts,tsx}" # Include all TypeScript files below web/
+  - "!src/generated"    # Drop src/generated collected by the "src" entry
+  - "internal/:outline" # Only signatures and declarations of Go files in internal/
+` + "```" + `
+
+---
+
+## ` + "`order`" + `
+-   **Type**: ` + "`String`" + `
+-   **Required**: No
+-   **Default**: ` + "`\"path\"`" + `
+-   **Description**: The order of files in the output. It never depends on which worker finishes first, so unchanged trees produce byte-identical output.
+    -   ` + "`\"path\"`" + `: sorted by path, as in the preview.
+    -   ` + "`\"include\"`" + `: grouped by the include entry that collected them, in list order, and by path within each entry. A file matched by several entries belongs to the last one.
+-   **Example**:
+` + "```yaml" + `
+order: "include"
 ` + "```" + `
 
 ---
@@ -78,15 +99,155 @@ output: "project_data_output.json"
 
 ---
 
+## ` + "`output_format`" + `
+-   **Type**: ` + "`String`" + `
+-   **Required**: No
+-   **Default**: inferred from the extension of ` + "`output`" + ` (` + "`.jsonl`" + `, ` + "`.md`" + `, ` + "`.xml`" + `, ` + "`.txt`" + `), otherwise ` + "`json`" + `.
+-   **Description**: The format of the output file.
+    -   ` + "`\"json\"`" + `: ` + "`{\"project_files\": [...]}`" + `, indented.
+    -   ` + "`\"jsonl\"`" + `: one JSON object per line.
+    -   ` + "`\"markdown\"`" + `: a heading per file and its content in a fenced code block tagged with the language.
+    -   ` + "`\"xml\"`" + `: ` + "`<file path=\"...\">`" + ` elements inside ` + "`<files>`" + `; content is written verbatim, not XML-escaped.
+    -   ` + "`\"text\"`" + `: a ` + "`==> path <==`" + ` header line per file followed by its content.
+-   **Example**:
+` + "```yaml" + `
+output: "context.md" # markdown, inferred from the extension
+` + "```" + `
+
+---
+
+## ` + "`output_template`" + `
+-   **Type**: ` + "`String`" + `
+-   **Required**: No
+-   **Description**: Path to a Go ` + "`text/template`" + ` file that renders the whole output instead of ` + "`output_format`" + `. It runs once with all files, which are held in memory until the end of the run. It receives ` + "`.Files`" + ` (each with ` + "`.Path`" + `, ` + "`.OriginalPath`" + `, ` + "`.Format`" + `, ` + "`.Mode`" + `, ` + "`.Size`" + `, ` + "`.Content`" + `, ` + "`.HasContent`" + `, ` + "`.HasPath`" + `, ` + "`.Error`" + `) and ` + "`.Run`" + ` (` + "`.Root`" + `, ` + "`.FileCount`" + `, ` + "`.TotalTokens`" + `, ` + "`.TotalSize`" + `, ` + "`.Tokenizer`" + `). Functions: ` + "`lang`" + `, ` + "`indent N s`" + `, ` + "`tokens s`" + ` and ` + "`tree .Files`" + `.
+-   **Example template**:
+` + "````" + `
+Review the {{.Run.Root}} project ({{.Run.FileCount}} files).
+
+{{tree .Files}}
+{{range .Files}}
+--- {{.Path}} ---
+{{- if .HasContent}}
+` + "```" + `{{lang .Format}}
+{{.Content}}
+` + "```" + `
+{{- end}}
+{{end}}
+` + "````" + `
+
+---
+
+## ` + "`file_fields`" + `
+-   **Type**: ` + "`List of Strings`" + `
+-   **Required**: No
+-   **Description**: Extra fields written with every file, between ` + "`path`" + ` and ` + "`content`" + `: ` + "`language`" + `, ` + "`size_bytes`" + `, ` + "`lines`" + `, ` + "`tokens`" + `, ` + "`sha256`" + `, ` + "`mtime`" + ` and ` + "`bytes_removed`" + ` (by content exclusions). JSON and JSONL write them as keys, XML as attributes; markdown and text show path and content only.
+-   **Example**:
+` + "```yaml" + `
+file_fields: [language, lines, tokens, sha256]
+` + "```" + `
+
+---
+
+## ` + "`tree`" + `
+-   **Type**: ` + "`Object`" + `
+-   **Required**: No
+-   **Description**: Adds a project tree section to the output (the ` + "`tree`" + ` field in JSON, a block or element in the other formats, ` + "`.Tree`" + ` in templates), built from the previewed files.
+    -   ` + "`enabled`" + `: turns the section on.
+    -   ` + "`max_depth`" + `: levels shown below the root (0 = all).
+    -   ` + "`collapse_over`" + `: directories with more entries are shown as ` + "`name/ (N entries)`" + ` (0 = never).
+    -   ` + "`show_uncollected`" + `: also lists existing but non-collected files, marked ` + "`[not collected]`" + `.
+-   **Example**:
+` + "```yaml" + `
+tree:
+  enabled: true
+  max_depth: 3
+  collapse_over: 40
+  show_uncollected: true
+` + "```" + `
+
+---
+
+## ` + "`meta`" + `
+-   **Type**: ` + "`Boolean`" + `
+-   **Required**: No (defaults to ` + "`false`" + `)
+-   **Description**: Adds a ` + "`meta`" + ` object after the files (the last line in JSONL, a block or element in the other formats, ` + "`.Meta`" + ` in templates) with the generation time, projectson version, config file path, SHA-256 of the effective config, root name, file count, source byte and token totals, and, when the root is inside a git work tree, the HEAD commit, branch and dirty flag. The timestamp makes every run's output different.
+-   **Example**:
+` + "```yaml" + `
+meta: true
+` + "```" + `
+
+---
+
+## ` + "`chunking`" + `
+-   **Type**: ` + "`Object`" + `
+-   **Required**: No
+-   **Description**: Splits the output into part files next to ` + "`output`" + ` (` + "`output.part-001.json`" + `, ` + "`output.part-002.json`" + `, ...) plus an index file (` + "`output.index.json`" + `) listing the paths in every part. Nothing is written to ` + "`output`" + ` itself.
+    -   ` + "`enabled`" + `: turns chunking on; needs at least one limit.
+    -   ` + "`max_tokens`" + `: token limit per part.
+    -   ` + "`max_bytes`" + `: size limit per part file.
+
+    Files of the same directory stay in one part when they fit; a file is only split when it exceeds a limit on its own, and the index lists it under ` + "`split`" + `. The tree goes into the first part; with ` + "`meta`" + ` every part has its own meta object.
+-   **Example**:
+` + "```yaml" + `
+chunking:
+  enabled: true
+  max_tokens: 100000
+` + "```" + `
+
+---
+
+## ` + "`cache`" + `, ` + "`cache_dir`" + `
+-   **Type**: ` + "`Boolean`" + `, ` + "`String`" + `
+-   **Required**: No (defaults to ` + "`false`" + ` and ` + "`.projectson-cache`" + ` in the root)
+-   **Description**: Stores processed files in ` + "`cache_dir`" + ` and reuses them on later runs. A file is processed again when its size, modification time or content changes, or when its mode, the content exclusion rules that apply to it or its whitespace settings change. Hits and misses appear on the Stats page. Directories named ` + "`.projectson-cache`" + ` are never collected.
+-   **Example**:
+` + "```yaml" + `
+cache: true
+` + "```" + `
+
+---
+
+## ` + "`on_error`" + `
+-   **Type**: ` + "`String`" + `
+-   **Required**: No (defaults to ` + "`\"skip\"`" + `)
+-   **Description**: What a run does with a file it cannot read or process:
+    -   ` + "`\"skip\"`" + `: the file is left out of the output.
+    -   ` + "`\"fail\"`" + `: the run stops and the previous output is left unchanged.
+    -   ` + "`\"placeholder\"`" + `: the file is written with its path and an ` + "`error`" + ` field instead of the content, so the model knows it exists.
+
+    Skipped files and placeholders are counted on the Stats page and listed under Problems.
+-   **Example**:
+` + "```yaml" + `
+on_error: "placeholder"
+` + "```" + `
+
+---
+
+## ` + "`apply_allowlist`" + `, ` + "`apply_allow`" + `
+-   **Type**: ` + "`Boolean`" + `, ` + "`List of Strings`" + `
+-   **Required**: No (defaults to ` + "`false`" + ` and none)
+-   **Description**: Limits the files an AI response applied in the Apply tab may touch. With the allowlist on, a response may only touch files written to the output by the last run and files matching an ` + "`apply_allow`" + ` glob (relative to the root, e.g. ` + "`src/**`" + `). Setting ` + "`apply_allow`" + ` turns it on as well. Runs record their files in ` + "`.projectson/collected.json`" + ` while it is on.
+
+    Whatever the setting, absolute paths, paths leaving the root (also through symbolic links) and writes into ` + "`.git`" + ` are rejected.
+-   **Example**:
+` + "```yaml" + `
+apply_allowlist: true
+apply_allow:
+  - "docs/**/*.md"
+` + "```" + `
+
+---
+
 ## ` + "`exclude_patterns`" + `
 -   **Type**: ` + "`List of Strings`" + `
 -   **Required**: No
--   **Description**: A list of patterns to exclude files or directories. These patterns are applied *after* ` + "`include`" + ` rules and ` + "`formats`" + ` have identified potential candidates.
-    -   **Glob Patterns**: Standard file globbing (e.g., ` + "`node_modules`" + `, ` + "`*.log`" + `, ` + "`dist/*`" + `). These match against:
-        1.  The base name of the file or directory (e.g., ` + "`*.log`" + ` matches ` + "`debug.log`" + `).
-        2.  The path relative to ` + "`root`" + ` (e.g., ` + "`src/tests/*`" + ` matches ` + "`src/tests/test_helper.go`" + ` if the pattern contains a path separator).
+-   **Description**: A list of patterns to exclude files or directories. These patterns are applied *after* ` + "`include`" + ` rules and ` + "`formats`" + ` have identified potential candidates. Patterns are evaluated in order and the last matching pattern decides.
+    -   **Glob Patterns**: File globbing with ` + "`*`" + `, ` + "`?`" + `, ` + "`[...]`" + `, ` + "`**`" + ` and brace expansion (e.g., ` + "`node_modules`" + `, ` + "`*.log`" + `, ` + "`**/testdata/**`" + `, ` + "`*.{png,jpg}`" + `). These match against:
+        1.  The base name of the file or directory, if the pattern has no ` + "`/`" + ` (e.g., ` + "`*.log`" + ` matches ` + "`debug.log`" + `).
+        2.  The path relative to ` + "`root`" + `, if the pattern contains a ` + "`/`" + ` (e.g., ` + "`src/tests/*`" + ` matches ` + "`src/tests/test_helper.go`" + `).
+    -   **Negation**: A pattern prefixed with ` + "`!`" + ` re-includes paths excluded by an earlier pattern.
     -   **Regular Expressions**: Go-compatible regular expressions. Must be enclosed in forward slashes (e.g., ` + "`/\\.git/`" + `, ` + "`/private_.*\\.key$/`" + `). These also match against basenames or relative paths.
--   **Note**: If a directory is excluded, its contents will not be scanned.
+-   **Note**: If a directory is excluded, its contents will not be scanned, so files inside it cannot be re-included with ` + "`!`" + `.
 -   **Examples**:
 ` + "```yaml" + `
 exclude_patterns:
@@ -97,6 +258,9 @@ exclude_patterns:
   - "/test_data/"   # Exclude directories named test_data (regex matching the name)
   - "/^\\.(svn|hg|DS_Store)/" # Exclude common VCS and OS files (regex)
   - "target/*"      # Exclude contents of a target directory (glob)
+  - "**/testdata/**" # Exclude everything inside any testdata directory
+  - "*.{png,jpg,gif}" # Exclude images (brace expansion)
+  - "!logo.png"     # ...but keep logo.png
 ` + "```" + `
 
 ---
@@ -108,6 +272,7 @@ exclude_patterns:
     -   ` + "`type` (String, Required)" + `: Specifies the type of exclusion.
         -   ` + "`\"delimiters\"`" + `: Uses start and end string tags to identify content to remove.
         -   ` + "`\"regexp\"`" + `: Uses a regular expression to identify content to remove.
+        -   ` + "`\"comments\"`" + `: Removes comments with a lexer for the file's language that skips strings, raw strings and nested comments. Supported: Go, JS/TS, Vue ` + "`<script>`" + ` blocks, Python, Rust, Java, Kotlin, C/C++, SQL, shell, YAML.
     -   ` + "`file_pattern` (String, Required)" + `: A glob pattern that specifies which files this rule applies to, based on their extension.
         -   It is tested against the file's extension string (e.g., ` + "`file_pattern: \"vue\"`" + ` would match files with a ` + "`.vue`" + ` extension, as the code tests against ` + "`\"vue\"`" + `).
         -   It is also tested against the file's extension string prefixed with a dot (e.g., ` + "`file_pattern: \"*.vue\"`" + ` would match files with a ` + "`.vue`" + ` extension, as the code tests against ` + "`\".vue\"`" + `).
@@ -116,6 +281,8 @@ exclude_patterns:
     -   ` + "`start` (String, Optional)" + `: Used when ` + "`type`" + ` is ` + "`\"delimiters\"`" + `. The starting string tag of the content to exclude.
     -   ` + "`end` (String, Optional)" + `: Used when ` + "`type`" + ` is ` + "`\"delimiters\"`" + `. The ending string tag of the content to exclude.
     -   ` + "`pattern` (String, Optional)" + `: Used when ` + "`type`" + ` is ` + "`\"regexp\"`" + `. The Go-compatible regular expression. The regex should be crafted to match the content you want to remove. It's often useful to use the ` + "`(?s)`" + ` flag (dot matches newline) for multi-line patterns.
+    -   ` + "`language` (String, Optional)" + `: Used when ` + "`type`" + ` is ` + "`\"comments\"`" + `. Inferred from the file extension when empty; files of unsupported formats are left alone.
+    -   ` + "`keep_doc_comments` (Boolean, Optional)" + `: Used when ` + "`type`" + ` is ` + "`\"comments\"`" + `. Keeps doc comments directly above exported declarations (Go upper-case names, JS/TS ` + "`export`" + `, Rust ` + "`pub`" + `, Java ` + "`public`" + `, ...).
 -   **Examples**:
 ` + "```yaml" + `
 content_exclusions:
@@ -133,12 +300,85 @@ content_exclusions:
   - type: "regexp"
     file_pattern: "*" # Apply to all matched file types
     pattern: "SECRET_API_KEY = '.*?'" # Remove a line containing a secret key
+  - type: "comments"
+    file_pattern: "*" # Every format with a known language
+    keep_doc_comments: true
   - type: "regexp"
     file_pattern: "java"
     # Example: Remove a specific Java annotation block or a generated class/method.
     # This regex might need adjustments based on specific code style.
     pattern: "@Generated(?:\\s*\\([^)]*\\))?\\s*(?:public\\s+|protected\\s+|private\\s+)?(?:static\\s+|final\\s+)?(?:class|interface|enum|@interface|\\S+\\s+\\S+\\s*\\([^)]*\\))\\s*\\S+\\s*(?:\\{[\\s\\S]*?\\}|;)"
 ` + "```" + `
+
+---
+
+## ` + "`respect_gitignore`" + `
+-   **Type**: ` + "`Boolean`" + `
+-   **Required**: No (Defaults to ` + "`false`" + `)
+-   **Description**: When ` + "`true`" + `, files ignored by git are skipped in addition to ` + "`exclude_patterns`" + `. Sources, from lowest to highest precedence: ` + "`global_gitignore`" + `, ` + "`.git/info/exclude`" + `, the root ` + "`.gitignore`" + `, then nested ` + "`.gitignore`" + ` files. Negation (` + "`!`" + `), anchored (` + "`/`" + `) and directory-only (trailing ` + "`/`" + `) patterns and ` + "`**`" + ` are supported. The ` + "`.git`" + ` directory is always skipped.
+-   **Example**:
+` + "```yaml" + `
+respect_gitignore: true
+` + "```" + `
+
+---
+
+## ` + "`global_gitignore`" + `
+-   **Type**: ` + "`String`" + `
+-   **Required**: No
+-   **Description**: Path to a global ignore file, read only when ` + "`respect_gitignore`" + ` is enabled. A leading ` + "`~`" + ` is expanded to the home directory.
+-   **Example**:
+` + "```yaml" + `
+global_gitignore: "~/.config/git/ignore"
+` + "```" + `
+
+---
+
+## ` + "`whitespace`" + `, ` + "`format_whitespace`" + `, ` + "`tab_width`" + `
+-   **Type**: ` + "`String`" + `, ` + "`Map of String to String`" + `, ` + "`Integer`" + `
+-   **Required**: No (Defaults to ` + "`\"collapse\"`" + `, none and ` + "`4`" + `)
+-   **Description**: How whitespace in collected content is written, in the run output and in the Preview "Content After Exclusions" panel. ` + "`format_whitespace`" + ` overrides the policy per format.
+    -   ` + "`\"collapse\"`" + `: every whitespace run becomes one space (breaks indentation).
+    -   ` + "`\"preserve\"`" + `: content is kept as is.
+    -   ` + "`\"trim_trailing\"`" + `: trailing whitespace and extra blank lines are removed, indentation is kept.
+    -   ` + "`\"tabs_to_spaces\"`" + `: like ` + "`\"trim_trailing\"`" + `, and tabs are expanded to ` + "`tab_width`" + ` columns.
+-   **Example**:
+` + "```yaml" + `
+whitespace: "collapse"
+format_whitespace:
+  py: "trim_trailing"
+  yaml: "preserve"
+` + "```" + `
+
+---
+
+## ` + "`tokenizer`" + `, ` + "`chars_per_token`" + `
+-   **Type**: ` + "`String`" + `, ` + "`Number`" + `
+-   **Required**: No (Defaults to ` + "`\"chars\"`" + ` and ` + "`4`" + `)
+-   **Description**: The estimator used to count tokens, reported per file and in total after each run. Neither matches a particular model's tokenizer exactly.
+    -   ` + "`\"chars\"`" + `: Characters divided by ` + "`chars_per_token`" + `.
+    -   ` + "`\"bpe-approx\"`" + `: Byte-level BPE with ` + "`cl100k_base`" + ` pre-tokenization but a small vocabulary of its own. Counts are a rough approximation only.
+
+---
+
+## ` + "`max_tokens`" + `, ` + "`max_output_bytes`" + `, ` + "`budget_action`" + `, ` + "`excerpt_tokens`" + `
+-   **Type**: ` + "`Integer`" + `, ` + "`Integer`" + `, ` + "`String`" + `, ` + "`Integer`" + `
+-   **Required**: No (Defaults to ` + "`0`" + ` (no limit), ` + "`0`" + ` (no limit), ` + "`\"trim\"`" + ` and ` + "`200`" + `)
+-   **Description**: Token and byte budgets for the whole output. When one is exceeded, ` + "`budget_action`" + ` decides:
+    -   ` + "`\"trim\"`" + `: the file crossing the budget is truncated and all following files are omitted.
+    -   ` + "`\"prune\"`" + `: files are degraded lowest include priority first. Large files become head/tail excerpts of ` + "`excerpt_tokens`" + ` tokens, then files are reduced to their path, then removed.
+    -   ` + "`\"fail\"`" + `: the run fails.
+
+    Degraded files and the reason are shown on the Stats page.
+-   **Example**:
+` + "```yaml" + `
+max_tokens: 120000
+max_output_bytes: 500000
+budget_action: "prune"
+include:
+  - "src:10"
+  - "examples:-5"
+` + "```" + `
 `
 
 // MakeConfigDocsPage creates the UI for displaying the configuration documentation.
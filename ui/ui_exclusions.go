@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"projectson/comments"
 	"projectson/config"
 
 	"fyne.io/fyne/v2"
@@ -12,6 +13,9 @@ import (
 	"fyne.io/fyne/v2/widget"
 )
 
+// autoLanguage is shown for comment rules that infer the language from the file format.
+const autoLanguage = "auto"
+
 // MakeExclusionsPage creates the UI for content exclusion rules.
 func MakeExclusionsPage(collectorService *CollectorService, onConfigModified func()) fyne.CanvasObject {
 	cfg := collectorService.GetConfig()
@@ -32,7 +36,7 @@ func MakeExclusionsPage(collectorService *CollectorService, onConfigModified fun
 			localIdx := i
 			currentRule := rule
 
-			ruleTypeSelect := widget.NewSelect([]string{"delimiters", "regexp"}, nil)
+			ruleTypeSelect := widget.NewSelect([]string{"delimiters", "regexp", "comments"}, nil)
 			ruleTypeSelect.SetSelected(currentRule.Type)
 			if currentRule.Type == "" {
 				ruleTypeSelect.SetSelected("delimiters")
@@ -81,6 +85,34 @@ func MakeExclusionsPage(collectorService *CollectorService, onConfigModified fun
 				}
 			}
 
+			languageSelect := widget.NewSelect(append([]string{autoLanguage}, comments.Languages()...), func(selected string) {
+				if localIdx < len(cfg.ContentExclusions) {
+					if selected == autoLanguage {
+						selected = ""
+					}
+					cfg.ContentExclusions[localIdx].Language = selected
+					applyChangesAndNotify()
+				}
+			})
+			if currentRule.Language == "" {
+				languageSelect.Selected = autoLanguage
+			} else {
+				languageSelect.Selected = currentRule.Language
+			}
+
+			keepDocCheck := widget.NewCheck("Keep doc comments on exported symbols", func(checked bool) {
+				if localIdx < len(cfg.ContentExclusions) {
+					cfg.ContentExclusions[localIdx].KeepDocComments = checked
+					applyChangesAndNotify()
+				}
+			})
+			keepDocCheck.Checked = currentRule.KeepDocComments
+
+			commentsFields := container.NewVBox(
+				widget.NewForm(widget.NewFormItem("Language", languageSelect)),
+				keepDocCheck,
+			)
+
 			delimiterFields := widget.NewForm(
 				widget.NewFormItem("Start Delimiter", startDelimiterEntry),
 				widget.NewFormItem("End Delimiter", endDelimiterEntry),
@@ -89,9 +121,12 @@ func MakeExclusionsPage(collectorService *CollectorService, onConfigModified fun
 			specificsContainer := container.NewStack()
 
 			updateSpecificsVisibility := func(ruleType string) {
-				if ruleType == "delimiters" {
+				switch ruleType {
+				case "delimiters":
 					specificsContainer.Objects = []fyne.CanvasObject{delimiterFields}
-				} else { // regexp
+				case "comments":
+					specificsContainer.Objects = []fyne.CanvasObject{commentsFields}
+				default: // regexp
 					specificsContainer.Objects = []fyne.CanvasObject{regexpFormItemContainer}
 				}
 				specificsContainer.Refresh()
@@ -142,6 +177,9 @@ func MakeExclusionsPage(collectorService *CollectorService, onConfigModified fun
 Types:
 - Delimiters: Define start and end text tags (e.g., <script> and </script>).
 - Regexp: Use regular expressions for complex patterns.
+- Comments: Strip comments with a language-aware lexer that skips strings,
+  raw strings and nested comments. Language "auto" picks the lexer from the
+  file extension (go, js/ts, vue, py, rs, java, kt, c/cpp, sql, sh, yaml).
 File Pattern:
 - Glob pattern to match files (e.g., "*.vue", "main.js", "*" for all).
 - Matches against file extension (e.g., "vue") or full filename (e.g. ".env.example").
@@ -152,7 +190,11 @@ Examples:
    (Or use regexp with pattern: <style.*?>[\s\S]*?</style.*?> for attributes)
 2. Exclude JS comments:
    Type: regexp, File Pattern: *.js
-   Pattern: (//.*)|(/\*[\s\S]*?\*/)`
+   Pattern: (//.*)|(/\*[\s\S]*?\*/)
+   (Prefer the comments type: this regex also matches "//" inside strings)
+3. Strip comments from all supported files, keeping doc comments:
+   Type: comments, File Pattern: *, Language: auto
+   Keep doc comments on exported symbols: checked`
 	helpCard := widget.NewCard("Help & Examples", "", widget.NewLabel(helpText))
 
 	return container.NewVScroll(container.NewVBox(
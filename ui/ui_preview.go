@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sort"
@@ -172,19 +174,34 @@ func MakePreviewPage(collectorService *CollectorService, window fyne.Window) fyn
 		modeFilter.Refresh()
 	}
 
+	problems := newProblemsPanel()
+	problems.SetDiagnostics(collectorService.GetPreviewDiagnostics())
+
 	loading := widget.NewProgressBarInfinite()
 	loading.Hide()
+	cancelButton := widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), func() {
+		statusLabel.SetText("Cancelling scan...")
+		collectorService.CancelPreview()
+	})
+	cancelButton.Hide()
 	var refreshButton *widget.Button
 
 	refreshButton = widget.NewButtonWithIcon("Refresh File List", theme.ViewRefreshIcon(), func() {
 		statusLabel.SetText("Scanning files...")
 		loading.Show()
+		cancelButton.Show()
 		refreshButton.Disable()
 
 		collectorService.PerformPreview(func(files []collector.FileEntry, err error) {
 			loading.Hide()
+			cancelButton.Hide()
 			refreshButton.Enable()
-			if err != nil {
+			problems.SetDiagnostics(collectorService.GetPreviewDiagnostics())
+			if errors.Is(err, context.Canceled) {
+				statusLabel.SetText("Scan cancelled.")
+				currentFiles = []collector.FileEntry{}
+				populateFilters(nil)
+			} else if err != nil {
 				dialog.ShowError(fmt.Errorf("error previewing files: %w", err), window)
 				statusLabel.SetText("Error scanning files.")
 				currentFiles = []collector.FileEntry{}
@@ -210,8 +227,9 @@ func MakePreviewPage(collectorService *CollectorService, window fyne.Window) fyn
 
 	return container.NewBorder(
 		container.NewVBox(
-			container.NewHBox(refreshButton, loading),
+			container.NewHBox(refreshButton, cancelButton, loading),
 			statusLabel,
+			problems.accordion,
 			filterToolbar,
 		),
 		nil,
@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"fmt"
+	"projectson/collector"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/layout"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+// problemsPanel lists the diagnostics of a preview or run in a collapsible
+// section. It is hidden while there are none.
+type problemsPanel struct {
+	accordion *widget.Accordion
+	item      *widget.AccordionItem
+	rows      *fyne.Container
+}
+
+func newProblemsPanel() *problemsPanel {
+	p := &problemsPanel{rows: container.New(layout.NewFormLayout())}
+	p.item = widget.NewAccordionItem("Problems", container.NewVScroll(p.rows))
+	p.accordion = widget.NewAccordion(p.item)
+	p.accordion.Hide()
+	return p
+}
+
+// SetDiagnostics replaces the listed diagnostics.
+func (p *problemsPanel) SetDiagnostics(diags []collector.Diagnostic) {
+	p.rows.RemoveAll()
+	if len(diags) == 0 {
+		p.accordion.Hide()
+		return
+	}
+	for _, d := range diags {
+		icon := theme.WarningIcon()
+		if d.Severity == collector.SeverityError {
+			icon = theme.ErrorIcon()
+		}
+		p.rows.Add(container.NewHBox(widget.NewIcon(icon), widget.NewLabel(d.Code)))
+		text := d.Message
+		if d.Path != "" {
+			text = d.Path + ": " + text
+		}
+		message := widget.NewLabel(text)
+		message.Wrapping = fyne.TextWrapWord
+		p.rows.Add(message)
+	}
+	p.item.Title = "Problems (" + problemsSummary(diags) + ")"
+	p.accordion.Refresh()
+	p.accordion.Show()
+}
+
+// Open expands the list.
+func (p *problemsPanel) Open() {
+	p.accordion.Open(0)
+}
+
+// problemsSummary counts diagnostics by severity, e.g. "2 warnings, 1 error".
+func problemsSummary(diags []collector.Diagnostic) string {
+	warnings, errs := 0, 0
+	for _, d := range diags {
+		if d.Severity == collector.SeverityError {
+			errs++
+		} else {
+			warnings++
+		}
+	}
+	return fmt.Sprintf("%s, %s", plural(warnings, "warning"), plural(errs, "error"))
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -10,6 +11,8 @@ import (
 	"fyne.io/fyne/v2/widget"
 	"os"
 	"path/filepath"
+	"projectson/collector"
+	"projectson/config"
 	"strings"
 )
 
@@ -23,13 +26,32 @@ func MakeRunPage(collectorService *CollectorService, window fyne.Window, statusB
 	rootLabel := widget.NewLabel("Root: " + cfg.Root)
 	formatsLabel := widget.NewLabel("Formats: " + strings.Join(cfg.Formats, ", "))
 	outputLabel := widget.NewLabel("Output: " + cfg.Output)
+	if cfg.Chunking.Enabled {
+		outputLabel.SetText("Output: " + collector.ChunkIndexPath(cfg.Output) + " (index of the part files)")
+	}
 	includesLabel := widget.NewLabel(fmt.Sprintf("Includes: %d rules", len(cfg.Include)))
 	excludesLabel := widget.NewLabel(fmt.Sprintf("Excludes: %d patterns", len(cfg.ExcludePatterns)))
 	contentExclLabel := widget.NewLabel(fmt.Sprintf("Content Exclusions: %d rules", len(cfg.ContentExclusions)))
+	tokenBudgetText := "Budget: none"
+	if cfg.MaxTokens > 0 || cfg.MaxOutputBytes > 0 {
+		action := cfg.BudgetAction
+		if action == "" {
+			action = config.BudgetActions[0]
+		}
+		var limits []string
+		if cfg.MaxTokens > 0 {
+			limits = append(limits, fmt.Sprintf("%d tokens", cfg.MaxTokens))
+		}
+		if cfg.MaxOutputBytes > 0 {
+			limits = append(limits, fmt.Sprintf("%d bytes", cfg.MaxOutputBytes))
+		}
+		tokenBudgetText = fmt.Sprintf("Budget: %s (%s when exceeded)", strings.Join(limits, ", "), action)
+	}
+	tokenBudgetLabel := widget.NewLabel(tokenBudgetText)
 
 	configSummaryBox := container.NewVBox(
 		widget.NewLabelWithStyle("Current Configuration Summary:", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
-		rootLabel, formatsLabel, outputLabel, includesLabel, excludesLabel, contentExclLabel,
+		rootLabel, formatsLabel, outputLabel, includesLabel, excludesLabel, contentExclLabel, tokenBudgetLabel,
 	)
 
 	filesToProcessLabel := widget.NewLabel("Files to process: (Run Preview first or it will scan on Run)")
@@ -45,11 +67,22 @@ func MakeRunPage(collectorService *CollectorService, window fyne.Window, statusB
 	progressStatus.Hide()
 
 	runButton := widget.NewButtonWithIcon("Run Collection Process", theme.MediaPlayIcon(), nil) // Action set later
-	downloadButton := widget.NewButtonWithIcon("Save Output JSON", theme.DownloadIcon(), nil)
+	downloadButton := widget.NewButtonWithIcon("Save Output File", theme.DownloadIcon(), nil)
 	downloadButton.Disable() // Enabled if output file exists
+	cancelButton := widget.NewButtonWithIcon("Cancel", theme.CancelIcon(), func() {
+		progressStatus.SetText("Cancelling...")
+		collectorService.CancelRun()
+	})
+	cancelButton.Hide()
+
+	autoRegenerateCheck := widget.NewCheck("Auto-regenerate when files change", nil) // Action set later
 
 	checkOutputFile := func() {
 		currentConfig := collectorService.GetConfig() // Get fresh config for output path
+		if currentConfig.Chunking.Enabled {
+			downloadButton.Disable() // Parts are listed in the index file next to the output path
+			return
+		}
 		if _, err := os.Stat(currentConfig.Output); err == nil {
 			downloadButton.Enable()
 		} else {
@@ -83,7 +116,7 @@ func MakeRunPage(collectorService *CollectorService, window fyne.Window, statusB
 				dialog.ShowError(fmt.Errorf("failed to save copy of output file: %w", writeErr), window)
 				return
 			}
-			dialog.ShowInformation("Download Complete", "Output JSON saved to: "+writer.URI().Path(), window)
+			dialog.ShowInformation("Download Complete", "Output saved to: "+writer.URI().Path(), window)
 		}, window)
 		saveDialog.SetFileName(filepath.Base(currentConfig.Output)) // Suggest original filename
 		saveDialog.Show()
@@ -91,6 +124,8 @@ func MakeRunPage(collectorService *CollectorService, window fyne.Window, statusB
 
 	runButton.OnTapped = func() {
 		runButton.Disable()
+		autoRegenerateCheck.Disable()
+		cancelButton.Show()
 		progressBar.SetValue(0)
 		progressBar.Show()
 		progressStatus.SetText("Preparing to run...")
@@ -101,6 +136,8 @@ func MakeRunPage(collectorService *CollectorService, window fyne.Window, statusB
 		if err := collectorService.rebuildCollectorIfNeeded(); err != nil {
 			dialog.ShowError(fmt.Errorf("failed to initialize collector before run: %w. Check config and validate.", err), window)
 			runButton.Enable()
+			autoRegenerateCheck.Enable()
+			cancelButton.Hide()
 			progressBar.Hide()
 			progressStatus.Hide()
 			statusBar.SetText("Run failed: Collector initialization error.")
@@ -119,16 +156,27 @@ func MakeRunPage(collectorService *CollectorService, window fyne.Window, statusB
 			},
 			func(stats RunStats) { // OnComplete callback
 				runButton.Enable()
+				autoRegenerateCheck.Enable()
+				cancelButton.Hide()
 				progressBar.Hide() // Or set to 100% then hide
 				progressStatus.Hide()
 
-				if stats.ErrorMessage != "" {
-					dialog.ShowError(fmt.Errorf(stats.ErrorMessage), window)
+				if stats.Cancelled {
+					statusBar.SetText(stats.ErrorMessage)
+				} else if stats.ErrorMessage != "" {
+					dialog.ShowError(errors.New(stats.ErrorMessage), window)
 					statusBar.SetText("Run failed: " + stats.ErrorMessage)
 				} else {
-					successMsg := fmt.Sprintf("✅ Successfully processed %d files in %.2f seconds. Output size: %s",
-						stats.FileCount, stats.ProcessTime.Seconds(), stats.OutputSize)
-					dialog.ShowInformation("Run Complete", successMsg, window)
+					successMsg := fmt.Sprintf("✅ Successfully processed %d files in %.2f seconds. Output size: %s, tokens: %d",
+						stats.FileCount, stats.ProcessTime.Seconds(), stats.OutputSize, stats.TotalTokens)
+					if len(stats.Parts) > 0 {
+						successMsg += fmt.Sprintf(", %d parts (index: %s)", len(stats.Parts), filepath.Base(stats.IndexFile))
+					}
+					dialogMsg := successMsg
+					if len(stats.Diagnostics) > 0 {
+						dialogMsg += fmt.Sprintf("\n%s; see Problems on the Stats page", problemsSummary(stats.Diagnostics))
+					}
+					dialog.ShowInformation("Run Complete", dialogMsg, window)
 					statusBar.SetText(successMsg)
 					filesToProcessLabel.SetText(fmt.Sprintf("Files processed in last run: %d", stats.FileCount))
 				}
@@ -140,6 +188,39 @@ func MakeRunPage(collectorService *CollectorService, window fyne.Window, statusB
 		)
 	}
 
+	autoRegenerateCheck.Checked = collectorService.IsWatching()
+	if autoRegenerateCheck.Checked {
+		runButton.Disable()
+	}
+	onWatchRun := func(stats RunStats) {
+		if stats.ErrorMessage != "" {
+			statusBar.SetText("Auto-regenerate: " + stats.ErrorMessage)
+		} else {
+			statusBar.SetText(fmt.Sprintf("Auto-regenerated at %s: %d files, %s, tokens: %d",
+				stats.Timestamp.Format("15:04:05"), stats.FileCount, stats.OutputSize, stats.TotalTokens))
+			filesToProcessLabel.SetText(fmt.Sprintf("Files processed in last run: %d", stats.FileCount))
+		}
+		checkOutputFile()
+		if onRunComplete != nil {
+			onRunComplete()
+		}
+	}
+	autoRegenerateCheck.OnChanged = func(checked bool) {
+		if !checked {
+			collectorService.StopWatch()
+			runButton.Enable()
+			statusBar.SetText("Auto-regenerate stopped.")
+			return
+		}
+		if err := collectorService.StartWatch(onWatchRun); err != nil {
+			dialog.ShowError(fmt.Errorf("failed to start auto-regenerate: %w", err), window)
+			autoRegenerateCheck.SetChecked(false)
+			return
+		}
+		runButton.Disable() // Runs are started by file changes until unchecked
+		statusBar.SetText("Auto-regenerate on: watching the included directories.")
+	}
+
 	// The UI should be rebuilt if config changes to update the summary.
 	// This can be done by the main app's `fullUIUpdateOnConfigChange`.
 	// So, this MakeRunPage itself doesn't need an `onConfigModified` callback.
@@ -149,7 +230,8 @@ func MakeRunPage(collectorService *CollectorService, window fyne.Window, statusB
 		widget.NewSeparator(),
 		filesToProcessLabel,
 		widget.NewSeparator(),
-		runButton,
+		container.NewHBox(runButton, cancelButton),
+		autoRegenerateCheck,
 		progressBar,
 		progressStatus,
 		widget.NewSeparator(),
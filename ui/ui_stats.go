@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"projectson/collector"
 	"sort"
 	"strings"
 
@@ -29,14 +30,69 @@ func MakeStatsPage(collectorService *CollectorService) fyne.CanvasObject {
 		runDetails := container.New(layout.NewFormLayout(),
 			widget.NewLabel("Files Processed:"), widget.NewLabel(fmt.Sprintf("%d", stats.FileCount)),
 			widget.NewLabel("Output Size:"), widget.NewLabel(stats.OutputSize),
+			widget.NewLabel("Tokens:"), widget.NewLabel(fmt.Sprintf("%d (%s)", stats.TotalTokens, stats.Tokenizer)),
 			widget.NewLabel("Processing Time:"), widget.NewLabel(fmt.Sprintf("%.2f seconds", stats.ProcessTime.Seconds())),
 			widget.NewLabel("Timestamp:"), widget.NewLabel(stats.Timestamp.Format("2006-01-02 15:04:05")),
 		)
-		if stats.ErrorMessage != "" {
+		if stats.Cancelled {
+			runDetails.Add(widget.NewLabel("Status:"))
+			runDetails.Add(widget.NewLabel(stats.ErrorMessage))
+		} else if stats.ErrorMessage != "" {
 			runDetails.Add(widget.NewLabel("Status:"))
 			runDetails.Add(widget.NewLabel("Failed: " + stats.ErrorMessage))
 		}
+		if len(stats.Parts) > 0 {
+			runDetails.Add(widget.NewLabel("Parts:"))
+			runDetails.Add(widget.NewLabel(fmt.Sprintf("%d (index: %s)", len(stats.Parts), stats.IndexFile)))
+		}
+		if stats.ConfigUsed != nil && stats.ConfigUsed.Cache && stats.ErrorMessage == "" {
+			runDetails.Add(widget.NewLabel("Cache:"))
+			runDetails.Add(widget.NewLabel(fmt.Sprintf("%d hits, %d misses", stats.CacheHits, stats.CacheMisses)))
+		}
+		if len(stats.Degraded) > 0 {
+			runDetails.Add(widget.NewLabel("Degraded (budget):"))
+			runDetails.Add(widget.NewLabel(fmt.Sprintf("%d files", len(stats.Degraded))))
+		}
+		if stats.Skipped > 0 {
+			runDetails.Add(widget.NewLabel("Skipped (errors):"))
+			runDetails.Add(widget.NewLabel(fmt.Sprintf("%d files", stats.Skipped)))
+		}
+		if stats.Placeholders > 0 {
+			runDetails.Add(widget.NewLabel("Placeholders (errors):"))
+			runDetails.Add(widget.NewLabel(fmt.Sprintf("%d files", stats.Placeholders)))
+		}
+		if len(stats.Diagnostics) > 0 {
+			runDetails.Add(widget.NewLabel("Problems:"))
+			runDetails.Add(widget.NewLabel(problemsSummary(stats.Diagnostics)))
+		}
 		mainVBox.Add(runDetails)
+
+		if len(stats.Diagnostics) > 0 {
+			problems := newProblemsPanel()
+			problems.SetDiagnostics(stats.Diagnostics)
+			problems.Open()
+			mainVBox.Add(problems.accordion)
+		}
+
+		if len(stats.Degraded) > 0 {
+			degradedRows := container.New(layout.NewFormLayout())
+			for _, d := range stats.Degraded {
+				degradedRows.Add(widget.NewLabel(d.Action))
+				degradedRows.Add(widget.NewLabel(fmt.Sprintf("%s (%s)", d.Path, d.Reason)))
+			}
+			mainVBox.Add(widget.NewCard("Degraded Files", "Changed or dropped to fit max_tokens / max_output_bytes", degradedRows))
+		}
+
+		if len(stats.FileTokens) > 0 {
+			sortedTokens := append([]collector.FileTokens(nil), stats.FileTokens...)
+			sort.SliceStable(sortedTokens, func(i, j int) bool { return sortedTokens[i].Tokens > sortedTokens[j].Tokens })
+			tokenRows := container.New(layout.NewFormLayout())
+			for _, ft := range sortedTokens {
+				tokenRows.Add(widget.NewLabel(fmt.Sprintf("%d", ft.Tokens)))
+				tokenRows.Add(widget.NewLabel(ft.Path))
+			}
+			mainVBox.Add(widget.NewCard("Tokens per File", "Sorted by token count", tokenRows))
+		}
 		mainVBox.Add(widget.NewSeparator())
 	}
 
@@ -120,9 +176,16 @@ func MakeStatsPage(collectorService *CollectorService) fyne.CanvasObject {
 
 		for _, rule := range currentCfg.ContentExclusions {
 			details := ""
-			if rule.Type == "delimiters" {
+			switch rule.Type {
+			case "delimiters":
 				details = fmt.Sprintf("Start: '%s', End: '%s'", rule.Start, rule.End)
-			} else {
+			case "comments":
+				language := rule.Language
+				if language == "" {
+					language = autoLanguage
+				}
+				details = fmt.Sprintf("Language: %s, Keep doc comments: %t", language, rule.KeepDocComments)
+			default:
 				details = fmt.Sprintf("Regex: '%s'", rule.Pattern)
 			}
 			row := container.NewGridWithColumns(3,
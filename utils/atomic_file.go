@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile is written as a temporary file next to its target and renamed
+// over the target by Commit, so readers never see a partially written file.
+type AtomicFile struct {
+	*os.File
+	target string
+	staged bool
+	done   bool
+}
+
+// CreateAtomicFile creates a temporary file in the directory of target.
+func CreateAtomicFile(target string) (*AtomicFile, error) {
+	dir, base := filepath.Split(target)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := os.CreateTemp(dir, "."+base+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temporary file for %s: %w", target, err)
+	}
+	return &AtomicFile{File: f, target: target}, nil
+}
+
+// Stage flushes the temporary file to disk, closes it and sets its
+// permissions, leaving only the rename to Commit. Staging several files before committing any of
+// them keeps a failed write from replacing some of the targets but not others.
+func (f *AtomicFile) Stage(perm os.FileMode) error {
+	if f.done || f.staged {
+		return fmt.Errorf("%s already staged, committed or aborted", f.target)
+	}
+	f.staged = true
+	err := f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err != nil {
+		f.done = true
+		os.Remove(f.Name())
+		return fmt.Errorf("writing %s: %w", f.target, err)
+	}
+	return nil
+}
+
+// Commit stages the temporary file unless Stage was called, and renames it
+// to the target.
+func (f *AtomicFile) Commit(perm os.FileMode) error {
+	if f.done {
+		return fmt.Errorf("%s already committed or aborted", f.target)
+	}
+	if !f.staged {
+		if err := f.Stage(perm); err != nil {
+			return err
+		}
+	}
+	f.done = true
+	if err := os.Rename(f.Name(), f.target); err != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("writing %s: %w", f.target, err)
+	}
+	return nil
+}
+
+// Abort discards the temporary file unless it has been committed. It is safe
+// to defer right after CreateAtomicFile.
+func (f *AtomicFile) Abort() {
+	if f.done {
+		return
+	}
+	f.done = true
+	if !f.staged {
+		f.Close()
+	}
+	os.Remove(f.Name())
+}
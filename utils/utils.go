@@ -2,8 +2,15 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 )
 
+// HasGlobMeta reports whether s contains glob special characters, as
+// understood by include entries and exclude_patterns.
+func HasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[{")
+}
+
 // FormatSize converts bytes to a human-readable string.
 func FormatSize(sizeBytes int64) string {
 	const (